@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAppendOnlyPath = "appendonly.aof"
+	aofRewriteBatch       = 64
+)
+
+type FsyncPolicy int
+
+const (
+	FsyncAlways FsyncPolicy = iota
+	FsyncEverySec
+	FsyncNo
+)
+
+func ParseFsyncPolicy(str string) (FsyncPolicy, error) {
+	switch strings.ToLower(str) {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec":
+		return FsyncEverySec, nil
+	case "no":
+		return FsyncNo, nil
+	}
+
+	return 0, fmt.Errorf("miniredis: invalid fsync policy %q", str)
+}
+
+type appendOnlyFile struct {
+	enabled    int32
+	mutex      sync.Mutex
+	path       string
+	policy     FsyncPolicy
+	file       *os.File
+	writer     *RespWriter
+	rewriting  bool
+	rewriteBuf *bytes.Buffer
+	stop       chan struct{}
+}
+
+func (store *Store) OpenAppendOnlyFile(path string, policy FsyncPolicy) error {
+	aof := &store.aof
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	valid, err := store.replayAppendOnlyFile(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("miniredis: could not load append only file %q: %v", path, err)
+	}
+
+	if info, err := file.Stat(); err == nil && info.Size() > valid {
+		log.Printf("Truncating %d bytes of incomplete commands at the end of %q", info.Size()-valid, path)
+		if err := file.Truncate(valid); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+
+	aof.mutex.Lock()
+	aof.path, aof.policy = path, policy
+	aof.file, aof.writer = file, NewRespWriter(file)
+	aof.stop = make(chan struct{})
+	aof.mutex.Unlock()
+
+	if policy == FsyncEverySec {
+		go store.fsyncEverySecond(aof.stop)
+	}
+
+	atomic.StoreInt32(&aof.enabled, 1)
+	return nil
+}
+
+func (store *Store) CloseAppendOnlyFile() error {
+	aof := &store.aof
+	if !atomic.CompareAndSwapInt32(&aof.enabled, 1, 0) {
+		return nil
+	}
+
+	aof.mutex.Lock()
+	defer aof.mutex.Unlock()
+
+	close(aof.stop)
+	if err := aof.writer.Flush(); err != nil {
+		aof.file.Close()
+		return err
+	}
+
+	if err := aof.file.Sync(); err != nil {
+		aof.file.Close()
+		return err
+	}
+
+	return aof.file.Close()
+}
+
+func (store *Store) replayAppendOnlyFile(file io.Reader) (int64, error) {
+	counter := &countingReader{reader: file}
+	reader := NewRespReader(counter)
+	intr := Interpreter{Store: store}.WithClient(NewLeaderClient(nil))
+	txn := intr.client.Transaction()
+
+	var valid int64
+	for {
+		offset := counter.count - int64(reader.Buffered())
+		args, err := reader.ReadCommand()
+		if err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			log.Printf("Ignoring truncated command at the end of the append only file")
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		if _, ok := lookupCommand(args[0]); !ok {
+			return 0, fmt.Errorf("unknown command %q at offset %d", args[0], offset)
+		}
+
+		if _, err := intr.ExecArgs(args); err != nil {
+			return 0, fmt.Errorf("command %q at offset %d failed: %v", args[0], offset, err)
+		}
+
+		if !txn.Active() {
+			valid = counter.count - int64(reader.Buffered())
+		}
+	}
+
+	if txn.Active() {
+		log.Printf("Discarding unfinished transaction at the end of the append only file")
+		intr.ExecArgs([]string{"DISCARD"})
+	}
+
+	return valid, nil
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (counter *countingReader) Read(buf []byte) (int, error) {
+	n, err := counter.reader.Read(buf)
+	counter.count += int64(n)
+
+	return n, err
+}
+
+func (store *Store) appendRecords(records [][]string) error {
+	aof := &store.aof
+	aof.mutex.Lock()
+	defer aof.mutex.Unlock()
+
+	if atomic.LoadInt32(&aof.enabled) == 0 {
+		return nil
+	}
+
+	for _, record := range records {
+		aof.writer.WriteValue(record)
+
+		if aof.rewriting {
+			writer := NewRespWriter(aof.rewriteBuf)
+			writer.WriteValue(record)
+			writer.Flush()
+		}
+	}
+
+	if err := aof.writer.Flush(); err != nil {
+		return err
+	}
+
+	if aof.policy == FsyncAlways {
+		return aof.file.Sync()
+	}
+
+	return nil
+}
+
+func (store *Store) fsyncEverySecond(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		aof := &store.aof
+		aof.mutex.Lock()
+		if err := aof.file.Sync(); err != nil {
+			log.Printf("Got the following error while syncing the append only file: %v", err)
+		}
+		aof.mutex.Unlock()
+	}
+}
+
+func (store *Store) BgRewriteAof() error {
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	return store.bgRewriteAof()
+}
+
+func (store *Store) bgRewriteAof() error {
+	aof := &store.aof
+	aof.mutex.Lock()
+	defer aof.mutex.Unlock()
+
+	switch {
+	case atomic.LoadInt32(&aof.enabled) == 0:
+		return fmt.Errorf("miniredis: Append only file is not enabled")
+	case aof.rewriting:
+		return fmt.Errorf("miniredis: Background append only file rewriting already in progress")
+	}
+
+	aof.rewriting = true
+	aof.rewriteBuf = new(bytes.Buffer)
+
+	dump, path := store.beginDump(), aof.path
+	go func() {
+		if err := store.rewriteAppendOnlyFile(path, dump); err != nil {
+			log.Printf("Got the following error while rewriting the append only file: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func (store *Store) rewriteAppendOnlyFile(path string, dump *storeDump) error {
+	aof := &store.aof
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), "temp-rewrite-*.aof")
+	if err == nil {
+		defer os.Remove(temp.Name())
+		err = store.writeRewriteRecords(temp, dump)
+	} else {
+		store.abandonDump(dump, 0)
+	}
+
+	aof.mutex.Lock()
+	defer aof.mutex.Unlock()
+
+	buffered := aof.rewriteBuf
+	aof.rewriting, aof.rewriteBuf = false, nil
+
+	if err != nil {
+		if temp != nil {
+			temp.Close()
+		}
+		return err
+	}
+
+	if _, err := buffered.WriteTo(temp); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if atomic.LoadInt32(&aof.enabled) == 0 {
+		temp.Close()
+		return nil
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		temp.Close()
+		return err
+	}
+
+	aof.writer.Flush()
+	aof.file.Close()
+	aof.file, aof.writer = temp, NewRespWriter(temp)
+
+	return nil
+}
+
+func (store *Store) writeRewriteRecords(file *os.File, dump *storeDump) error {
+	writer := NewRespWriter(file)
+	err := store.rangeDump(dump, func(e dumpEntry) error {
+		for _, record := range rewriteRecords(e) {
+			if err := writer.WriteValue(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+func rewriteRecords(e dumpEntry) [][]string {
+	var records [][]string
+
+	switch typed := e.value.(type) {
+	case string:
+		records = append(records, []string{"SET", e.key, typed})
+	case int:
+		records = append(records, []string{"SET", e.key, strconv.Itoa(typed)})
+	case *SortedSet:
+		for _, item := range typed.Slice(0, typed.Len()-1) {
+			records = append(records, []string{"ZADD", e.key, formatFloat(item.Score), item.Member})
+		}
+	case *Hash:
+		items := typed.Items()
+		args := make([]string, 0, 2*len(items))
+		for _, item := range items {
+			args = append(args, item.Field, item.Value)
+		}
+		records = batchRecords(records, "HSET", e.key, args, 2)
+	case *List:
+		records = batchRecords(records, "RPUSH", e.key, typed.Slice(0, -1), 1)
+	case *Set:
+		records = batchRecords(records, "SADD", e.key, typed.items, 1)
+	default:
+		log.Printf("Skipping key %q holding a value of unsupported type %T", e.key, e.value)
+		return nil
+	}
+
+	if e.deadline != 0 {
+		records = append(records, []string{"PEXPIREAT", e.key, strconv.FormatInt(e.deadline/int64(time.Millisecond), 10)})
+	}
+
+	return records
+}
+
+func batchRecords(records [][]string, name, key string, args []string, width int) [][]string {
+	for start := 0; start < len(args); start += aofRewriteBatch * width {
+		end := start + aofRewriteBatch*width
+		if end > len(args) {
+			end = len(args)
+		}
+
+		records = append(records, append([]string{name, key}, args[start:end]...))
+	}
+
+	return records
+}
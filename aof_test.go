@@ -0,0 +1,251 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openAofTestAux(t *testing.T, path string) (*Store, Interpreter) {
+	store := new(Store)
+	if err := store.OpenAppendOnlyFile(path, FsyncAlways); err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+
+	return store, Interpreter{Store: store}.WithClient(NewClient(nil))
+}
+
+func readAofTestAux(t *testing.T, path string) [][]string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+	defer file.Close()
+
+	var records [][]string
+	reader := NewRespReader(file)
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			return records
+		}
+
+		records = append(records, args)
+	}
+}
+
+func TestAppendOnlyFile(t *testing.T) {
+	dir := snapshotTestDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "appendonly.aof")
+
+	t.Run("log and replay write commands", func(t *testing.T) {
+		store, intr := openAofTestAux(t, path)
+
+		cmds := []string{
+			"SET a 1",
+			"GET a",
+			"INCR a",
+			"SET b value EX 100",
+			"SET c value",
+			"EXPIRE c 200",
+			"SET d value",
+			"PEXPIRE d 0",
+			"HSET h f v",
+			"SADD s x",
+			"SPOP s",
+			"RPUSH src 1 2",
+			"BLMOVE src dst LEFT RIGHT 0",
+			"MULTI",
+			"LPUSH dst 0",
+			"DEL a",
+			"EXEC",
+			"ZADD z 1 m",
+		}
+
+		for _, cmd := range cmds {
+			if _, err := intr.Exec(cmd); err != nil {
+				t.Fatalf("%s: expected nil, got %q", cmd, err)
+			}
+		}
+
+		waiter := bPopTestAux(store, []string{"queue"}, 0, nil)
+		waitForWaiters(t, store, 1)
+		intr.Exec("RPUSH queue job")
+		receiveTestAux(t, waiter)
+
+		intr.Exec("RPUSH queue other")
+		store.CloseAppendOnlyFile()
+
+		records := readAofTestAux(t, path)
+		assertInterface(t, []string{"SET", "b", "value"}, records[2])
+		assertInterface(t, "PEXPIREAT", records[3][0])
+		assertInterface(t, []string{"DEL", "d"}, records[7])
+		assertInterface(t, []string{"SREM", "s", "x"}, records[10])
+		assertInterface(t, []string{"LMOVE", "src", "dst", "LEFT", "RIGHT"}, records[12])
+		assertInterface(t, []string{"MULTI"}, records[13])
+		assertInterface(t, []string{"RPUSH", "queue", "job"}, records[18])
+		assertInterface(t, []string{"LPOP", "queue"}, records[19])
+
+		loaded, _ := openAofTestAux(t, path)
+		defer loaded.CloseAppendOnlyFile()
+
+		assertInterface(t, 7, loaded.DbSize())
+
+		values, _ := loaded.LRange("dst", 0, -1)
+		assertInterface(t, []string{"0", "1"}, values)
+
+		values, _ = loaded.LRange("queue", 0, -1)
+		assertInterface(t, []string{"other"}, values)
+
+		_, _, volatile := loaded.Deadline("b")
+		assertInterface(t, true, volatile)
+
+		count, _ := loaded.SCard("s")
+		assertInterface(t, 0, count)
+	})
+
+	t.Run("ignore truncated final command", func(t *testing.T) {
+		file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		file.WriteString("*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$5\r\nva")
+		file.Close()
+
+		store, intr := openAofTestAux(t, path)
+		assertInterface(t, 7, store.DbSize())
+
+		intr.Exec("SET y 1")
+		store.CloseAppendOnlyFile()
+
+		loaded, _ := openAofTestAux(t, path)
+		defer loaded.CloseAppendOnlyFile()
+
+		value, _, _ := loaded.Get("y")
+		assertInterface(t, "1", value)
+	})
+
+	t.Run("discard unfinished transaction", func(t *testing.T) {
+		file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		file.WriteString("*1\r\n$5\r\nMULTI\r\n*2\r\n$3\r\nDEL\r\n$1\r\ny\r\n")
+		file.Close()
+
+		before, _ := ioutil.ReadFile(path)
+
+		store, _ := openAofTestAux(t, path)
+		store.CloseAppendOnlyFile()
+
+		value, _, _ := store.Get("y")
+		assertInterface(t, "1", value)
+
+		after, _ := ioutil.ReadFile(path)
+		assertInterface(t, false, strings.Contains(string(after), "MULTI\r\n*2\r\n$3\r\nDEL"))
+		assertInterface(t, true, len(after) < len(before))
+	})
+
+	t.Run("reject corrupted file", func(t *testing.T) {
+		corrupted := filepath.Join(dir, "corrupted.aof")
+		ioutil.WriteFile(corrupted, []byte("*1\r\n$7\r\nUNKNOWN\r\n"), 0644)
+
+		if err := new(Store).OpenAppendOnlyFile(corrupted, FsyncNo); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("reject failing command", func(t *testing.T) {
+		failing := filepath.Join(dir, "failing.aof")
+		ioutil.WriteFile(failing, []byte("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n*3\r\n$5\r\nLPUSH\r\n$1\r\nk\r\n$1\r\nv\r\n"), 0644)
+
+		err := new(Store).OpenAppendOnlyFile(failing, FsyncNo)
+		if err == nil || !strings.Contains(err.Error(), `command "LPUSH" at offset 27 failed`) {
+			t.Errorf("expected failing command error, got %v", err)
+		}
+	})
+
+	t.Run("replay beyond the memory limit", func(t *testing.T) {
+		store := new(Store)
+		store.SetMaxMemory(1, NoEviction, 0)
+		if err := store.OpenAppendOnlyFile(path, FsyncNo); err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+		defer store.CloseAppendOnlyFile()
+
+		assertInterface(t, 8, store.DbSize())
+	})
+}
+
+func TestBgRewriteAof(t *testing.T) {
+	dir := snapshotTestDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "appendonly.aof")
+	store, intr := openAofTestAux(t, path)
+
+	for index := 0; index < 100; index++ {
+		intr.Exec("INCR counter")
+		intr.Exec("RPUSH list item")
+	}
+	intr.Exec("SET volatile value EX 100")
+	intr.Exec("HSET hash a 1 b 2")
+
+	assertExec(t, intr, execTestAux{"BGREWRITEAOF", 0, SimpleString("Background append only file rewriting started")})
+	intr.Exec("SADD set member")
+
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		store.aof.mutex.Lock()
+		rewriting := store.aof.rewriting
+		store.aof.mutex.Unlock()
+
+		if !rewriting {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected rewrite to finish")
+		}
+	}
+
+	for index := range store.shards {
+		assertInterface(t, 0, len(store.shards[index].dumps))
+	}
+
+	intr.Exec("INCR counter")
+	store.CloseAppendOnlyFile()
+
+	records := readAofTestAux(t, path)
+	if len(records) > 10 {
+		t.Errorf("expected compacted file, got %d records", len(records))
+	}
+
+	loaded, _ := openAofTestAux(t, path)
+	defer loaded.CloseAppendOnlyFile()
+
+	value, _, _ := loaded.Get("counter")
+	assertInterface(t, "101", value)
+
+	count, _ := loaded.LLen("list")
+	assertInterface(t, 100, count)
+
+	isMember, _ := loaded.SIsMember("set", "member")
+	assertInterface(t, true, isMember)
+
+	fields, _ := loaded.HGetAll("hash")
+	assertInterface(t, []HashItem{{"a", "1"}, {"b", "2"}}, fields)
+
+	_, _, volatile := loaded.Deadline("volatile")
+	assertInterface(t, true, volatile)
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for str, expected := range map[string]FsyncPolicy{"always": FsyncAlways, "EverySec": FsyncEverySec, "no": FsyncNo} {
+		policy, err := ParseFsyncPolicy(str)
+		assertInterface(t, nil, err)
+		assertInterface(t, expected, policy)
+	}
+
+	if _, err := ParseFsyncPolicy("sometimes"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
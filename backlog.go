@@ -0,0 +1,54 @@
+package main
+
+type replicationBacklog struct {
+	buf  []byte
+	size int
+	end  int64
+}
+
+func newReplicationBacklog(capacity int, offset int64) *replicationBacklog {
+	return &replicationBacklog{buf: make([]byte, capacity), end: offset}
+}
+
+func (backlog *replicationBacklog) start() int64 {
+	return backlog.end - int64(backlog.size)
+}
+
+func (backlog *replicationBacklog) write(data []byte) {
+	capacity := len(backlog.buf)
+	if backlog.size += len(data); backlog.size > capacity {
+		backlog.size = capacity
+	}
+
+	if len(data) > capacity {
+		backlog.end += int64(len(data) - capacity)
+		data = data[len(data)-capacity:]
+	}
+
+	for len(data) > 0 {
+		n := copy(backlog.buf[backlog.end%int64(capacity):], data)
+		data = data[n:]
+		backlog.end += int64(n)
+	}
+}
+
+func (backlog *replicationBacklog) since(offset int64) ([]byte, bool) {
+	if offset < backlog.start() || offset > backlog.end {
+		return nil, false
+	}
+
+	capacity := int64(len(backlog.buf))
+	data := make([]byte, 0, backlog.end-offset)
+	for pos := offset; pos < backlog.end; {
+		index := pos % capacity
+		chunk := backlog.buf[index:]
+		if remaining := backlog.end - pos; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+
+		data = append(data, chunk...)
+		pos += int64(len(chunk))
+	}
+
+	return data, true
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type blockedRegistry struct {
+	mutex   sync.Mutex
+	count   int32
+	waiters map[string][]*listWaiter
+}
+
+type listWaiter struct {
+	keys        []string
+	from        ListEnd
+	move        bool
+	destination string
+	to          ListEnd
+
+	mutex  sync.Mutex
+	done   bool
+	result chan listWaiterResult
+}
+
+type listWaiterResult struct {
+	key   string
+	value string
+	err   error
+}
+
+func (waiter *listWaiter) claim() bool {
+	waiter.mutex.Lock()
+	defer waiter.mutex.Unlock()
+
+	if waiter.done {
+		return false
+	}
+
+	waiter.done = true
+	return true
+}
+
+func (store *Store) BPop(keys []string, from ListEnd, timeout time.Duration, cancel <-chan struct{}) (string, string, bool, error) {
+	key, value, ok, waiter, err := store.bPop(keys, from, true)
+	if waiter != nil {
+		return store.await(waiter, timeout, cancel)
+	}
+
+	return key, value, ok, err
+}
+
+func (store *Store) bPop(keys []string, from ListEnd, block bool) (string, string, bool, *listWaiter, error) {
+	unlock := store.LockKeys(keys...)
+	defer unlock()
+
+	for _, key := range keys {
+		list, err := store.loadList(key, false)
+		if err != nil {
+			return "", "", false, nil, err
+		}
+
+		if list != nil {
+			value, _ := list.Pop(from)
+			store.touchList(key, list, true)
+			store.propagate(popCommand(from), key)
+
+			return key, value, true, nil, nil
+		}
+	}
+
+	if !block {
+		return "", "", false, nil, nil
+	}
+
+	waiter := &listWaiter{keys: keys, from: from, result: make(chan listWaiterResult, 1)}
+	store.block(waiter)
+
+	return "", "", false, waiter, nil
+}
+
+func (store *Store) BLMove(source, destination string, from, to ListEnd, timeout time.Duration, cancel <-chan struct{}) (string, bool, error) {
+	value, ok, waiter, err := store.bLMove(source, destination, from, to, true)
+	if waiter != nil {
+		_, value, ok, err = store.await(waiter, timeout, cancel)
+	}
+
+	return value, ok, err
+}
+
+func (store *Store) bLMove(source, destination string, from, to ListEnd, block bool) (string, bool, *listWaiter, error) {
+	unlock := store.LockKeys(source, destination)
+
+	value, ok, err := store.lMove(source, destination, from, to)
+	if err != nil || ok || !block {
+		unlock()
+
+		if ok {
+			store.propagate(moveCommand(source, destination, from, to)...)
+			store.serveBlocked(destination)
+		}
+
+		return value, ok, nil, err
+	}
+
+	waiter := &listWaiter{
+		keys:        []string{source},
+		from:        from,
+		move:        true,
+		destination: destination,
+		to:          to,
+		result:      make(chan listWaiterResult, 1),
+	}
+	store.block(waiter)
+	unlock()
+
+	return "", false, waiter, nil
+}
+
+func (store *Store) block(waiter *listWaiter) {
+	registry := &store.blocked
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.waiters == nil {
+		registry.waiters = make(map[string][]*listWaiter)
+	}
+
+	for _, key := range waiter.keys {
+		registry.waiters[key] = append(registry.waiters[key], waiter)
+	}
+
+	atomic.AddInt32(&registry.count, 1)
+}
+
+func (store *Store) unblock(waiter *listWaiter) {
+	registry := &store.blocked
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, key := range waiter.keys {
+		waiters := registry.waiters[key]
+		for index, candidate := range waiters {
+			if candidate == waiter {
+				waiters = append(waiters[:index:index], waiters[index+1:]...)
+				break
+			}
+		}
+
+		if len(waiters) == 0 {
+			delete(registry.waiters, key)
+		} else {
+			registry.waiters[key] = waiters
+		}
+	}
+
+	atomic.AddInt32(&registry.count, -1)
+}
+
+func (store *Store) await(waiter *listWaiter, timeout time.Duration, cancel <-chan struct{}) (string, string, bool, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+
+	select {
+	case result := <-waiter.result:
+		return result.key, result.value, result.err == nil, result.err
+	case <-expired:
+	case <-cancel:
+	}
+
+	if !waiter.claim() {
+		result := <-waiter.result
+		return result.key, result.value, result.err == nil, result.err
+	}
+
+	store.unblock(waiter)
+	return "", "", false, nil
+}
+
+func (store *Store) firstWaiter(key string) *listWaiter {
+	registry := &store.blocked
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, waiter := range registry.waiters[key] {
+		waiter.mutex.Lock()
+		done := waiter.done
+		waiter.mutex.Unlock()
+
+		if !done {
+			return waiter
+		}
+	}
+
+	return nil
+}
+
+func (store *Store) serveBlocked(key string) {
+	if atomic.LoadInt32(&store.blocked.count) == 0 {
+		return
+	}
+
+	for {
+		waiter := store.firstWaiter(key)
+		if waiter == nil {
+			return
+		}
+
+		served, destination := store.serveWaiter(waiter, key)
+		if !served {
+			return
+		}
+
+		if destination != "" {
+			store.serveBlocked(destination)
+		}
+	}
+}
+
+func (store *Store) serveWaiter(waiter *listWaiter, key string) (bool, string) {
+	keys := []string{key}
+	if waiter.move {
+		keys = append(keys, waiter.destination)
+	}
+
+	unlock := store.LockKeys(keys...)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil || err != nil {
+		return false, ""
+	}
+
+	if waiter.move {
+		if _, err := store.loadList(waiter.destination, false); err != nil {
+			if waiter.claim() {
+				store.unblock(waiter)
+				waiter.result <- listWaiterResult{err: err}
+			}
+
+			return true, ""
+		}
+	}
+
+	if !waiter.claim() {
+		return true, ""
+	}
+
+	value, _ := list.Pop(waiter.from)
+	store.touchList(key, list, true)
+
+	destination := ""
+	if waiter.move {
+		dst, _ := store.loadList(waiter.destination, true)
+		dst.Push(waiter.to, value)
+		store.touch(waiter.destination)
+		store.propagate(moveCommand(key, waiter.destination, waiter.from, waiter.to)...)
+		destination = waiter.destination
+	} else {
+		store.propagate(popCommand(waiter.from), key)
+	}
+
+	store.unblock(waiter)
+	waiter.result <- listWaiterResult{key: key, value: value}
+
+	return true, destination
+}
+
+func popCommand(from ListEnd) string {
+	if from == ListLeft {
+		return "LPOP"
+	}
+
+	return "RPOP"
+}
+
+func moveCommand(source, destination string, from, to ListEnd) []string {
+	return []string{"LMOVE", source, destination, listEndName(from), listEndName(to)}
+}
+
+func listEndName(end ListEnd) string {
+	if end == ListLeft {
+		return "LEFT"
+	}
+
+	return "RIGHT"
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type bPopTestResult struct {
+	key, value string
+	ok         bool
+	err        error
+}
+
+func bPopTestAux(store *Store, keys []string, timeout time.Duration, cancel <-chan struct{}) chan bPopTestResult {
+	ch := make(chan bPopTestResult, 1)
+	go func() {
+		key, value, ok, err := store.BPop(keys, ListLeft, timeout, cancel)
+		ch <- bPopTestResult{key, value, ok, err}
+	}()
+
+	return ch
+}
+
+func waitForWaiters(t *testing.T, store *Store, count int32) {
+	for start := time.Now(); atomic.LoadInt32(&store.blocked.count) != count; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected %d blocked clients, got %d", count, atomic.LoadInt32(&store.blocked.count))
+		}
+	}
+}
+
+func receiveTestAux(t *testing.T, ch chan bPopTestResult) bPopTestResult {
+	select {
+	case result := <-ch:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected blocked client to be served")
+	}
+
+	return bPopTestResult{}
+}
+
+func TestBPop(t *testing.T) {
+	store := new(Store)
+
+	t.Run("pop from non empty list without blocking", func(t *testing.T) {
+		store.RPush("b", "1")
+		result := receiveTestAux(t, bPopTestAux(store, []string{"a", "b"}, 0, nil))
+		assertInterface(t, bPopTestResult{"b", "1", true, nil}, result)
+	})
+
+	t.Run("block until value is pushed", func(t *testing.T) {
+		ch := bPopTestAux(store, []string{"a", "b"}, 0, nil)
+		waitForWaiters(t, store, 1)
+
+		store.LPush("b", "2")
+		assertInterface(t, bPopTestResult{"b", "2", true, nil}, receiveTestAux(t, ch))
+		waitForWaiters(t, store, 0)
+		assertInterface(t, 0, store.DbSize())
+	})
+
+	t.Run("block until timeout", func(t *testing.T) {
+		result := receiveTestAux(t, bPopTestAux(store, []string{"a"}, 20*time.Millisecond, nil))
+		assertInterface(t, false, result.ok)
+		waitForWaiters(t, store, 0)
+	})
+
+	t.Run("serve waiting clients in FIFO order", func(t *testing.T) {
+		channels := make([]chan bPopTestResult, 3)
+		for index := range channels {
+			channels[index] = bPopTestAux(store, []string{"queue"}, 0, nil)
+			waitForWaiters(t, store, int32(index+1))
+		}
+
+		store.RPush("queue", "first", "second")
+		store.RPush("queue", "third", "fourth")
+
+		assertInterface(t, "first", receiveTestAux(t, channels[0]).value)
+		assertInterface(t, "second", receiveTestAux(t, channels[1]).value)
+		assertInterface(t, "third", receiveTestAux(t, channels[2]).value)
+
+		values, _ := store.LRange("queue", 0, -1)
+		assertInterface(t, []string{"fourth"}, values)
+		store.Del("queue")
+	})
+
+	t.Run("cancelled client does not consume values", func(t *testing.T) {
+		cancel := make(chan struct{})
+		ch := bPopTestAux(store, []string{"queue"}, 0, cancel)
+		waitForWaiters(t, store, 1)
+
+		close(cancel)
+		assertInterface(t, false, receiveTestAux(t, ch).ok)
+		waitForWaiters(t, store, 0)
+
+		store.RPush("queue", "value")
+		count, _ := store.LLen("queue")
+		assertInterface(t, 1, count)
+		store.Del("queue")
+	})
+
+	t.Run("keep waiting when key is deleted or changes type", func(t *testing.T) {
+		ch := bPopTestAux(store, []string{"queue"}, 0, nil)
+		waitForWaiters(t, store, 1)
+
+		store.Set("queue", "string")
+		store.Del("queue")
+		store.SAdd("queue", "member")
+		store.Del("queue")
+
+		select {
+		case result := <-ch:
+			t.Fatalf("expected client to keep waiting, got %v", result)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		store.RPush("queue", "value")
+		assertInterface(t, bPopTestResult{"queue", "value", true, nil}, receiveTestAux(t, ch))
+	})
+
+	t.Run("pop from key with invalid value", func(t *testing.T) {
+		store.Set("str", "value")
+		if result := receiveTestAux(t, bPopTestAux(store, []string{"str"}, 0, nil)); result.err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestBLMove(t *testing.T) {
+	store := new(Store)
+
+	t.Run("block until value is pushed and move it", func(t *testing.T) {
+		ch := make(chan string, 1)
+		go func() {
+			value, _, _ := store.BLMove("src", "dst", ListLeft, ListRight, 0, nil)
+			ch <- value
+		}()
+		waitForWaiters(t, store, 1)
+
+		store.RPush("src", "a", "b")
+
+		select {
+		case value := <-ch:
+			assertInterface(t, "a", value)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected blocked client to be served")
+		}
+
+		src, _ := store.LRange("src", 0, -1)
+		dst, _ := store.LRange("dst", 0, -1)
+		assertInterface(t, []string{"b"}, src)
+		assertInterface(t, []string{"a"}, dst)
+	})
+
+	t.Run("moved value wakes clients blocked on destination", func(t *testing.T) {
+		store.Del("src", "dst")
+
+		popped := bPopTestAux(store, []string{"dst"}, 0, nil)
+		waitForWaiters(t, store, 1)
+
+		go store.BLMove("src", "dst", ListLeft, ListRight, 0, nil)
+		waitForWaiters(t, store, 2)
+
+		store.RPush("src", "value")
+		assertInterface(t, bPopTestResult{"dst", "value", true, nil}, receiveTestAux(t, popped))
+	})
+
+	t.Run("fail when destination changes to invalid type", func(t *testing.T) {
+		store.Del("src", "dst")
+
+		ch := make(chan error, 1)
+		go func() {
+			_, _, err := store.BLMove("src", "dst", ListLeft, ListRight, 0, nil)
+			ch <- err
+		}()
+		waitForWaiters(t, store, 1)
+
+		store.Set("dst", "string")
+		store.RPush("src", "value")
+
+		select {
+		case err := <-ch:
+			if _, ok := err.(WrongTypeError); !ok {
+				t.Errorf("expected wrong type error, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected blocked client to be served")
+		}
+
+		count, _ := store.LLen("src")
+		assertInterface(t, 1, count)
+	})
+}
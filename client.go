@@ -0,0 +1,48 @@
+package main
+
+type Client struct {
+	done        <-chan struct{}
+	subscriber  *Subscriber
+	transaction Transaction
+	leader      bool
+}
+
+func NewClient(done <-chan struct{}) *Client {
+	return &Client{done: done}
+}
+
+func NewSubscriberClient(done <-chan struct{}, subscriber *Subscriber) *Client {
+	return &Client{done: done, subscriber: subscriber}
+}
+
+func NewLeaderClient(done <-chan struct{}) *Client {
+	return &Client{done: done, leader: true}
+}
+
+func (client *Client) Done() <-chan struct{} {
+	if client == nil {
+		return nil
+	}
+
+	return client.done
+}
+
+func (client *Client) Subscriber() *Subscriber {
+	if client == nil {
+		return nil
+	}
+
+	return client.subscriber
+}
+
+func (client *Client) Transaction() *Transaction {
+	if client == nil {
+		return nil
+	}
+
+	return &client.transaction
+}
+
+func (client *Client) Leader() bool {
+	return client != nil && client.leader
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type CommandFlags int
+
+const (
+	CommandWrite CommandFlags = 1 << iota
+	CommandReadOnly
+	CommandFast
+	CommandBlocking
+	CommandPubSub
+	CommandTransaction
+	CommandExclusive
+	CommandDenyOOM
+)
+
+type CommandHandler func(intr Interpreter, args []string) (interface{}, error)
+
+type Command struct {
+	Name    string
+	Arity   int
+	Flags   CommandFlags
+	Handler CommandHandler
+}
+
+var commandTable = make(map[string]*Command)
+
+func registerCommands(commands ...*Command) {
+	for _, command := range commands {
+		name := strings.ToUpper(command.Name)
+		if _, ok := commandTable[name]; ok {
+			panic(fmt.Sprintf("miniredis: command %q registered twice", name))
+		}
+
+		commandTable[name] = command
+	}
+}
+
+func lookupCommand(name string) (*Command, bool) {
+	command, ok := commandTable[strings.ToUpper(name)]
+	return command, ok
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commandTable))
+	for name := range commandTable {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (command *Command) HasFlag(flag CommandFlags) bool {
+	return command.Flags&flag != 0
+}
+
+func (command *Command) CheckArity(argc int) error {
+	if (command.Arity > 0 && argc != command.Arity) || (command.Arity < 0 && argc < -command.Arity) {
+		return arityError(strings.ToLower(command.Name))
+	}
+
+	return nil
+}
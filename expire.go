@@ -0,0 +1,174 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	activeExpireBatch    = 128
+	activeExpireMaxDelay = 100 * time.Millisecond
+)
+
+type expireState struct {
+	running  int32
+	volatile int64
+}
+
+type expireItem struct {
+	key      string
+	deadline int64
+	position int
+}
+
+type expireHeap []*expireItem
+
+func (items expireHeap) Len() int {
+	return len(items)
+}
+
+func (items expireHeap) Less(i, j int) bool {
+	return items[i].deadline < items[j].deadline
+}
+
+func (items expireHeap) Swap(i, j int) {
+	items[i], items[j] = items[j], items[i]
+	items[i].position = i
+	items[j].position = j
+}
+
+func (items *expireHeap) Push(value interface{}) {
+	item := value.(*expireItem)
+	item.position = len(*items)
+	*items = append(*items, item)
+}
+
+func (items *expireHeap) Pop() interface{} {
+	old := *items
+	last := len(old) - 1
+
+	item := old[last]
+	old[last] = nil
+	*items = old[:last]
+
+	return item
+}
+
+func (store *Store) scheduleExpire(shard *storeShard, key string, e, previous *entry) {
+	var item *expireItem
+	if previous != nil {
+		item = previous.expiry
+	}
+
+	switch {
+	case e.deadline != 0 && item != nil:
+		item.deadline = e.deadline
+		heap.Fix(&shard.expires, item.position)
+		e.expiry = item
+	case e.deadline != 0:
+		e.expiry = &expireItem{key: key, deadline: e.deadline}
+		heap.Push(&shard.expires, e.expiry)
+		atomic.AddInt64(&store.expires.volatile, 1)
+		store.startActiveExpire()
+	case item != nil:
+		heap.Remove(&shard.expires, item.position)
+		atomic.AddInt64(&store.expires.volatile, -1)
+	}
+}
+
+func (store *Store) unscheduleExpire(shard *storeShard, e *entry) {
+	if e.expiry != nil {
+		heap.Remove(&shard.expires, e.expiry.position)
+		atomic.AddInt64(&store.expires.volatile, -1)
+	}
+}
+
+func (store *Store) startActiveExpire() {
+	if atomic.CompareAndSwapInt32(&store.expires.running, 0, 1) {
+		go store.activeExpireCycle()
+	}
+}
+
+func (store *Store) activeExpireCycle() {
+	for {
+		if store.volatileCount() == 0 {
+			atomic.StoreInt32(&store.expires.running, 0)
+			if store.volatileCount() == 0 || !atomic.CompareAndSwapInt32(&store.expires.running, 0, 1) {
+				return
+			}
+		}
+
+		if wait := store.expireDueKeys(time.Now().UnixNano()); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func (store *Store) expireDueKeys(now int64) time.Duration {
+	store.txnLock.RLock()
+	defer store.txnLock.RUnlock()
+
+	wait, busy := activeExpireMaxDelay, false
+	for index := range store.shards {
+		shard := store.lockShard(index)
+
+		for count := 0; len(shard.expires) > 0 && shard.expires[0].deadline <= now; count++ {
+			if count == activeExpireBatch {
+				busy = true
+				break
+			}
+
+			key := shard.expires[0].key
+			store.remove(key, shard.entries[key])
+		}
+
+		if len(shard.expires) > 0 {
+			if next := time.Duration(shard.expires[0].deadline - now); next < wait {
+				wait = next
+			}
+		}
+
+		shard.mutex.Unlock()
+	}
+
+	switch {
+	case busy:
+		return 0
+	case wait < time.Millisecond:
+		return time.Millisecond
+	}
+
+	return wait
+}
+
+func (store *Store) expireKey(key string) {
+	unlock := store.LockKey(key)
+	unlock()
+}
+
+func (store *Store) volatileCount() int {
+	return int(atomic.LoadInt64(&store.expires.volatile))
+}
+
+func toDeadline(t time.Time) int64 {
+	switch {
+	case t.IsZero():
+		return 0
+	case t.Unix() >= math.MaxInt64/int64(time.Second):
+		return math.MaxInt64
+	case t.Unix() <= 0:
+		return 1
+	}
+
+	return t.UnixNano()
+}
+
+func fromDeadline(deadline int64) time.Time {
+	if deadline == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, deadline)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rawSize(store *Store) int {
+	count := 0
+	for index := range store.shards {
+		count += len(store.shards[index].entries)
+	}
+
+	return count
+}
+
+func storeEntryTestAux(store *Store, key string, e *entry) {
+	shard := store.shard(key)
+	if shard.entries == nil {
+		shard.entries = make(map[string]*entry)
+	}
+
+	shard.entries[key] = e
+	atomic.AddInt64(&store.keys, 1)
+}
+
+func TestLazyExpiration(t *testing.T) {
+	store := new(Store)
+
+	t.Run("expired key is not returned before active cycle runs", func(t *testing.T) {
+		storeEntryTestAux(store, "stale", &entry{value: "value", deadline: time.Now().Add(-time.Second).UnixNano()})
+
+		assertGet(t, store, "stale", "", false, false)
+		if size := rawSize(store); size != 0 {
+			t.Errorf("expected 0, got %v", size)
+		}
+	})
+
+	t.Run("expired key is not counted by DbSize once collected", func(t *testing.T) {
+		store.SetWithDeadline("stale", "value", time.Now().Add(10*time.Millisecond))
+		store.Set("foo", "bar")
+		waitForExpireCycle(t, store)
+
+		if size := store.DbSize(); size != 1 {
+			t.Errorf("expected 1, got %v", size)
+		}
+	})
+
+	t.Run("increment keeps deadline", func(t *testing.T) {
+		store.SetEx("counter", "1", 100)
+		store.Incr("counter")
+
+		if _, _, volatile := store.Deadline("counter"); !volatile {
+			t.Errorf("expected true, got false")
+		}
+	})
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	store := new(Store)
+
+	t.Run("expire keys without access", func(t *testing.T) {
+		for x := 0; x < 1000; x++ {
+			store.SetWithDeadline(strconv.Itoa(x), "value", time.Now().Add(10*time.Millisecond))
+		}
+
+		waitForExpireCycle(t, store)
+
+		if size := rawSize(store); size != 0 {
+			t.Errorf("expected 0, got %v", size)
+		}
+	})
+
+	t.Run("key set again is not expired by stale deadline", func(t *testing.T) {
+		store.SetWithDeadline("foo", "old", time.Now().Add(10*time.Millisecond))
+		store.Set("foo", "new")
+		store.SetWithDeadline("bar", "old", time.Now().Add(10*time.Millisecond))
+		store.SetWithDeadline("bar", "new", time.Now().Add(time.Hour))
+
+		time.Sleep(50 * time.Millisecond)
+
+		assertGet(t, store, "foo", "new", true, false)
+		assertGet(t, store, "bar", "new", true, false)
+	})
+
+	t.Run("deleted and persisted keys are unscheduled", func(t *testing.T) {
+		store.SetEx("fizz", "buzz", 100)
+		store.SetEx("buzz", "fizz", 100)
+		store.Del("fizz")
+		store.Persist("buzz")
+		store.Persist("bar")
+
+		if count := store.volatileCount(); count != 0 {
+			t.Errorf("expected 0, got %v", count)
+		}
+	})
+}
+
+func waitForExpireCycle(t *testing.T, store *Store) {
+	for start := time.Now(); store.volatileCount() > 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected active expire cycle to finish")
+		}
+	}
+
+	for atomic.LoadInt32(&store.expires.running) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+const expiringKeysCount = 1000000
+
+func BenchmarkSetExpiringKeys1M(b *testing.B) {
+	keys := make([]string, expiringKeysCount)
+	for x := range keys {
+		keys[x] = "session:" + strconv.Itoa(x)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		store := new(Store)
+		deadline := time.Now().Add(time.Hour)
+
+		for _, key := range keys {
+			store.SetWithDeadline(key, "value", deadline)
+		}
+
+		b.StopTimer()
+		for _, key := range keys {
+			store.Persist(key)
+		}
+		b.StartTimer()
+	}
+}
+
+func BenchmarkActiveExpire1M(b *testing.B) {
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		store := new(Store)
+		deadline := time.Now().Add(50 * time.Millisecond)
+		for x := 0; x < expiringKeysCount; x++ {
+			store.SetWithDeadline(strconv.Itoa(x), "value", deadline)
+		}
+
+		time.Sleep(time.Until(deadline))
+		b.StartTimer()
+
+		for store.volatileCount() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func BenchmarkGetExpiringKeysParallel(b *testing.B) {
+	store := new(Store)
+	deadline := time.Now().Add(time.Hour)
+	for x := 0; x < 1000; x++ {
+		store.SetWithDeadline(strconv.Itoa(x), "value", deadline)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		x := 0
+		for pb.Next() {
+			store.Get(strconv.Itoa(x % 1000))
+			x++
+		}
+	})
+}
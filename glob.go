@@ -0,0 +1,89 @@
+package main
+
+func globMatch(pattern, str string) bool {
+	star, retry := -1, 0
+	for p, s := 0, 0; s < len(str) || p < len(pattern); {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, retry = p, s
+				p++
+				continue
+			case '?':
+				if s < len(str) {
+					p, s = p+1, s+1
+					continue
+				}
+			case '[':
+				if s < len(str) {
+					if matched, rest := matchClass(pattern[p+1:], str[s]); matched {
+						p, s = len(pattern)-len(rest), s+1
+						continue
+					}
+				}
+			case '\\':
+				literal := p
+				if p+1 < len(pattern) {
+					literal = p + 1
+				}
+
+				if s < len(str) && pattern[literal] == str[s] {
+					p, s = literal+1, s+1
+					continue
+				}
+			default:
+				if s < len(str) && pattern[p] == str[s] {
+					p, s = p+1, s+1
+					continue
+				}
+			}
+		}
+
+		if star < 0 || retry >= len(str) {
+			return false
+		}
+
+		retry++
+		p, s = star+1, retry
+	}
+
+	return true
+}
+
+func matchClass(pattern string, char byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			if pattern[1] == char {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if char >= start && char <= end {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == char {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+
+	return matched != negate, pattern
+}
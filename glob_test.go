@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type globMatchTestAux struct {
+	pattern, str string
+	expected     bool
+}
+
+func TestGlobMatch(t *testing.T) {
+	t.Run("match multiple patterns", func(t *testing.T) {
+		tests := []globMatchTestAux{
+			{"*", "", true},
+			{"*", "anything", true},
+			{"foo", "foo", true},
+			{"foo", "fo", false},
+			{"f*o", "fo", true},
+			{"f*o", "fooo", true},
+			{"f*o", "foa", false},
+			{"h?llo", "hello", true},
+			{"h?llo", "hllo", false},
+			{"h[ae]llo", "hallo", true},
+			{"h[ae]llo", "hillo", false},
+			{"h[^e]llo", "hallo", true},
+			{"h[^e]llo", "hello", false},
+			{"h[a-c]llo", "hbllo", true},
+			{"h[a-c]llo", "hdllo", false},
+			{`h\*llo`, "h*llo", true},
+			{`h\*llo`, "hello", false},
+			{"news.*", "news.tech", true},
+			{"news.*", "sport.tech", false},
+			{"a**b", "axyzb", true},
+			{"*a*b", "xaybzb", true},
+			{"*a*b", "xaybz", false},
+			{"*[0-9]", "key:12", true},
+			{"*?", "", false},
+			{`a\`, `a\`, true},
+		}
+
+		for _, te := range tests {
+			if actual := globMatch(te.pattern, te.str); actual != te.expected {
+				t.Errorf("%q against %q: expected %v, got %v", te.pattern, te.str, te.expected, actual)
+			}
+		}
+	})
+
+	t.Run("match many stars without backtracking blowup", func(t *testing.T) {
+		str := strings.Repeat("a", 10000)
+		start := time.Now()
+
+		assertInterface(t, false, globMatch("*a*a*a*a*a*a*a*a*a*a*b", str))
+		assertInterface(t, true, globMatch("*a*a*a*a*a*a*a*a*a*a*", str))
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected linear matching, took %v", elapsed)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"sort"
+)
+
+type Hash struct {
+	fields map[string]string
+	order  scanOrder
+	bytes  int
+}
+
+func MakeHash() *Hash {
+	return &Hash{
+		make(map[string]string),
+		makeScanOrder(),
+		0,
+	}
+}
+
+type HashItem struct {
+	Field string
+	Value string
+}
+
+func (hash *Hash) Clone() *Hash {
+	clone := MakeHash()
+	for field, value := range hash.fields {
+		clone.fields[field] = value
+	}
+	clone.order = hash.order.clone()
+	clone.bytes = hash.bytes
+
+	return clone
+}
+
+func (hash *Hash) Set(field, value string) bool {
+	previous, ok := hash.fields[field]
+	if ok {
+		hash.bytes += len(value) - len(previous)
+	} else {
+		hash.bytes += len(field) + len(value)
+		hash.order.add(field)
+	}
+
+	hash.fields[field] = value
+
+	return !ok
+}
+
+func (hash *Hash) Get(field string) (string, bool) {
+	value, ok := hash.fields[field]
+	return value, ok
+}
+
+func (hash *Hash) Del(field string) bool {
+	if value, ok := hash.fields[field]; ok {
+		hash.bytes -= len(field) + len(value)
+		delete(hash.fields, field)
+		hash.order.remove(field)
+		return true
+	}
+
+	return false
+}
+
+func (hash *Hash) Len() int {
+	return len(hash.fields)
+}
+
+func (hash *Hash) Memory() int64 {
+	return int64(hash.bytes + len(hash.fields)*hashItemOverhead)
+}
+
+func (hash *Hash) Keys() []string {
+	keys := make([]string, 0, len(hash.fields))
+	for field := range hash.fields {
+		keys = append(keys, field)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (hash *Hash) Items() []HashItem {
+	keys := hash.Keys()
+
+	items := make([]HashItem, len(keys))
+	for index, field := range keys {
+		items[index] = HashItem{field, hash.fields[field]}
+	}
+
+	return items
+}
+
+func (hash *Hash) Scan(cursor uint64, count int, pattern string) ([]HashItem, uint64) {
+	fields, next := hash.order.scan(cursor, count, pattern)
+
+	items := make([]HashItem, len(fields))
+	for position, field := range fields {
+		items[position] = HashItem{field, hash.fields[field]}
+	}
+
+	return items, next
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestMakeHash(t *testing.T) {
+	t.Run("make empty hash", func(t *testing.T) {
+		assertInterface(t, &Hash{map[string]string{}, scanOrder{seqs: map[string]uint64{}}, 0}, MakeHash())
+	})
+}
+
+func TestHashSet(t *testing.T) {
+	hash := MakeHash()
+
+	t.Run("set new field", func(t *testing.T) {
+		if inserted := hash.Set("foo", "bar"); !inserted {
+			t.Errorf("expected return value to be true")
+		}
+	})
+
+	t.Run("set existing field", func(t *testing.T) {
+		if inserted := hash.Set("foo", "baz"); inserted {
+			t.Errorf("expected return value to be false")
+		}
+
+		value, _ := hash.Get("foo")
+		assertInterface(t, "baz", value)
+	})
+}
+
+func TestHashDel(t *testing.T) {
+	hash := MakeHash()
+	hash.Set("foo", "bar")
+
+	t.Run("delete existing and missing fields", func(t *testing.T) {
+		assertInterface(t, true, hash.Del("foo"))
+		assertInterface(t, false, hash.Del("foo"))
+		assertInterface(t, 0, hash.Len())
+	})
+}
+
+func TestHashItems(t *testing.T) {
+	hash := MakeHash()
+	hash.Set("b", "2")
+	hash.Set("a", "1")
+
+	t.Run("get sorted keys and items", func(t *testing.T) {
+		assertInterface(t, []string{"a", "b"}, hash.Keys())
+		assertInterface(t, []HashItem{{"a", "1"}, {"b", "2"}}, hash.Items())
+	})
+}
+
+func TestHashScan(t *testing.T) {
+	hash := MakeHash()
+	for x := 0; x < 100; x++ {
+		hash.Set("field:"+strconv.Itoa(x), strconv.Itoa(x))
+	}
+
+	t.Run("scan all fields with cursor", func(t *testing.T) {
+		fields := scanAllHashFields(hash, 7, "")
+		assertInterface(t, hash.Keys(), fields)
+	})
+
+	t.Run("scan fields matching pattern", func(t *testing.T) {
+		fields := scanAllHashFields(hash, 10, "field:1?")
+		assertInterface(t, []string{"field:10", "field:11", "field:12", "field:13", "field:14", "field:15", "field:16", "field:17", "field:18", "field:19"}, fields)
+	})
+
+	t.Run("scan returns fields present for the whole iteration despite deletions", func(t *testing.T) {
+		items, cursor := hash.Scan(0, 10, "")
+		seen := map[string]bool{}
+		for _, item := range items {
+			seen[item.Field] = true
+		}
+
+		for x := 0; x < 100; x += 3 {
+			field := "field:" + strconv.Itoa(x)
+			if !seen[field] {
+				hash.Del(field)
+			}
+		}
+
+		for cursor != 0 {
+			items, cursor = hash.Scan(cursor, 10, "")
+			for _, item := range items {
+				seen[item.Field] = true
+			}
+		}
+
+		for _, field := range hash.Keys() {
+			if !seen[field] {
+				t.Errorf("expected field %q to be returned", field)
+			}
+		}
+	})
+}
+
+func scanAllHashFields(hash *Hash, count int, pattern string) []string {
+	fields := make([]string, 0)
+
+	var cursor uint64
+	for {
+		var items []HashItem
+		items, cursor = hash.Scan(cursor, count, pattern)
+		for _, item := range items {
+			fields = append(fields, item.Field)
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	sort.Strings(fields)
+	return fields
+}
@@ -2,113 +2,553 @@ package main
 
 import (
 	"fmt"
-	"regexp"
+	"math"
+	"net"
 	"strconv"
+	"strings"
+	"time"
 )
 
-var simpleRegex, keyRegex, setRegex, setExRegex, zAddRegex, zRankRegex, zRangeRegex *regexp.Regexp
-
 func init() {
-	simpleRegex = regexp.MustCompile("^DBSIZE$")
-	keyRegex = regexp.MustCompile("^(?P<cmd>GET|DEL|INCR|ZCARD) (?P<key>[a-zA-Z0-9-_]+)$")
-	setRegex = regexp.MustCompile("^SET (?P<key>[a-zA-Z0-9-_]+) (?P<value>[a-zA-Z0-9-_]+)$")
-	setExRegex = regexp.MustCompile("^SET (?P<key>[a-zA-Z0-9-_]+) (?P<value>[a-zA-Z0-9-_]+) EX (?P<seconds>[0-9]+)$")
-	zAddRegex = regexp.MustCompile("^ZADD (?P<key>[a-zA-Z0-9-_]+) (?P<score>[0-9]+) (?P<member>[a-zA-Z0-9-_]+)$")
-	zRankRegex = regexp.MustCompile("^ZRANK (?P<key>[a-zA-Z0-9-_]+) (?P<member>[a-zA-Z0-9-_]+)$")
-	zRangeRegex = regexp.MustCompile("^ZRANGE (?P<key>[a-zA-Z0-9-_]+) (?P<start>[0-9]+) (?P<stop>[0-9]+)$")
+	registerCommands(
+		&Command{"PING", -1, CommandFast | CommandPubSub, Interpreter.handlePing},
+		&Command{"ECHO", 2, CommandFast, Interpreter.handleEcho},
+		&Command{"COMMAND", -1, 0, Interpreter.handleCommand},
+		&Command{"DBSIZE", 1, CommandReadOnly | CommandFast, Interpreter.handleDbSize},
+		&Command{"GET", 2, CommandReadOnly | CommandFast, Interpreter.handleGet},
+		&Command{"SET", -3, CommandWrite | CommandDenyOOM, Interpreter.handleSet},
+		&Command{"DEL", -2, CommandWrite, Interpreter.handleDel},
+		&Command{"INCR", 2, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleIncr},
+		&Command{"EXPIRE", -3, CommandWrite | CommandFast, expireHandler("expire", time.Second, false)},
+		&Command{"PEXPIRE", -3, CommandWrite | CommandFast, expireHandler("pexpire", time.Millisecond, false)},
+		&Command{"EXPIREAT", -3, CommandWrite | CommandFast, expireHandler("expireat", time.Second, true)},
+		&Command{"PEXPIREAT", -3, CommandWrite | CommandFast, expireHandler("pexpireat", time.Millisecond, true)},
+		&Command{"TTL", 2, CommandReadOnly | CommandFast, ttlHandler(time.Second, false)},
+		&Command{"PTTL", 2, CommandReadOnly | CommandFast, ttlHandler(time.Millisecond, false)},
+		&Command{"EXPIRETIME", 2, CommandReadOnly | CommandFast, ttlHandler(time.Second, true)},
+		&Command{"PEXPIRETIME", 2, CommandReadOnly | CommandFast, ttlHandler(time.Millisecond, true)},
+		&Command{"PERSIST", 2, CommandWrite | CommandFast, Interpreter.handlePersist},
+		&Command{"ZADD", -4, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleZAdd},
+		&Command{"ZCARD", 2, CommandReadOnly | CommandFast, Interpreter.handleZCard},
+		&Command{"ZRANK", 3, CommandReadOnly | CommandFast, Interpreter.handleZRank},
+		&Command{"ZREVRANK", 3, CommandReadOnly | CommandFast, Interpreter.handleZRevRank},
+		&Command{"ZSCORE", 3, CommandReadOnly | CommandFast, Interpreter.handleZScore},
+		&Command{"ZMSCORE", -3, CommandReadOnly | CommandFast, Interpreter.handleZMScore},
+		&Command{"ZINCRBY", 4, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleZIncrBy},
+		&Command{"ZREM", -3, CommandWrite | CommandFast, Interpreter.handleZRem},
+		&Command{"ZPOPMIN", -2, CommandWrite | CommandFast, Interpreter.handleZPopMin},
+		&Command{"ZPOPMAX", -2, CommandWrite | CommandFast, Interpreter.handleZPopMax},
+		&Command{"ZRANDMEMBER", -2, CommandReadOnly, Interpreter.handleZRandMember},
+		&Command{"ZRANGE", -4, CommandReadOnly, Interpreter.handleZRange},
+		&Command{"ZREVRANGE", -4, CommandReadOnly, Interpreter.handleZRevRange},
+		&Command{"ZRANGEBYSCORE", -4, CommandReadOnly, zRangeByScoreHandler(false)},
+		&Command{"ZREVRANGEBYSCORE", -4, CommandReadOnly, zRangeByScoreHandler(true)},
+		&Command{"ZCOUNT", 4, CommandReadOnly | CommandFast, Interpreter.handleZCount},
+		&Command{"ZREMRANGEBYSCORE", 4, CommandWrite, Interpreter.handleZRemRangeByScore},
+		&Command{"ZRANGEBYLEX", -4, CommandReadOnly, zRangeByLexHandler(false)},
+		&Command{"ZREVRANGEBYLEX", -4, CommandReadOnly, zRangeByLexHandler(true)},
+		&Command{"ZLEXCOUNT", 4, CommandReadOnly | CommandFast, Interpreter.handleZLexCount},
+		&Command{"HSET", -4, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleHSet},
+		&Command{"HMSET", -4, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleHMSet},
+		&Command{"HGET", 3, CommandReadOnly | CommandFast, Interpreter.handleHGet},
+		&Command{"HMGET", -3, CommandReadOnly | CommandFast, Interpreter.handleHMGet},
+		&Command{"HDEL", -3, CommandWrite | CommandFast, Interpreter.handleHDel},
+		&Command{"HGETALL", 2, CommandReadOnly, Interpreter.handleHGetAll},
+		&Command{"HINCRBY", 4, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleHIncrBy},
+		&Command{"HLEN", 2, CommandReadOnly | CommandFast, Interpreter.handleHLen},
+		&Command{"HEXISTS", 3, CommandReadOnly | CommandFast, Interpreter.handleHExists},
+		&Command{"HKEYS", 2, CommandReadOnly, Interpreter.handleHKeys},
+		&Command{"HVALS", 2, CommandReadOnly, Interpreter.handleHVals},
+		&Command{"HSCAN", -3, CommandReadOnly, Interpreter.handleHScan},
+		&Command{"LPUSH", -3, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleLPush},
+		&Command{"RPUSH", -3, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleRPush},
+		&Command{"LPOP", -2, CommandWrite | CommandFast, Interpreter.handleLPop},
+		&Command{"RPOP", -2, CommandWrite | CommandFast, Interpreter.handleRPop},
+		&Command{"LLEN", 2, CommandReadOnly | CommandFast, Interpreter.handleLLen},
+		&Command{"LRANGE", 4, CommandReadOnly, Interpreter.handleLRange},
+		&Command{"LINDEX", 3, CommandReadOnly, Interpreter.handleLIndex},
+		&Command{"LSET", 4, CommandWrite | CommandDenyOOM, Interpreter.handleLSet},
+		&Command{"LREM", 4, CommandWrite, Interpreter.handleLRem},
+		&Command{"LTRIM", 4, CommandWrite, Interpreter.handleLTrim},
+		&Command{"LINSERT", 5, CommandWrite | CommandDenyOOM, Interpreter.handleLInsert},
+		&Command{"LMOVE", 5, CommandWrite | CommandDenyOOM, Interpreter.handleLMove},
+		&Command{"RPOPLPUSH", 3, CommandWrite | CommandDenyOOM, Interpreter.handleRPopLPush},
+		&Command{"BLPOP", -3, CommandWrite | CommandBlocking, Interpreter.handleBLPop},
+		&Command{"BRPOP", -3, CommandWrite | CommandBlocking, Interpreter.handleBRPop},
+		&Command{"BLMOVE", 6, CommandWrite | CommandBlocking, Interpreter.handleBLMove},
+		&Command{"BRPOPLPUSH", 4, CommandWrite | CommandBlocking, Interpreter.handleBRPopLPush},
+		&Command{"SADD", -3, CommandWrite | CommandFast | CommandDenyOOM, Interpreter.handleSAdd},
+		&Command{"SREM", -3, CommandWrite | CommandFast, Interpreter.handleSRem},
+		&Command{"SISMEMBER", 3, CommandReadOnly | CommandFast, Interpreter.handleSIsMember},
+		&Command{"SMISMEMBER", -3, CommandReadOnly | CommandFast, Interpreter.handleSMIsMember},
+		&Command{"SMEMBERS", 2, CommandReadOnly, Interpreter.handleSMembers},
+		&Command{"SCARD", 2, CommandReadOnly | CommandFast, Interpreter.handleSCard},
+		&Command{"SPOP", -2, CommandWrite | CommandFast, Interpreter.handleSPop},
+		&Command{"SRANDMEMBER", -2, CommandReadOnly, Interpreter.handleSRandMember},
+		&Command{"SSCAN", -3, CommandReadOnly, Interpreter.handleSScan},
+		&Command{"SINTER", -2, CommandReadOnly, Interpreter.handleSInter},
+		&Command{"SUNION", -2, CommandReadOnly, Interpreter.handleSUnion},
+		&Command{"SDIFF", -2, CommandReadOnly, Interpreter.handleSDiff},
+		&Command{"SINTERSTORE", -3, CommandWrite | CommandDenyOOM, Interpreter.handleSInterStore},
+		&Command{"SUNIONSTORE", -3, CommandWrite | CommandDenyOOM, Interpreter.handleSUnionStore},
+		&Command{"SDIFFSTORE", -3, CommandWrite | CommandDenyOOM, Interpreter.handleSDiffStore},
+		&Command{"SMOVE", 4, CommandWrite | CommandFast, Interpreter.handleSMove},
+		&Command{"SUBSCRIBE", -2, CommandPubSub, Interpreter.handleSubscribe},
+		&Command{"PSUBSCRIBE", -2, CommandPubSub, Interpreter.handlePSubscribe},
+		&Command{"UNSUBSCRIBE", -1, CommandPubSub, Interpreter.handleUnsubscribe},
+		&Command{"PUNSUBSCRIBE", -1, CommandPubSub, Interpreter.handlePUnsubscribe},
+		&Command{"PUBLISH", 3, CommandFast, Interpreter.handlePublish},
+		&Command{"PUBSUB", -2, CommandReadOnly, Interpreter.handlePubSub},
+		&Command{"MULTI", 1, CommandTransaction | CommandFast, Interpreter.handleMulti},
+		&Command{"EXEC", 1, CommandTransaction, Interpreter.handleExec},
+		&Command{"DISCARD", 1, CommandTransaction | CommandFast, Interpreter.handleDiscard},
+		&Command{"WATCH", -2, CommandTransaction | CommandFast, Interpreter.handleWatch},
+		&Command{"UNWATCH", 1, CommandTransaction | CommandFast, Interpreter.handleUnwatch},
+		&Command{"SAVE", 1, CommandExclusive, Interpreter.handleSave},
+		&Command{"BGSAVE", 1, CommandExclusive, Interpreter.handleBgSave},
+		&Command{"LASTSAVE", 1, CommandFast, Interpreter.handleLastSave},
+		&Command{"BGREWRITEAOF", 1, CommandExclusive, Interpreter.handleBgRewriteAof},
+		&Command{"REPLICAOF", 3, CommandExclusive, Interpreter.handleReplicaOf},
+		&Command{"ROLE", 1, CommandFast, Interpreter.handleRole},
+	)
 }
 
 type Interpreter struct {
 	*Store
+	client *Client
+}
+
+func (intr Interpreter) WithClient(client *Client) Interpreter {
+	intr.client = client
+	return intr
 }
 
 func (intr Interpreter) Exec(cmd string) (interface{}, error) {
+	args, err := Tokenize(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 {
+		return errorReturn(cmd)
+	}
+
+	return intr.ExecArgs(args)
+}
+
+func (intr Interpreter) ExecArgs(args []string) (interface{}, error) {
+	txn := intr.client.Transaction()
+
+	command, ok := lookupCommand(args[0])
+	if !ok {
+		intr.failTransaction()
+		return errorReturn(args[0])
+	}
+
+	if err := command.CheckArity(len(args)); err != nil {
+		intr.failTransaction()
+		return nil, err
+	}
+
+	if intr.subscribed() && !command.HasFlag(CommandPubSub) {
+		return nil, fmt.Errorf("miniredis: Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(args[0]))
+	}
+
+	if command.HasFlag(CommandWrite) && intr.following() && !intr.client.Leader() {
+		intr.failTransaction()
+		return nil, ReadOnlyError{}
+	}
+
+	if txn.Active() && !command.HasFlag(CommandTransaction) {
+		txn.Queue(args)
+		return SimpleString("QUEUED"), nil
+	}
+
+	if command.HasFlag(CommandExclusive) {
+		defer intr.lockExclusive()()
+	} else if !command.HasFlag(CommandBlocking | CommandTransaction) {
+		defer intr.lockShared()()
+	}
+
+	if command.HasFlag(CommandWrite) && !command.HasFlag(CommandBlocking) {
+		defer intr.lockPropagation()()
+
+		if command.HasFlag(CommandDenyOOM) && !intr.client.Leader() {
+			if err := intr.freeMemory(); err != nil {
+				return nil, err
+			}
+		}
+
+		mark := intr.pendingMark()
+		value, err := command.Handler(intr, args[1:])
+		if err == nil {
+			intr.propagateAt(mark, intr.propagationRecords(command.Name, args[1:], value)...)
+		}
+
+		return value, err
+	}
+
+	return command.Handler(intr, args[1:])
+}
+
+func (intr Interpreter) propagationRecords(name string, args []string, value interface{}) [][]string {
+	switch name {
+	case "SET":
+		if len(args) > 2 {
+			return append([][]string{{"SET", args[0], args[1]}}, intr.expireRecords(args[0])...)
+		}
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		if value != 1 {
+			return nil
+		}
+
+		return intr.expireRecords(args[0])
+	case "PERSIST":
+		if value != 1 {
+			return nil
+		}
+	case "SPOP":
+		var members []string
+		switch typed := value.(type) {
+		case string:
+			members = []string{typed}
+		case []string:
+			members = typed
+		}
+
+		if len(members) == 0 {
+			return nil
+		}
+
+		return [][]string{append([]string{"SREM", args[0]}, members...)}
+	}
+
+	return [][]string{append([]string{name}, args...)}
+}
+
+func (intr Interpreter) expireRecords(key string) [][]string {
+	deadline, exists, volatile := intr.Deadline(key)
 	switch {
-	case simpleRegex.MatchString(cmd):
-		return intr.handleSimpleRegex(cmd)
-	case keyRegex.MatchString(cmd):
-		return intr.handleKeyRegex(cmd)
-	case setRegex.MatchString(cmd):
-		return intr.handleSetRegex(cmd)
-	case setExRegex.MatchString(cmd):
-		return intr.handleSetExRegex(cmd)
-	case zAddRegex.MatchString(cmd):
-		return intr.handleZAddRegex(cmd)
-	case zRankRegex.MatchString(cmd):
-		return intr.handleZRankRegex(cmd)
-	case zRangeRegex.MatchString(cmd):
-		return intr.handleZRangeRegex(cmd)
+	case !exists:
+		return [][]string{{"DEL", key}}
+	case volatile:
+		return [][]string{{"PEXPIREAT", key, strconv.FormatInt(deadline.UnixNano()/int64(time.Millisecond), 10)}}
+	}
+
+	return nil
+}
+
+func (intr Interpreter) Disconnect() {
+	if subscriber := intr.client.Subscriber(); subscriber != nil {
+		intr.UnsubscribeAll(subscriber)
 	}
 
-	return errorReturn(cmd)
+	if txn := intr.client.Transaction(); txn != nil {
+		intr.Unwatch(txn)
+	}
 }
 
-func (intr Interpreter) handleSimpleRegex(cmd string) (interface{}, error) {
-	switch cmd {
-	case "DBSIZE":
-		return intr.DbSize(), nil
+func (intr Interpreter) lockShared() UnlockCallback {
+	if intr.client.Transaction().Executing() {
+		return func() {}
 	}
 
-	return errorReturn(cmd)
+	intr.txnLock.RLock()
+	return intr.txnLock.RUnlock
 }
 
-func (intr Interpreter) handleKeyRegex(str string) (interface{}, error) {
-	values := scanVars(keyRegex, str, "cmd", "key")
-	cmd, key := values[0], values[1]
+func (intr Interpreter) lockExclusive() UnlockCallback {
+	if intr.client.Transaction().Executing() {
+		return func() {}
+	}
+
+	intr.txnLock.Lock()
+	return intr.txnLock.Unlock
+}
 
-	switch cmd {
-	case "GET":
-		if v, ok, err := intr.Get(key); err == nil {
-			if ok {
-				return v, nil
-			}
-		} else {
+func (intr Interpreter) lockPropagation() UnlockCallback {
+	if intr.client.Transaction().Executing() {
+		return func() {}
+	}
+
+	return intr.Store.lockPropagation()
+}
+
+func (intr Interpreter) failTransaction() {
+	if txn := intr.client.Transaction(); txn.Active() {
+		txn.Fail()
+	}
+}
+
+func (intr Interpreter) subscribed() bool {
+	subscriber := intr.client.Subscriber()
+	return subscriber != nil && subscriber.Subscriptions() > 0
+}
+
+func (intr Interpreter) handlePing(args []string) (interface{}, error) {
+	if intr.subscribed() && len(args) <= 1 {
+		return []interface{}{"pong", strings.Join(args, "")}, nil
+	}
+
+	switch len(args) {
+	case 0:
+		return "PONG", nil
+	case 1:
+		return args[0], nil
+	}
+
+	return nil, arityError("ping")
+}
+
+func (intr Interpreter) handleEcho(args []string) (interface{}, error) {
+	return args[0], nil
+}
+
+func (intr Interpreter) handleCommand(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return commandNames(), nil
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "COUNT":
+		return len(commandTable), nil
+	}
+
+	return nil, fmt.Errorf("miniredis: unknown subcommand %q", args[0])
+}
+
+func (intr Interpreter) handleDbSize(args []string) (interface{}, error) {
+	return intr.DbSize(), nil
+}
+
+func (intr Interpreter) handleGet(args []string) (interface{}, error) {
+	if v, ok, err := intr.Get(args[0]); err == nil {
+		if ok {
+			return v, nil
+		}
+	} else {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (intr Interpreter) handleSet(args []string) (interface{}, error) {
+	key, value := args[0], args[1]
+
+	switch {
+	case len(args) == 2:
+		return intr.Set(key, value)
+	case len(args) == 4:
+		var unit time.Duration
+		switch strings.ToUpper(args[2]) {
+		case "EX":
+			unit = time.Second
+		case "PX":
+			unit = time.Millisecond
+		default:
+			return nil, syntaxError()
+		}
+
+		amount, err := parseInt64(args[3])
+		if err != nil {
 			return nil, err
 		}
 
-		return nil, nil
-	case "DEL":
-		return intr.Del(key), nil
-	case "INCR":
-		return intr.Incr(key)
-	case "ZCARD":
-		return intr.ZCard(key)
+		deadline, ok := expireDeadline(amount, unit, false)
+		if amount <= 0 || !ok {
+			return nil, fmt.Errorf("miniredis: invalid expire time in 'set' command")
+		}
+
+		return intr.SetWithDeadline(key, value, deadline)
+	}
+
+	return nil, syntaxError()
+}
+
+func (intr Interpreter) handleDel(args []string) (interface{}, error) {
+	return intr.Del(args...), nil
+}
+
+func (intr Interpreter) handleIncr(args []string) (interface{}, error) {
+	return intr.Incr(args[0])
+}
+
+func expireHandler(name string, unit time.Duration, absolute bool) CommandHandler {
+	return func(intr Interpreter, args []string) (interface{}, error) {
+		amount, err := parseInt64(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		flags, err := parseExpireFlags(args[2:])
+		if err != nil {
+			return nil, err
+		}
+
+		deadline, ok := expireDeadline(amount, unit, absolute)
+		if !ok {
+			return nil, fmt.Errorf("miniredis: invalid expire time in '%s' command", name)
+		}
+
+		if intr.Expire(args[0], deadline, flags) {
+			return 1, nil
+		}
+
+		return 0, nil
+	}
+}
+
+func parseExpireFlags(args []string) (ExpireFlags, error) {
+	var flags ExpireFlags
+	for _, arg := range args {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			flags |= ExpireNX
+		case "XX":
+			flags |= ExpireXX
+		case "GT":
+			flags |= ExpireGT
+		case "LT":
+			flags |= ExpireLT
+		default:
+			return 0, fmt.Errorf("miniredis: unsupported option %s", arg)
+		}
+	}
+
+	if flags&ExpireNX != 0 && flags&(ExpireXX|ExpireGT|ExpireLT) != 0 {
+		return 0, fmt.Errorf("miniredis: NX and XX, GT or LT options at the same time are not compatible")
+	}
+
+	if flags&ExpireGT != 0 && flags&ExpireLT != 0 {
+		return 0, fmt.Errorf("miniredis: GT and LT options at the same time are not compatible")
+	}
+
+	return flags, nil
+}
+
+func expireDeadline(amount int64, unit time.Duration, absolute bool) (time.Time, bool) {
+	factor := int64(unit / time.Millisecond)
+	if amount > math.MaxInt64/factor || amount < math.MinInt64/factor {
+		return time.Time{}, false
+	}
+
+	millis := amount * factor
+	if !absolute {
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		if millis > math.MaxInt64-now {
+			return time.Time{}, false
+		}
+
+		millis += now
 	}
 
-	return errorReturn(cmd)
+	return time.Unix(millis/1000, (millis%1000)*int64(time.Millisecond)), true
 }
 
-func (intr Interpreter) handleSetRegex(str string) (interface{}, error) {
-	values := scanVars(setRegex, str, "key", "value")
-	key, value := values[0], values[1]
+func ttlHandler(unit time.Duration, absolute bool) CommandHandler {
+	return func(intr Interpreter, args []string) (interface{}, error) {
+		deadline, exists, volatile := intr.Deadline(args[0])
+
+		switch {
+		case !exists:
+			return -2, nil
+		case !volatile:
+			return -1, nil
+		case absolute && unit == time.Second:
+			return int(deadline.Unix()), nil
+		case absolute:
+			return int(deadline.Unix()*1000 + int64(deadline.Nanosecond())/int64(time.Millisecond)), nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining < 0 {
+			remaining = 0
+		}
 
-	return intr.Set(key, value)
+		return int((remaining + unit/2) / unit), nil
+	}
 }
 
-func (intr Interpreter) handleSetExRegex(str string) (interface{}, error) {
-	values := scanVars(setExRegex, str, "key", "value", "seconds")
-	key, value, secondsStr := values[0], values[1], values[2]
+func (intr Interpreter) handlePersist(args []string) (interface{}, error) {
+	if intr.Persist(args[0]) {
+		return 1, nil
+	}
 
-	seconds, _ := strconv.Atoi(secondsStr)
-	return intr.SetEx(key, value, seconds)
+	return 0, nil
 }
 
-func (intr Interpreter) handleZAddRegex(str string) (interface{}, error) {
-	values := scanVars(zAddRegex, str, "key", "score", "member")
-	key, scoreStr, member := values[0], values[1], values[2]
+func (intr Interpreter) handleZAdd(args []string) (interface{}, error) {
+	var flags ZAddFlags
+	incr, index := false, 1
+
+options:
+	for ; index < len(args); index++ {
+		switch strings.ToUpper(args[index]) {
+		case "NX":
+			flags |= ZAddNX
+		case "XX":
+			flags |= ZAddXX
+		case "GT":
+			flags |= ZAddGT
+		case "LT":
+			flags |= ZAddLT
+		case "CH":
+			flags |= ZAddCH
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+
+	pairs := args[index:]
+	switch {
+	case len(pairs) == 0 || len(pairs)%2 != 0:
+		return nil, syntaxError()
+	case flags&ZAddNX != 0 && flags&ZAddXX != 0:
+		return nil, fmt.Errorf("miniredis: XX and NX options at the same time are not compatible")
+	case flags&ZAddNX != 0 && flags&(ZAddGT|ZAddLT) != 0, flags&ZAddGT != 0 && flags&ZAddLT != 0:
+		return nil, fmt.Errorf("miniredis: GT, LT, and/or NX options at the same time are not compatible")
+	case incr && len(pairs) != 2:
+		return nil, fmt.Errorf("miniredis: INCR option supports a single increment-element pair")
+	}
+
+	items := make([]SortedSetItem, len(pairs)/2)
+	for index := range items {
+		score, err := parseScore(pairs[2*index])
+		if err != nil {
+			return nil, err
+		}
+
+		items[index] = SortedSetItem{score, pairs[2*index+1]}
+	}
+
+	if !incr {
+		return intr.ZAddWithFlags(args[0], flags, items...)
+	}
+
+	score, ok, err := intr.ZIncrBy(args[0], flags, items[0])
+	if err != nil || !ok {
+		return nil, err
+	}
 
-	score, _ := strconv.Atoi(scoreStr)
-	item := SortedSetItem{float64(score), member}
+	return formatFloat(score), nil
+}
 
-	return intr.ZAdd(key, item)
+func (intr Interpreter) handleZCard(args []string) (interface{}, error) {
+	return intr.ZCard(args[0])
 }
 
-func (intr Interpreter) handleZRankRegex(str string) (interface{}, error) {
-	values := scanVars(zRankRegex, str, "key", "member")
-	key, member := values[0], values[1]
+func (intr Interpreter) handleZRank(args []string) (interface{}, error) {
+	return rankReply(intr.ZRank(args[0], args[1]))
+}
 
-	index, ok, err := intr.ZRank(key, member)
+func (intr Interpreter) handleZRevRank(args []string) (interface{}, error) {
+	return rankReply(intr.ZRevRank(args[0], args[1]))
+}
 
+func rankReply(index int, ok bool, err error) (interface{}, error) {
 	switch {
 	case err != nil:
 		return nil, err
@@ -119,41 +559,1208 @@ func (intr Interpreter) handleZRankRegex(str string) (interface{}, error) {
 	}
 }
 
-func (intr Interpreter) handleZRangeRegex(str string) (interface{}, error) {
-	values := scanVars(zRangeRegex, str, "key", "start", "stop")
-	key, startStr, stopStr := values[0], values[1], values[2]
+func (intr Interpreter) handleZScore(args []string) (interface{}, error) {
+	score, ok, err := intr.ZScore(args[0], args[1])
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return formatFloat(score), nil
+}
 
-	start, _ := strconv.Atoi(startStr)
-	stop, _ := strconv.Atoi(stopStr)
+func (intr Interpreter) handleZMScore(args []string) (interface{}, error) {
+	scores, err := intr.ZMScore(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
 
-	if items, err := intr.ZRange(key, start, stop); err == nil {
-		members := make([]string, len(items))
-		for index, item := range items {
-			members[index] = item.Member
+	for index, score := range scores {
+		if score != nil {
+			scores[index] = formatFloat(score.(float64))
 		}
+	}
 
-		return members, nil
-	} else {
+	return scores, nil
+}
+
+func (intr Interpreter) handleZIncrBy(args []string) (interface{}, error) {
+	increment, err := parseScore(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	score, _, err := intr.ZIncrBy(args[0], 0, SortedSetItem{increment, args[2]})
+	if err != nil {
 		return nil, err
 	}
+
+	return formatFloat(score), nil
 }
 
-func scanVars(regex *regexp.Regexp, str string, keys ...string) []string {
-	groupNames := regex.SubexpNames()
-	matches := regex.FindStringSubmatch(str)
+func (intr Interpreter) handleZRem(args []string) (interface{}, error) {
+	return intr.ZRem(args[0], args[1:]...)
+}
 
-	values := make([]string, 0)
-	for index, value := range matches {
-		for _, key := range keys {
-			if groupNames[index] == key {
-				values = append(values, value)
-			}
+func (intr Interpreter) handleZPopMin(args []string) (interface{}, error) {
+	return intr.handleZPop(args, intr.ZPopMin)
+}
+
+func (intr Interpreter) handleZPopMax(args []string) (interface{}, error) {
+	return intr.handleZPop(args, intr.ZPopMax)
+}
+
+func (intr Interpreter) handleZPop(args []string, pop func(string, int) ([]SortedSetItem, error)) (interface{}, error) {
+	count := 1
+	switch len(args) {
+	case 1:
+	case 2:
+		var err error
+		if count, err = parseInt(args[1]); err != nil {
+			return nil, err
 		}
+
+		if count < 0 {
+			return nil, fmt.Errorf("miniredis: value is out of range, must be positive")
+		}
+	default:
+		return nil, syntaxError()
+	}
+
+	items, err := pop(args[0], count)
+	if err != nil {
+		return nil, err
 	}
 
-	return values
+	return sortedSetReply(items, true), nil
 }
 
-func errorReturn(cmd string) (interface{}, error) {
-	return nil, fmt.Errorf("miniredis: invalid command %q", cmd)
+func (intr Interpreter) handleZRandMember(args []string) (interface{}, error) {
+	if len(args) == 1 {
+		items, err := intr.ZRandMember(args[0], 1)
+		if err != nil || len(items) == 0 {
+			return nil, err
+		}
+
+		return items[0].Member, nil
+	}
+
+	withScores := len(args) == 3 && strings.ToUpper(args[2]) == "WITHSCORES"
+	if len(args) > 2 && !withScores {
+		return nil, syntaxError()
+	}
+
+	count, err := parseRandomCount(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := intr.ZRandMember(args[0], count)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedSetReply(items, withScores), nil
+}
+
+func (intr Interpreter) handleZRange(args []string) (interface{}, error) {
+	return intr.handleZRangeByIndex(args, intr.ZRange)
+}
+
+func (intr Interpreter) handleZRevRange(args []string) (interface{}, error) {
+	return intr.handleZRangeByIndex(args, intr.ZRevRange)
+}
+
+func (intr Interpreter) handleZRangeByIndex(args []string, slice func(string, int, int) ([]SortedSetItem, error)) (interface{}, error) {
+	withScores := len(args) == 4 && strings.ToUpper(args[3]) == "WITHSCORES"
+	if len(args) > 3 && !withScores {
+		return nil, syntaxError()
+	}
+
+	start, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := slice(args[0], start, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedSetReply(items, withScores), nil
+}
+
+func zRangeByScoreHandler(reverse bool) CommandHandler {
+	return func(intr Interpreter, args []string) (interface{}, error) {
+		min, max := args[1], args[2]
+		if reverse {
+			min, max = max, min
+		}
+
+		scoreRange, err := parseScoreRange(min, max)
+		if err != nil {
+			return nil, err
+		}
+
+		offset, count, withScores, err := parseRangeOptions(args[3:], true)
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := intr.ZRangeByScore(args[0], scoreRange, offset, count, reverse)
+		if err != nil {
+			return nil, err
+		}
+
+		return sortedSetReply(items, withScores), nil
+	}
+}
+
+func (intr Interpreter) handleZCount(args []string) (interface{}, error) {
+	scoreRange, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.ZCount(args[0], scoreRange)
+}
+
+func (intr Interpreter) handleZRemRangeByScore(args []string) (interface{}, error) {
+	scoreRange, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.ZRemRangeByScore(args[0], scoreRange)
+}
+
+func zRangeByLexHandler(reverse bool) CommandHandler {
+	return func(intr Interpreter, args []string) (interface{}, error) {
+		min, max := args[1], args[2]
+		if reverse {
+			min, max = max, min
+		}
+
+		lexRange, err := parseLexRange(min, max)
+		if err != nil {
+			return nil, err
+		}
+
+		offset, count, _, err := parseRangeOptions(args[3:], false)
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := intr.ZRangeByLex(args[0], lexRange, offset, count, reverse)
+		if err != nil {
+			return nil, err
+		}
+
+		return sortedSetReply(items, false), nil
+	}
+}
+
+func (intr Interpreter) handleZLexCount(args []string) (interface{}, error) {
+	lexRange, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.ZLexCount(args[0], lexRange)
+}
+
+func sortedSetReply(items []SortedSetItem, withScores bool) []string {
+	reply := make([]string, 0, len(items))
+	for _, item := range items {
+		reply = append(reply, item.Member)
+		if withScores {
+			reply = append(reply, formatFloat(item.Score))
+		}
+	}
+
+	return reply
+}
+
+func parseScoreRange(min, max string) (ScoreRange, error) {
+	minBound, err := parseScoreBound(min)
+	if err != nil {
+		return ScoreRange{}, err
+	}
+
+	maxBound, err := parseScoreBound(max)
+	if err != nil {
+		return ScoreRange{}, err
+	}
+
+	return ScoreRange{minBound, maxBound}, nil
+}
+
+func parseScoreBound(str string) (ScoreBound, error) {
+	exclusive := strings.HasPrefix(str, "(")
+	if exclusive {
+		str = str[1:]
+	}
+
+	score, err := parseScore(str)
+	if err != nil {
+		return ScoreBound{}, fmt.Errorf("miniredis: min or max is not a float")
+	}
+
+	return ScoreBound{score, exclusive}, nil
+}
+
+func parseLexRange(min, max string) (LexRange, error) {
+	minBound, err := parseLexBound(min)
+	if err != nil {
+		return LexRange{}, err
+	}
+
+	maxBound, err := parseLexBound(max)
+	if err != nil {
+		return LexRange{}, err
+	}
+
+	return LexRange{minBound, maxBound}, nil
+}
+
+func parseLexBound(str string) (LexBound, error) {
+	switch {
+	case str == "-":
+		return LexBound{Infinity: -1}, nil
+	case str == "+":
+		return LexBound{Infinity: 1}, nil
+	case strings.HasPrefix(str, "["):
+		return LexBound{Member: str[1:]}, nil
+	case strings.HasPrefix(str, "("):
+		return LexBound{Member: str[1:], Exclusive: true}, nil
+	}
+
+	return LexBound{}, fmt.Errorf("miniredis: min or max not valid string range item")
+}
+
+func parseRangeOptions(args []string, scores bool) (int, int, bool, error) {
+	offset, count, withScores := 0, -1, false
+	for index := 0; index < len(args); index++ {
+		switch strings.ToUpper(args[index]) {
+		case "WITHSCORES":
+			if !scores {
+				return 0, 0, false, syntaxError()
+			}
+
+			withScores = true
+		case "LIMIT":
+			if index+2 >= len(args) {
+				return 0, 0, false, syntaxError()
+			}
+
+			var err error
+			if offset, err = parseInt(args[index+1]); err != nil {
+				return 0, 0, false, err
+			}
+
+			if count, err = parseInt(args[index+2]); err != nil {
+				return 0, 0, false, err
+			}
+
+			index += 2
+		default:
+			return 0, 0, false, syntaxError()
+		}
+	}
+
+	return offset, count, withScores, nil
+}
+
+func (intr Interpreter) handleHSet(args []string) (interface{}, error) {
+	if len(args)%2 == 0 {
+		return nil, arityError("hset")
+	}
+
+	items := make([]HashItem, 0, len(args)/2)
+	for index := 1; index < len(args); index += 2 {
+		items = append(items, HashItem{args[index], args[index+1]})
+	}
+
+	return intr.HSet(args[0], items...)
+}
+
+func (intr Interpreter) handleHMSet(args []string) (interface{}, error) {
+	if len(args)%2 == 0 {
+		return nil, arityError("hmset")
+	}
+
+	if _, err := intr.handleHSet(args); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+func (intr Interpreter) handleHGet(args []string) (interface{}, error) {
+	value, ok, err := intr.HGet(args[0], args[1])
+
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return value, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (intr Interpreter) handleHMGet(args []string) (interface{}, error) {
+	return intr.HMGet(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleHDel(args []string) (interface{}, error) {
+	return intr.HDel(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleHGetAll(args []string) (interface{}, error) {
+	if items, err := intr.HGetAll(args[0]); err == nil {
+		return flattenHashItems(items), nil
+	} else {
+		return nil, err
+	}
+}
+
+func (intr Interpreter) handleHIncrBy(args []string) (interface{}, error) {
+	delta, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.HIncrBy(args[0], args[1], delta)
+}
+
+func (intr Interpreter) handleHLen(args []string) (interface{}, error) {
+	return intr.HLen(args[0])
+}
+
+func (intr Interpreter) handleHExists(args []string) (interface{}, error) {
+	ok, err := intr.HExists(args[0], args[1])
+
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func (intr Interpreter) handleHKeys(args []string) (interface{}, error) {
+	return intr.HKeys(args[0])
+}
+
+func (intr Interpreter) handleHVals(args []string) (interface{}, error) {
+	return intr.HVals(args[0])
+}
+
+func (intr Interpreter) handleHScan(args []string) (interface{}, error) {
+	cursor, count, pattern, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	items, next, err := intr.HScan(args[0], cursor, count, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{strconv.FormatUint(next, 10), flattenHashItems(items)}, nil
+}
+
+func flattenHashItems(items []HashItem) []string {
+	flat := make([]string, 0, len(items)*2)
+	for _, item := range items {
+		flat = append(flat, item.Field, item.Value)
+	}
+
+	return flat
+}
+
+func parseScanArgs(args []string) (uint64, int, string, error) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("miniredis: invalid cursor")
+	}
+
+	count, pattern := defaultScanCount, ""
+	for index := 1; index < len(args); index += 2 {
+		if index+1 >= len(args) {
+			return 0, 0, "", syntaxError()
+		}
+
+		switch strings.ToUpper(args[index]) {
+		case "MATCH":
+			pattern = args[index+1]
+		case "COUNT":
+			if count, err = parseInt(args[index+1]); err != nil {
+				return 0, 0, "", err
+			}
+
+			if count < 1 {
+				return 0, 0, "", syntaxError()
+			}
+		default:
+			return 0, 0, "", syntaxError()
+		}
+	}
+
+	return cursor, count, pattern, nil
+}
+
+func (intr Interpreter) handleLPush(args []string) (interface{}, error) {
+	return intr.LPush(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleRPush(args []string) (interface{}, error) {
+	return intr.RPush(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleLPop(args []string) (interface{}, error) {
+	return intr.handlePop(args, intr.LPop)
+}
+
+func (intr Interpreter) handleRPop(args []string) (interface{}, error) {
+	return intr.handlePop(args, intr.RPop)
+}
+
+func (intr Interpreter) handlePop(args []string, pop func(string, int) ([]string, error)) (interface{}, error) {
+	switch len(args) {
+	case 1:
+		values, err := pop(args[0], 1)
+		if err != nil || len(values) == 0 {
+			return nil, err
+		}
+
+		return values[0], nil
+	case 2:
+		count, err := parseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if count < 0 {
+			return nil, fmt.Errorf("miniredis: value is out of range, must be positive")
+		}
+
+		values, err := pop(args[0], count)
+		if err != nil || values == nil {
+			return nil, err
+		}
+
+		return values, nil
+	}
+
+	return nil, syntaxError()
+}
+
+func (intr Interpreter) handleLLen(args []string) (interface{}, error) {
+	return intr.LLen(args[0])
+}
+
+func (intr Interpreter) handleLRange(args []string) (interface{}, error) {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.LRange(args[0], start, stop)
+}
+
+func (intr Interpreter) handleLIndex(args []string) (interface{}, error) {
+	index, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok, err := intr.LIndex(args[0], index)
+
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return value, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (intr Interpreter) handleLSet(args []string) (interface{}, error) {
+	index, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := intr.LSet(args[0], index, args[2]); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+func (intr Interpreter) handleLRem(args []string) (interface{}, error) {
+	count, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.LRem(args[0], count, args[2])
+}
+
+func (intr Interpreter) handleLTrim(args []string) (interface{}, error) {
+	start, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := intr.LTrim(args[0], start, stop); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+func (intr Interpreter) handleLInsert(args []string) (interface{}, error) {
+	var before bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return nil, syntaxError()
+	}
+
+	return intr.LInsert(args[0], before, args[2], args[3])
+}
+
+func (intr Interpreter) handleLMove(args []string) (interface{}, error) {
+	from, err := parseListEnd(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := parseListEnd(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return listMoveReply(intr.LMove(args[0], args[1], from, to))
+}
+
+func (intr Interpreter) handleRPopLPush(args []string) (interface{}, error) {
+	return listMoveReply(intr.LMove(args[0], args[1], ListRight, ListLeft))
+}
+
+func (intr Interpreter) handleBLPop(args []string) (interface{}, error) {
+	return intr.handleBlockingPop(args, ListLeft)
+}
+
+func (intr Interpreter) handleBRPop(args []string) (interface{}, error) {
+	return intr.handleBlockingPop(args, ListRight)
+}
+
+func (intr Interpreter) handleBlockingPop(args []string, from ListEnd) (interface{}, error) {
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, unlockPropagation := intr.lockShared(), intr.lockPropagation()
+	key, value, ok, waiter, err := intr.bPop(args[:len(args)-1], from, !intr.client.Transaction().Executing())
+	unlockPropagation()
+	unlock()
+
+	if waiter != nil {
+		key, value, ok, err = intr.await(waiter, timeout, intr.client.Done())
+	}
+
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return []string{key, value}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (intr Interpreter) handleBLMove(args []string) (interface{}, error) {
+	from, err := parseListEnd(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := parseListEnd(args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseTimeout(args[4])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.blockingMove(args[0], args[1], from, to, timeout)
+}
+
+func (intr Interpreter) handleBRPopLPush(args []string) (interface{}, error) {
+	timeout, err := parseTimeout(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return intr.blockingMove(args[0], args[1], ListRight, ListLeft, timeout)
+}
+
+func (intr Interpreter) blockingMove(source, destination string, from, to ListEnd, timeout time.Duration) (interface{}, error) {
+	unlock, unlockPropagation := intr.lockShared(), intr.lockPropagation()
+	value, ok, waiter, err := intr.bLMove(source, destination, from, to, !intr.client.Transaction().Executing())
+	unlockPropagation()
+	unlock()
+
+	if waiter != nil {
+		_, value, ok, err = intr.await(waiter, timeout, intr.client.Done())
+	}
+
+	return listMoveReply(value, ok, err)
+}
+
+func parseTimeout(str string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, fmt.Errorf("miniredis: timeout is not a float or out of range")
+	}
+
+	if seconds < 0 {
+		return 0, fmt.Errorf("miniredis: timeout is negative")
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func listMoveReply(value string, ok bool, err error) (interface{}, error) {
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return value, nil
+	default:
+		return nil, nil
+	}
+}
+
+func parseListEnd(str string) (ListEnd, error) {
+	switch strings.ToUpper(str) {
+	case "LEFT":
+		return ListLeft, nil
+	case "RIGHT":
+		return ListRight, nil
+	}
+
+	return 0, syntaxError()
+}
+
+func (intr Interpreter) handleSAdd(args []string) (interface{}, error) {
+	return intr.SAdd(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleSRem(args []string) (interface{}, error) {
+	return intr.SRem(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleSIsMember(args []string) (interface{}, error) {
+	ok, err := intr.SIsMember(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return boolToInt(ok), nil
+}
+
+func (intr Interpreter) handleSMIsMember(args []string) (interface{}, error) {
+	found, err := intr.SMIsMember(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(found))
+	for index, ok := range found {
+		values[index] = boolToInt(ok)
+	}
+
+	return values, nil
+}
+
+func (intr Interpreter) handleSMembers(args []string) (interface{}, error) {
+	return intr.SMembers(args[0])
+}
+
+func (intr Interpreter) handleSCard(args []string) (interface{}, error) {
+	return intr.SCard(args[0])
+}
+
+func (intr Interpreter) handleSPop(args []string) (interface{}, error) {
+	switch len(args) {
+	case 1:
+		members, err := intr.SPop(args[0], 1)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+
+		return members[0], nil
+	case 2:
+		count, err := parseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if count < 0 {
+			return nil, fmt.Errorf("miniredis: value is out of range, must be positive")
+		}
+
+		members, err := intr.SPop(args[0], count)
+		if err != nil {
+			return nil, err
+		}
+
+		if members == nil {
+			return []string{}, nil
+		}
+
+		return members, nil
+	}
+
+	return nil, syntaxError()
+}
+
+func (intr Interpreter) handleSRandMember(args []string) (interface{}, error) {
+	switch len(args) {
+	case 1:
+		members, err := intr.SRandMember(args[0], 1)
+		if err != nil || len(members) == 0 {
+			return nil, err
+		}
+
+		return members[0], nil
+	case 2:
+		count, err := parseRandomCount(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		members, err := intr.SRandMember(args[0], count)
+		if err != nil {
+			return nil, err
+		}
+
+		if members == nil {
+			return []string{}, nil
+		}
+
+		return members, nil
+	}
+
+	return nil, syntaxError()
+}
+
+func (intr Interpreter) handleSScan(args []string) (interface{}, error) {
+	cursor, count, pattern, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	members, next, err := intr.SScan(args[0], cursor, count, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{strconv.FormatUint(next, 10), members}, nil
+}
+
+func (intr Interpreter) handleSInter(args []string) (interface{}, error) {
+	return intr.SInter(args...)
+}
+
+func (intr Interpreter) handleSUnion(args []string) (interface{}, error) {
+	return intr.SUnion(args...)
+}
+
+func (intr Interpreter) handleSDiff(args []string) (interface{}, error) {
+	return intr.SDiff(args...)
+}
+
+func (intr Interpreter) handleSInterStore(args []string) (interface{}, error) {
+	return intr.SInterStore(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleSUnionStore(args []string) (interface{}, error) {
+	return intr.SUnionStore(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleSDiffStore(args []string) (interface{}, error) {
+	return intr.SDiffStore(args[0], args[1:]...)
+}
+
+func (intr Interpreter) handleSMove(args []string) (interface{}, error) {
+	ok, err := intr.SMove(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return boolToInt(ok), nil
+}
+
+func (intr Interpreter) handleSubscribe(args []string) (interface{}, error) {
+	subscriber, err := intr.subscriber("subscribe")
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriptionReplies("subscribe", args, intr.Subscribe(subscriber, args...)), nil
+}
+
+func (intr Interpreter) handlePSubscribe(args []string) (interface{}, error) {
+	subscriber, err := intr.subscriber("psubscribe")
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriptionReplies("psubscribe", args, intr.PSubscribe(subscriber, args...)), nil
+}
+
+func (intr Interpreter) handleUnsubscribe(args []string) (interface{}, error) {
+	subscriber, err := intr.subscriber("unsubscribe")
+	if err != nil {
+		return nil, err
+	}
+
+	names, counts := intr.Unsubscribe(subscriber, args...)
+	return subscriptionReplies("unsubscribe", names, counts), nil
+}
+
+func (intr Interpreter) handlePUnsubscribe(args []string) (interface{}, error) {
+	subscriber, err := intr.subscriber("punsubscribe")
+	if err != nil {
+		return nil, err
+	}
+
+	names, counts := intr.PUnsubscribe(subscriber, args...)
+	return subscriptionReplies("punsubscribe", names, counts), nil
+}
+
+func (intr Interpreter) subscriber(name string) (*Subscriber, error) {
+	if subscriber := intr.client.Subscriber(); subscriber != nil {
+		return subscriber, nil
+	}
+
+	return nil, fmt.Errorf("miniredis: %s is not supported by this client", strings.ToUpper(name))
+}
+
+func subscriptionReplies(kind string, names []string, counts []int) MultiReply {
+	if len(names) == 0 {
+		return MultiReply{[]interface{}{kind, nil, 0}}
+	}
+
+	replies := make(MultiReply, len(names))
+	for index, name := range names {
+		replies[index] = []interface{}{kind, name, counts[index]}
+	}
+
+	return replies
+}
+
+func (intr Interpreter) handlePublish(args []string) (interface{}, error) {
+	return intr.Publish(args[0], args[1]), nil
+}
+
+func (intr Interpreter) handlePubSub(args []string) (interface{}, error) {
+	switch strings.ToUpper(args[0]) {
+	case "CHANNELS":
+		if len(args) > 2 {
+			return nil, arityError("pubsub|channels")
+		}
+
+		pattern := "*"
+		if len(args) == 2 {
+			pattern = args[1]
+		}
+
+		return intr.PubSubChannels(pattern), nil
+	case "NUMSUB":
+		counts := intr.PubSubNumSub(args[1:]...)
+
+		reply := make([]interface{}, 0, 2*len(counts))
+		for index, count := range counts {
+			reply = append(reply, args[index+1], count)
+		}
+
+		return reply, nil
+	case "NUMPAT":
+		if len(args) > 1 {
+			return nil, arityError("pubsub|numpat")
+		}
+
+		return intr.PubSubNumPat(), nil
+	}
+
+	return nil, fmt.Errorf("miniredis: unknown subcommand %q", args[0])
+}
+
+func (intr Interpreter) handleMulti(args []string) (interface{}, error) {
+	txn, err := intr.transaction("multi")
+	if err != nil {
+		return nil, err
+	}
+
+	if txn.Active() {
+		return nil, fmt.Errorf("miniredis: MULTI calls can not be nested")
+	}
+
+	txn.Begin()
+	return true, nil
+}
+
+func (intr Interpreter) handleExec(args []string) (interface{}, error) {
+	txn, err := intr.transaction("exec")
+	if err != nil {
+		return nil, err
+	}
+
+	if !txn.Active() {
+		return nil, fmt.Errorf("miniredis: EXEC without MULTI")
+	}
+
+	if txn.failed {
+		txn.reset()
+		intr.Unwatch(txn)
+		return nil, ExecAbortError{}
+	}
+
+	intr.txnLock.Lock()
+	defer intr.txnLock.Unlock()
+
+	intr.expireWatched(txn)
+	dirty := txn.Dirty()
+	intr.Unwatch(txn)
+
+	queued := txn.reset()
+	if dirty {
+		return NullArray{}, nil
+	}
+
+	defer intr.lockPropagation()()
+	mark := intr.pendingMark()
+
+	txn.executing = true
+	defer func() {
+		txn.executing = false
+	}()
+
+	replies := make([]interface{}, len(queued))
+	for index, args := range queued {
+		if value, err := intr.ExecArgs(args); err == nil {
+			replies[index] = value
+		} else {
+			replies[index] = err
+		}
+	}
+
+	if intr.pendingMark() > mark {
+		intr.propagateAt(mark, []string{"MULTI"})
+		intr.propagate("EXEC")
+	}
+
+	return replies, nil
+}
+
+func (intr Interpreter) handleDiscard(args []string) (interface{}, error) {
+	txn, err := intr.transaction("discard")
+	if err != nil {
+		return nil, err
+	}
+
+	if !txn.Active() {
+		return nil, fmt.Errorf("miniredis: DISCARD without MULTI")
+	}
+
+	txn.reset()
+	intr.Unwatch(txn)
+	return true, nil
+}
+
+func (intr Interpreter) handleWatch(args []string) (interface{}, error) {
+	txn, err := intr.transaction("watch")
+	if err != nil {
+		return nil, err
+	}
+
+	if txn.Active() {
+		return nil, fmt.Errorf("miniredis: WATCH inside MULTI is not allowed")
+	}
+
+	intr.Watch(txn, args...)
+	return true, nil
+}
+
+func (intr Interpreter) handleUnwatch(args []string) (interface{}, error) {
+	txn, err := intr.transaction("unwatch")
+	if err != nil {
+		return nil, err
+	}
+
+	intr.Unwatch(txn)
+	return true, nil
+}
+
+func (intr Interpreter) transaction(name string) (*Transaction, error) {
+	if txn := intr.client.Transaction(); txn != nil {
+		return txn, nil
+	}
+
+	return nil, fmt.Errorf("miniredis: %s is not supported by this client", strings.ToUpper(name))
+}
+
+func (intr Interpreter) handleSave(args []string) (interface{}, error) {
+	if err := intr.save(); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+func (intr Interpreter) handleBgSave(args []string) (interface{}, error) {
+	if err := intr.bgSave(); err != nil {
+		return nil, err
+	}
+
+	return SimpleString("Background saving started"), nil
+}
+
+func (intr Interpreter) handleLastSave(args []string) (interface{}, error) {
+	lastSave := intr.LastSave()
+	if lastSave.IsZero() {
+		return 0, nil
+	}
+
+	return lastSave.Unix(), nil
+}
+
+func (intr Interpreter) handleBgRewriteAof(args []string) (interface{}, error) {
+	if err := intr.bgRewriteAof(); err != nil {
+		return nil, err
+	}
+
+	return SimpleString("Background append only file rewriting started"), nil
+}
+
+func (intr Interpreter) handleReplicaOf(args []string) (interface{}, error) {
+	if strings.ToUpper(args[0]) == "NO" && strings.ToUpper(args[1]) == "ONE" {
+		intr.stopReplication()
+		return true, nil
+	}
+
+	if port, err := strconv.Atoi(args[1]); err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("miniredis: Invalid master port")
+	}
+
+	intr.replicaOf(net.JoinHostPort(args[0], args[1]))
+	return true, nil
+}
+
+func (intr Interpreter) handleRole(args []string) (interface{}, error) {
+	info := intr.Replication()
+	if info.Following {
+		host, port, _ := net.SplitHostPort(info.Leader)
+		num, _ := strconv.Atoi(port)
+
+		return []interface{}{"slave", host, num, info.LinkStatus, info.Offset}, nil
+	}
+
+	followers := make([]interface{}, 0, len(info.Followers))
+	for _, follower := range info.Followers {
+		host, port, _ := net.SplitHostPort(follower.Addr)
+		followers = append(followers, []string{host, port, strconv.FormatInt(follower.Offset, 10)})
+	}
+
+	return []interface{}{"master", info.Offset, followers}, nil
+}
+
+func boolToInt(ok bool) int {
+	if ok {
+		return 1
+	}
+
+	return 0
+}
+
+func parseInt(str string) (int, error) {
+	num, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("miniredis: value is not an integer or out of range")
+	}
+
+	return num, nil
+}
+
+func parseRandomCount(str string) (int, error) {
+	count, err := parseInt(str)
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(count) == math.MinInt64 {
+		return 0, fmt.Errorf("miniredis: value is out of range")
+	}
+
+	return count, nil
+}
+
+func parseScore(str string) (float64, error) {
+	num, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(num) {
+		return 0, fmt.Errorf("miniredis: value is not a valid float")
+	}
+
+	return num, nil
+}
+
+func parseInt64(str string) (int64, error) {
+	num, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("miniredis: value is not an integer or out of range")
+	}
+
+	return num, nil
+}
+
+func errorReturn(cmd string) (interface{}, error) {
+	return nil, fmt.Errorf("miniredis: invalid command %q", cmd)
+}
+
+func syntaxError() error {
+	return fmt.Errorf("miniredis: syntax error")
+}
+
+func arityError(name string) error {
+	return fmt.Errorf("miniredis: wrong number of arguments for %q command", name)
 }
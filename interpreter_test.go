@@ -2,12 +2,15 @@ package main
 
 import (
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestExec(t *testing.T) {
 	store := new(Store)
-	intr := Interpreter{store}
+	intr := Interpreter{Store: store}
 
 	t.Run("set key to store", func(t *testing.T) {
 		if actual, err := intr.Exec("SET foo bar"); err == nil {
@@ -115,4 +118,654 @@ func TestExec(t *testing.T) {
 			t.Errorf("expected error, but got nil")
 		}
 	})
+
+	t.Run("set and get keys and values with special characters", func(t *testing.T) {
+		intr.Exec(`SET user:42 "hello world"`)
+		if actual, err := intr.Exec("GET user:42"); err == nil {
+			if expected := "hello world"; actual != expected {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		} else {
+			t.Errorf("expected no error, but got %q", err)
+		}
+	})
+
+	t.Run("execute command with lowercase name", func(t *testing.T) {
+		if actual, err := intr.Exec("dbsize"); err == nil {
+			if expected := 3; actual != expected {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		} else {
+			t.Errorf("expected no error, but got %q", err)
+		}
+	})
+
+	t.Run("execute command with wrong number of arguments", func(t *testing.T) {
+		if _, err := intr.Exec("GET foo bar"); err == nil {
+			t.Errorf("expected error, but got nil")
+		}
+
+		if _, err := intr.Exec("SET foo"); err == nil {
+			t.Errorf("expected error, but got nil")
+		}
+	})
+
+	t.Run("execute command with invalid integer argument", func(t *testing.T) {
+		if _, err := intr.Exec("ZRANGE fizz zero 1"); err == nil {
+			t.Errorf("expected error, but got nil")
+		}
+	})
+
+	t.Run("execute command with unbalanced quotes", func(t *testing.T) {
+		if _, err := intr.Exec(`SET foo "bar`); err == nil {
+			t.Errorf("expected error, but got nil")
+		}
+	})
+
+	t.Run("set and get binary values with escapes", func(t *testing.T) {
+		intr.Exec(`SET "bin\x00key" "\x00\xff\r\n"`)
+		if actual, err := intr.ExecArgs([]string{"GET", "bin\x00key"}); err == nil {
+			if expected := "\x00\xff\r\n"; actual != expected {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+		} else {
+			t.Errorf("expected no error, but got %q", err)
+		}
+	})
+
+	t.Run("manage key expiration", func(t *testing.T) {
+		intr.Exec("SET session abc")
+
+		tests := []execTestAux{
+			{"TTL missing", 0, -2},
+			{"TTL session", 0, -1},
+			{"PEXPIRETIME session", 0, -1},
+			{"EXPIRE missing 10", 0, 0},
+			{"EXPIRE session 100 XX", 0, 0},
+			{"EXPIRE session 100 NX", 0, 1},
+			{"TTL session", 0, 100},
+			{"EXPIRE session 50 GT", 0, 0},
+			{"PEXPIRE session 50000 LT", 0, 1},
+			{"TTL session", 0, 50},
+			{"EXPIREAT session 4102444800", 0, 1},
+			{"EXPIRETIME session", 0, 4102444800},
+			{"PEXPIREAT session 4102444800123", 0, 1},
+			{"PEXPIRETIME session", 0, 4102444800123},
+			{"PERSIST session", 0, 1},
+			{"PERSIST session", 0, 0},
+			{"TTL session", 0, -1},
+			{"SET session abc PX 5000", 0, true},
+			{"PTTL session", 100, 5000},
+			{"EXPIRE session -1", 0, 1},
+			{"GET session", 0, nil},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+	})
+
+	t.Run("execute invalid expire commands", func(t *testing.T) {
+		intr.Exec("SET session abc")
+
+		cmds := []string{
+			"EXPIRE session ten",
+			"EXPIRE session 10 NX XX",
+			"EXPIRE session 10 GT LT",
+			"EXPIRE session 10 YY",
+			"EXPIRE session 9223372036854775807",
+			"SET session abc EX 0",
+			"SET session abc EY 10",
+		}
+
+		for _, cmd := range cmds {
+			if _, err := intr.Exec(cmd); err == nil {
+				t.Errorf("expected error for %q, but got nil", cmd)
+			}
+		}
+	})
+}
+
+func TestExecHash(t *testing.T) {
+	store := new(Store)
+	intr := Interpreter{Store: store}
+	intr.Exec("SET str value")
+
+	t.Run("manage hash fields", func(t *testing.T) {
+		tests := []execTestAux{
+			{"HSET user:1 name ann age 30", 0, 2},
+			{"HMSET user:1 city rio", 0, true},
+			{"HGET user:1 name", 0, "ann"},
+			{"HGET user:1 missing", 0, nil},
+			{"HMGET user:1 name missing", 0, []interface{}{"ann", nil}},
+			{"HINCRBY user:1 age 5", 0, 35},
+			{"HEXISTS user:1 age", 0, 1},
+			{"HEXISTS user:1 missing", 0, 0},
+			{"HLEN user:1", 0, 3},
+			{"HKEYS user:1", 0, []string{"age", "city", "name"}},
+			{"HVALS user:1", 0, []string{"35", "rio", "ann"}},
+			{"HGETALL user:1", 0, []string{"age", "35", "city", "rio", "name", "ann"}},
+			{"HSCAN user:1 0 MATCH n* COUNT 100", 0, []interface{}{"0", []string{"name", "ann"}}},
+			{"HDEL user:1 age city name", 0, 3},
+			{"HGETALL user:1", 0, []string{}},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+	})
+
+	t.Run("execute invalid hash commands", func(t *testing.T) {
+		cmds := []string{
+			"HSET user:1 name",
+			"HGET str name",
+			"HINCRBY user:1 age x",
+			"HSCAN user:1 x",
+			"HSCAN user:1 0 COUNT 0",
+			"HSCAN user:1 0 MATCH",
+		}
+
+		for _, cmd := range cmds {
+			if _, err := intr.Exec(cmd); err == nil {
+				t.Errorf("expected error for %q, but got nil", cmd)
+			}
+		}
+	})
+}
+
+func TestExecList(t *testing.T) {
+	store := new(Store)
+	intr := Interpreter{Store: store}
+	intr.Exec("SET str value")
+
+	t.Run("manage list values", func(t *testing.T) {
+		tests := []execTestAux{
+			{"RPUSH queue a b c", 0, 3},
+			{"LPUSH queue z", 0, 4},
+			{"LRANGE queue 0 -1", 0, []string{"z", "a", "b", "c"}},
+			{"LINDEX queue -1", 0, "c"},
+			{"LINDEX queue 10", 0, nil},
+			{"LSET queue 1 x", 0, true},
+			{"LINSERT queue BEFORE b y", 0, 5},
+			{"LINSERT queue AFTER missing y", 0, -1},
+			{"LREM queue 0 y", 0, 1},
+			{"LTRIM queue 0 2", 0, true},
+			{"LLEN queue", 0, 3},
+			{"LPOP queue", 0, "z"},
+			{"RPOP queue 5", 0, []string{"b", "x"}},
+			{"LPOP queue", 0, nil},
+			{"LPOP queue 2", 0, nil},
+			{"RPUSH src a b", 0, 2},
+			{"LMOVE src dst RIGHT LEFT", 0, "b"},
+			{"RPOPLPUSH src dst", 0, "a"},
+			{"LRANGE dst 0 -1", 0, []string{"a", "b"}},
+			{"LMOVE src dst LEFT LEFT", 0, nil},
+			{"BLPOP missing dst 0", 0, []string{"dst", "a"}},
+			{"BRPOP missing dst 0.01", 0, []string{"dst", "b"}},
+			{"BRPOP missing dst 0.01", 0, nil},
+			{"RPUSH src c", 0, 1},
+			{"BLMOVE src dst LEFT RIGHT 0", 0, "c"},
+			{"BRPOPLPUSH src dst 0.01", 0, nil},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+	})
+
+	t.Run("execute invalid list commands", func(t *testing.T) {
+		cmds := []string{
+			"LPUSH str a",
+			"LPOP dst -1",
+			"LSET dst 9 x",
+			"LINSERT dst AROUND a b",
+			"LMOVE dst src UP LEFT",
+			"LRANGE dst a b",
+			"BLPOP dst -1",
+			"BLPOP dst x",
+			"BLMOVE src dst LEFT UP 0",
+		}
+
+		for _, cmd := range cmds {
+			if _, err := intr.Exec(cmd); err == nil {
+				t.Errorf("expected error for %q, but got nil", cmd)
+			}
+		}
+	})
+}
+
+func TestExecSet(t *testing.T) {
+	store := new(Store)
+	intr := Interpreter{Store: store}
+	intr.Exec("SET str value")
+
+	t.Run("manage set members", func(t *testing.T) {
+		tests := []execTestAux{
+			{"SADD a 1 2 3", 0, 3},
+			{"SADD b 2 3 4", 0, 3},
+			{"SISMEMBER a 1", 0, 1},
+			{"SISMEMBER a 9", 0, 0},
+			{"SMISMEMBER a 1 9", 0, []interface{}{1, 0}},
+			{"SCARD a", 0, 3},
+			{"SMEMBERS a", 0, []string{"1", "2", "3"}},
+			{"SINTER a b", 0, []string{"2", "3"}},
+			{"SUNION a b", 0, []string{"1", "2", "3", "4"}},
+			{"SDIFF a b", 0, []string{"1"}},
+			{"SINTERSTORE c a b", 0, 2},
+			{"SUNIONSTORE d a b", 0, 4},
+			{"SDIFFSTORE e b a", 0, 1},
+			{"SMOVE e a 4", 0, 1},
+			{"SMOVE e a 4", 0, 0},
+			{"SREM a 4 9", 0, 1},
+			{"SRANDMEMBER missing", 0, nil},
+			{"SRANDMEMBER missing 3", 0, []string{}},
+			{"SRANDMEMBER missing -1000000000", 0, []string{}},
+			{"SRANDMEMBER c 5", 0, []string{"2", "3"}},
+			{"SPOP missing", 0, nil},
+			{"SSCAN a 0 MATCH 1", 0, []interface{}{"0", []string{"1"}}},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+	})
+
+	t.Run("execute invalid set commands", func(t *testing.T) {
+		cmds := []string{
+			"SADD str a",
+			"SINTER a str",
+			"SPOP a -1",
+			"SRANDMEMBER a -9223372036854775808",
+			"SMOVE a str 1",
+		}
+
+		for _, cmd := range cmds {
+			if _, err := intr.Exec(cmd); err == nil {
+				t.Errorf("expected error for %q, but got nil", cmd)
+			}
+		}
+	})
+}
+
+func TestExecSortedSet(t *testing.T) {
+	store := new(Store)
+	intr := Interpreter{Store: store}
+	intr.Exec("SET str value")
+
+	t.Run("manage sorted set members", func(t *testing.T) {
+		tests := []execTestAux{
+			{"ZADD z 0 b", 0, 1},
+			{"ZADD z 0 a", 0, 1},
+			{"ZADD z 0 d", 0, 1},
+			{"ZADD z 0 c", 0, 1},
+			{"ZRANGE z 0 3", 0, []string{"a", "b", "c", "d"}},
+			{"ZRANK z c", 0, 2},
+			{"ZRANGEBYLEX z - +", 0, []string{"a", "b", "c", "d"}},
+			{"ZRANGEBYLEX z [b (d", 0, []string{"b", "c"}},
+			{"ZRANGEBYLEX z - + LIMIT 1 2", 0, []string{"b", "c"}},
+			{"ZREVRANGEBYLEX z + [b", 0, []string{"d", "c", "b"}},
+			{"ZREVRANGEBYLEX z (d - LIMIT 0 1", 0, []string{"c"}},
+			{"ZRANGEBYLEX missing - +", 0, []string{}},
+			{"ZLEXCOUNT z [b +", 0, 3},
+			{"ZLEXCOUNT z (a (b", 0, 0},
+			{"ZLEXCOUNT missing - +", 0, 0},
+			{"ZADD scores 1.5 a -2 b 1e3 c +inf d", 0, 4},
+			{"ZADD scores -inf e", 0, 1},
+			{"ZRANGE scores 0 4", 0, []string{"e", "b", "a", "c", "d"}},
+			{"ZADD scores NX 0 a 0 f", 0, 1},
+			{"ZADD scores XX CH 0 a 0 g", 0, 1},
+			{"ZADD scores GT CH 1 a 1 f", 0, 2},
+			{"ZADD scores LT 5 a", 0, 0},
+			{"ZADD scores INCR 2.5 a", 0, "3.5"},
+			{"ZADD scores XX INCR 1 missing", 0, nil},
+			{"ZADD scores NX INCR 1 a", 0, nil},
+			{"ZRANK scores a", 0, 3},
+			{"ZRANGEBYSCORE scores -inf +inf", 0, []string{"e", "b", "f", "a", "c", "d"}},
+			{"ZRANGEBYSCORE scores (0 1 WITHSCORES", 0, []string{"f", "1"}},
+			{"ZRANGEBYSCORE scores -2 (inf LIMIT 1 3", 0, []string{"f", "a", "c"}},
+			{"ZRANGEBYSCORE scores -inf inf WITHSCORES LIMIT 4 -1", 0, []string{"c", "1000", "d", "inf"}},
+			{"ZREVRANGEBYSCORE scores +inf 1 WITHSCORES", 0, []string{"d", "inf", "c", "1000", "a", "3.5", "f", "1"}},
+			{"ZREVRANGEBYSCORE scores (3.5 -inf LIMIT 0 2", 0, []string{"f", "b"}},
+			{"ZRANGEBYSCORE missing -inf +inf", 0, []string{}},
+			{"ZCOUNT scores (-inf (inf", 0, 4},
+			{"ZCOUNT scores 2 1", 0, 0},
+			{"ZREMRANGEBYSCORE scores -inf (0", 0, 2},
+			{"ZREMRANGEBYSCORE scores 1 1", 0, 1},
+			{"ZRANGE scores 0 10", 0, []string{"a", "c", "d"}},
+			{"ZREMRANGEBYSCORE scores -inf +inf", 0, 3},
+			{"ZCARD scores", 0, 0},
+			{"ZADD ranks 1 a 2 b 3 c 4 d", 0, 4},
+			{"ZRANGE ranks 0 -1", 0, []string{"a", "b", "c", "d"}},
+			{"ZRANGE ranks -2 -1 WITHSCORES", 0, []string{"c", "3", "d", "4"}},
+			{"ZREVRANGE ranks 0 1", 0, []string{"d", "c"}},
+			{"ZREVRANGE ranks -1 10 WITHSCORES", 0, []string{"a", "1"}},
+			{"ZREVRANK ranks a", 0, 3},
+			{"ZREVRANK ranks missing", 0, nil},
+			{"ZSCORE ranks b", 0, "2"},
+			{"ZSCORE ranks missing", 0, nil},
+			{"ZSCORE missing b", 0, nil},
+			{"ZMSCORE ranks a missing d", 0, []interface{}{"1", nil, "4"}},
+			{"ZMSCORE missing a", 0, []interface{}{nil}},
+			{"ZINCRBY ranks 0.5 b", 0, "2.5"},
+			{"ZINCRBY ranks -inf e", 0, "-inf"},
+			{"ZREM ranks e missing", 0, 1},
+			{"ZPOPMIN ranks", 0, []string{"a", "1"}},
+			{"ZPOPMAX ranks 2", 0, []string{"d", "4", "c", "3"}},
+			{"ZRANDMEMBER ranks", 0, "b"},
+			{"ZRANDMEMBER ranks 3 WITHSCORES", 0, []string{"b", "2.5"}},
+			{"ZRANDMEMBER ranks -2", 0, []string{"b", "b"}},
+			{"ZRANDMEMBER missing", 0, nil},
+			{"ZRANDMEMBER missing 2", 0, []string{}},
+			{"ZRANDMEMBER missing -1000000000", 0, []string{}},
+			{"ZPOPMIN ranks 0", 0, []string{}},
+			{"ZREM ranks b", 0, 1},
+			{"ZCARD ranks", 0, 0},
+			{"ZPOPMAX ranks", 0, []string{}},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+	})
+
+	t.Run("execute invalid sorted set commands", func(t *testing.T) {
+		cmds := []string{
+			"ZADD str 1 a",
+			"ZRANGEBYLEX z a +",
+			"ZRANGEBYLEX z - + LIMIT 1",
+			"ZRANGEBYLEX z - + LIMIT x 1",
+			"ZRANGEBYLEX z - + OFFSET 0 1",
+			"ZREVRANGEBYLEX str + -",
+			"ZLEXCOUNT z - b",
+			"ZADD z 1",
+			"ZADD z NX",
+			"ZADD z x a",
+			"ZADD z nan a",
+			"ZADD z 1e400 a",
+			"ZADD z NX XX 1 a",
+			"ZADD z GT LT 1 a",
+			"ZADD z NX GT 1 a",
+			"ZADD z INCR 1 a 2 b",
+			"ZRANGEBYSCORE z a +inf",
+			"ZRANGEBYSCORE z ((1 +inf",
+			"ZRANGEBYSCORE z nan +inf",
+			"ZRANGEBYSCORE z 0 1 LIMIT 0",
+			"ZRANGEBYSCORE z 0 1 WITHSCORE",
+			"ZRANGEBYLEX z - + WITHSCORES",
+			"ZCOUNT z 0 x",
+			"ZREMRANGEBYSCORE str 0 1",
+			"ZRANGE z 0 -1 WITHSCORE",
+			"ZREVRANGE z 0 -1 WITHSCORES LIMIT",
+			"ZINCRBY z x a",
+			"ZPOPMIN z -1",
+			"ZPOPMAX z 1 2",
+			"ZRANDMEMBER z 1 SCORES",
+			"ZRANDMEMBER z -9223372036854775808",
+			"ZMSCORE str a",
+			"ZREM str a",
+		}
+
+		for _, cmd := range cmds {
+			if _, err := intr.Exec(cmd); err == nil {
+				t.Errorf("expected error for %q, but got nil", cmd)
+			}
+		}
+	})
+}
+
+func TestExecPubSub(t *testing.T) {
+	store := new(Store)
+	intr := Interpreter{Store: store}
+
+	subscriber := NewSubscriber(8)
+	subscriberIntr := intr.WithClient(NewSubscriberClient(nil, subscriber))
+
+	t.Run("subscribe and publish", func(t *testing.T) {
+		tests := []execTestAux{
+			{"PUBLISH news hello", 0, 0},
+			{"PUBSUB NUMPAT", 0, 0},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+
+		tests = []execTestAux{
+			{"SUBSCRIBE news sports", 0, MultiReply{[]interface{}{"subscribe", "news", 1}, []interface{}{"subscribe", "sports", 2}}},
+			{"PSUBSCRIBE s*", 0, MultiReply{[]interface{}{"psubscribe", "s*", 3}}},
+			{"PING", 0, []interface{}{"pong", ""}},
+		}
+
+		for _, te := range tests {
+			assertExec(t, subscriberIntr, te)
+		}
+
+		tests = []execTestAux{
+			{"PUBLISH sports goal", 0, 2},
+			{"PUBSUB CHANNELS", 0, []string{"news", "sports"}},
+			{"PUBSUB CHANNELS n*", 0, []string{"news"}},
+			{"PUBSUB NUMSUB news weather", 0, []interface{}{"news", 1, "weather", 0}},
+			{"PUBSUB NUMPAT", 0, 1},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+
+		assertInterface(t, []string{"message", "sports", "goal"}, receiveMessageTestAux(t, subscriber).Reply())
+		assertInterface(t, []string{"pmessage", "s*", "sports", "goal"}, receiveMessageTestAux(t, subscriber).Reply())
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		tests := []execTestAux{
+			{"UNSUBSCRIBE", 0, MultiReply{[]interface{}{"unsubscribe", "news", 2}, []interface{}{"unsubscribe", "sports", 1}}},
+			{"PUNSUBSCRIBE", 0, MultiReply{[]interface{}{"punsubscribe", "s*", 0}}},
+			{"PUNSUBSCRIBE", 0, MultiReply{[]interface{}{"punsubscribe", nil, 0}}},
+			{"PING", 0, "PONG"},
+			{"DBSIZE", 0, 0},
+		}
+
+		for _, te := range tests {
+			assertExec(t, subscriberIntr, te)
+		}
+	})
+
+	t.Run("execute invalid pub/sub commands", func(t *testing.T) {
+		subscriberIntr.Exec("SUBSCRIBE news")
+
+		tests := []struct {
+			intr Interpreter
+			cmd  string
+		}{
+			{intr, "SUBSCRIBE news"},
+			{intr, "PUBSUB UNKNOWN"},
+			{intr, "PUBSUB NUMPAT x"},
+			{subscriberIntr, "GET news"},
+		}
+
+		for _, te := range tests {
+			if _, err := te.intr.Exec(te.cmd); err == nil {
+				t.Errorf("expected error for %q, but got nil", te.cmd)
+			}
+		}
+	})
+}
+
+func TestExecTransaction(t *testing.T) {
+	store := new(Store)
+	intr := Interpreter{Store: store}.WithClient(NewClient(nil))
+	other := Interpreter{Store: store}.WithClient(NewClient(nil))
+
+	t.Run("queue and execute commands", func(t *testing.T) {
+		tests := []execTestAux{
+			{"MULTI", 0, true},
+			{"SET a 1", 0, SimpleString("QUEUED")},
+			{"INCR a", 0, SimpleString("QUEUED")},
+			{"HSET a f v", 0, SimpleString("QUEUED")},
+			{"BLPOP list 0", 0, SimpleString("QUEUED")},
+			{"GET a", 0, SimpleString("QUEUED")},
+			{"EXEC", 0, []interface{}{true, 2, WrongTypeError{"a", "hash"}, nil, "2"}},
+			{"MULTI", 0, true},
+			{"INCR a", 0, SimpleString("QUEUED")},
+			{"DISCARD", 0, true},
+			{"GET a", 0, "2"},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+	})
+
+	t.Run("abort transaction with queueing errors", func(t *testing.T) {
+		intr.Exec("MULTI")
+		intr.Exec("INCR a")
+
+		if _, err := intr.Exec("UNKNOWN"); err == nil {
+			t.Errorf("expected error for unknown command, but got nil")
+		}
+
+		if _, err := intr.Exec("EXEC"); err != (ExecAbortError{}) {
+			t.Errorf("expected exec abort error, got %v", err)
+		}
+
+		assertExec(t, intr, execTestAux{"GET a", 0, "2"})
+	})
+
+	t.Run("abort transaction when watched key changes", func(t *testing.T) {
+		tests := []execTestAux{
+			{"WATCH a b", 0, true},
+			{"MULTI", 0, true},
+			{"INCR a", 0, SimpleString("QUEUED")},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+
+		assertExec(t, other, execTestAux{"SET b 1", 0, true})
+		assertExec(t, intr, execTestAux{"EXEC", 0, NullArray{}})
+		assertExec(t, intr, execTestAux{"GET a", 0, "2"})
+
+		tests = []execTestAux{
+			{"WATCH a", 0, true},
+			{"GET a", 0, "2"},
+			{"MULTI", 0, true},
+			{"INCR a", 0, SimpleString("QUEUED")},
+			{"EXEC", 0, []interface{}{3}},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+	})
+
+	t.Run("abort transaction when watched key expires", func(t *testing.T) {
+		tests := []execTestAux{
+			{"SET c 1 PX 10", 0, true},
+			{"WATCH c", 0, true},
+			{"MULTI", 0, true},
+			{"SET d 1", 0, SimpleString("QUEUED")},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		assertExec(t, intr, execTestAux{"EXEC", 0, NullArray{}})
+		assertExec(t, intr, execTestAux{"GET d", 0, nil})
+	})
+
+	t.Run("unwatch keys", func(t *testing.T) {
+		tests := []execTestAux{
+			{"WATCH a", 0, true},
+			{"UNWATCH", 0, true},
+			{"MULTI", 0, true},
+			{"SET d 1", 0, SimpleString("QUEUED")},
+		}
+
+		for _, te := range tests {
+			assertExec(t, intr, te)
+		}
+
+		assertExec(t, other, execTestAux{"SET a 1", 0, true})
+		assertExec(t, intr, execTestAux{"EXEC", 0, []interface{}{true}})
+	})
+
+	t.Run("execute invalid transaction commands", func(t *testing.T) {
+		tests := []struct {
+			intr Interpreter
+			cmd  string
+		}{
+			{intr, "EXEC"},
+			{intr, "DISCARD"},
+			{Interpreter{Store: store}, "MULTI"},
+			{Interpreter{Store: store}, "WATCH a"},
+		}
+
+		for _, te := range tests {
+			if _, err := te.intr.Exec(te.cmd); err == nil {
+				t.Errorf("expected error for %q, but got nil", te.cmd)
+			}
+		}
+
+		assertExec(t, intr, execTestAux{"MULTI", 0, true})
+		for _, cmd := range []string{"MULTI", "WATCH a"} {
+			if _, err := intr.Exec(cmd); err == nil {
+				t.Errorf("expected error for %q inside MULTI, but got nil", cmd)
+			}
+		}
+		assertExec(t, intr, execTestAux{"EXEC", 0, []interface{}{}})
+	})
+}
+
+func TestExecTransactionConcurrency(t *testing.T) {
+	store := new(Store)
+	store.Set("counter", "0")
+
+	var wg sync.WaitGroup
+	for client := 0; client < 8; client++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			intr := Interpreter{Store: store}.WithClient(NewClient(nil))
+			for increments := 0; increments < 50; {
+				intr.Exec("WATCH counter")
+				value, _ := intr.Exec("GET counter")
+				num, _ := strconv.Atoi(value.(string))
+
+				intr.Exec("MULTI")
+				intr.ExecArgs([]string{"SET", "counter", strconv.Itoa(num + 1)})
+				if result, _ := intr.Exec("EXEC"); result != (NullArray{}) {
+					increments++
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	assertExec(t, Interpreter{Store: store}, execTestAux{"GET counter", 0, "400"})
+}
+
+type execTestAux struct {
+	cmd       string
+	tolerance int
+	expected  interface{}
+}
+
+func assertExec(t *testing.T, intr Interpreter, te execTestAux) {
+	actual, err := intr.Exec(te.cmd)
+	if err != nil {
+		t.Errorf("%s: expected no error, but got %q", te.cmd, err)
+		return
+	}
+
+	if num, ok := actual.(int); ok && te.tolerance > 0 {
+		if expected := te.expected.(int); num < expected-te.tolerance || num > expected {
+			t.Errorf("%s: expected %v (-%v), got %v", te.cmd, expected, te.tolerance, num)
+		}
+	} else if !reflect.DeepEqual(te.expected, actual) {
+		t.Errorf("%s: expected %v, got %v", te.cmd, te.expected, actual)
+	}
 }
@@ -0,0 +1,386 @@
+package main
+
+const listChunkSize = 128
+
+type List struct {
+	head, tail *listChunk
+	length     int
+	bytes      int
+}
+
+type listChunk struct {
+	items      []string
+	prev, next *listChunk
+}
+
+func MakeList() *List {
+	return &List{}
+}
+
+type ListEnd int
+
+const (
+	ListLeft ListEnd = iota
+	ListRight
+)
+
+func (list *List) Clone() *List {
+	clone := MakeList()
+	for chunk := list.head; chunk != nil; chunk = chunk.next {
+		clone.linkAfter(clone.tail, &listChunk{items: append(make([]string, 0, len(chunk.items)), chunk.items...)})
+	}
+
+	clone.length, clone.bytes = list.length, list.bytes
+	return clone
+}
+
+func (list *List) Len() int {
+	return list.length
+}
+
+func (list *List) Memory() int64 {
+	return int64(list.bytes + list.length*listItemOverhead)
+}
+
+func (list *List) Push(end ListEnd, values ...string) {
+	for _, value := range values {
+		if end == ListLeft {
+			list.pushFront(value)
+		} else {
+			list.pushBack(value)
+		}
+	}
+}
+
+func (list *List) pushFront(value string) {
+	if list.head == nil || len(list.head.items) >= listChunkSize {
+		list.linkBefore(list.head, &listChunk{items: make([]string, 0, 8)})
+	}
+
+	chunk := list.head
+	chunk.items = append(chunk.items, "")
+	copy(chunk.items[1:], chunk.items)
+	chunk.items[0] = value
+	list.length++
+	list.bytes += len(value)
+}
+
+func (list *List) pushBack(value string) {
+	if list.tail == nil || len(list.tail.items) >= listChunkSize {
+		list.linkAfter(list.tail, &listChunk{items: make([]string, 0, 8)})
+	}
+
+	list.tail.items = append(list.tail.items, value)
+	list.length++
+	list.bytes += len(value)
+}
+
+func (list *List) Pop(end ListEnd) (string, bool) {
+	if list.length == 0 {
+		return "", false
+	}
+
+	if end == ListLeft {
+		value := list.head.items[0]
+		list.removeAt(list.head, 0)
+		return value, true
+	}
+
+	offset := len(list.tail.items) - 1
+	value := list.tail.items[offset]
+	list.removeAt(list.tail, offset)
+	return value, true
+}
+
+func (list *List) Index(index int) (string, bool) {
+	if chunk, offset, ok := list.locate(index); ok {
+		return chunk.items[offset], true
+	}
+
+	return "", false
+}
+
+func (list *List) Set(index int, value string) bool {
+	if chunk, offset, ok := list.locate(index); ok {
+		list.bytes += len(value) - len(chunk.items[offset])
+		chunk.items[offset] = value
+		return true
+	}
+
+	return false
+}
+
+func (list *List) Slice(start, stop int) []string {
+	start, stop, ok := list.normalizeRange(start, stop)
+	if !ok {
+		return []string{}
+	}
+
+	values := make([]string, 0, stop-start+1)
+	chunk, offset, _ := list.locate(start)
+	for remaining := stop - start + 1; remaining > 0; chunk, offset = chunk.next, 0 {
+		end := offset + remaining
+		if end > len(chunk.items) {
+			end = len(chunk.items)
+		}
+
+		values = append(values, chunk.items[offset:end]...)
+		remaining -= end - offset
+	}
+
+	return values
+}
+
+func (list *List) Trim(start, stop int) {
+	start, stop, ok := list.normalizeRange(start, stop)
+	if !ok {
+		*list = List{}
+		return
+	}
+
+	list.dropFront(start)
+	list.dropBack(list.length - (stop - start + 1))
+}
+
+func (list *List) Remove(count int, value string) int {
+	removed := 0
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	if count >= 0 {
+		for chunk := list.head; chunk != nil && (limit == 0 || removed < limit); {
+			next := chunk.next
+			for offset := 0; offset < len(chunk.items) && (limit == 0 || removed < limit); {
+				if chunk.items[offset] == value {
+					list.removeAt(chunk, offset)
+					removed++
+				} else {
+					offset++
+				}
+			}
+			chunk = next
+		}
+	} else {
+		for chunk := list.tail; chunk != nil && removed < limit; {
+			prev := chunk.prev
+			for offset := len(chunk.items) - 1; offset >= 0 && removed < limit; offset-- {
+				if chunk.items[offset] == value {
+					list.removeAt(chunk, offset)
+					removed++
+				}
+			}
+			chunk = prev
+		}
+	}
+
+	if removed > 0 {
+		list.compact()
+	}
+
+	return removed
+}
+
+func (list *List) Insert(before bool, pivot, value string) bool {
+	for chunk := list.head; chunk != nil; chunk = chunk.next {
+		for offset, item := range chunk.items {
+			if item == pivot {
+				if !before {
+					offset++
+				}
+
+				list.insertAt(chunk, offset, value)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (list *List) normalizeRange(start, stop int) (int, int, bool) {
+	if start < 0 {
+		if start += list.length; start < 0 {
+			start = 0
+		}
+	}
+
+	if stop < 0 {
+		stop += list.length
+	}
+
+	if start > stop || start >= list.length {
+		return 0, 0, false
+	}
+
+	if stop >= list.length {
+		stop = list.length - 1
+	}
+
+	return start, stop, true
+}
+
+func (list *List) locate(index int) (*listChunk, int, bool) {
+	if index < 0 {
+		index += list.length
+	}
+
+	if index < 0 || index >= list.length {
+		return nil, 0, false
+	}
+
+	if index < list.length/2 {
+		for chunk := list.head; ; chunk = chunk.next {
+			if index < len(chunk.items) {
+				return chunk, index, true
+			}
+			index -= len(chunk.items)
+		}
+	}
+
+	index = list.length - 1 - index
+	for chunk := list.tail; ; chunk = chunk.prev {
+		if index < len(chunk.items) {
+			return chunk, len(chunk.items) - 1 - index, true
+		}
+		index -= len(chunk.items)
+	}
+}
+
+func (list *List) insertAt(chunk *listChunk, offset int, value string) {
+	if len(chunk.items) >= listChunkSize {
+		half := len(chunk.items) / 2
+		second := &listChunk{items: append(make([]string, 0, listChunkSize), chunk.items[half:]...)}
+		chunk.items = chunk.items[:half:half]
+		list.linkAfter(chunk, second)
+
+		if offset > half {
+			chunk, offset = second, offset-half
+		}
+	}
+
+	chunk.items = append(chunk.items, "")
+	copy(chunk.items[offset+1:], chunk.items[offset:])
+	chunk.items[offset] = value
+	list.length++
+	list.bytes += len(value)
+}
+
+func (list *List) removeAt(chunk *listChunk, offset int) {
+	list.bytes -= len(chunk.items[offset])
+	copy(chunk.items[offset:], chunk.items[offset+1:])
+	chunk.items[len(chunk.items)-1] = ""
+	chunk.items = chunk.items[:len(chunk.items)-1]
+	list.length--
+
+	if len(chunk.items) == 0 {
+		list.unlink(chunk)
+	}
+}
+
+func (list *List) compact() {
+	for chunk := list.head; chunk != nil && chunk.next != nil; {
+		if next := chunk.next; len(chunk.items)+len(next.items) <= listChunkSize/2 {
+			chunk.items = append(chunk.items, next.items...)
+			list.unlink(next)
+		} else {
+			chunk = next
+		}
+	}
+}
+
+func (list *List) dropFront(count int) {
+	for count > 0 {
+		chunk := list.head
+		if len(chunk.items) <= count {
+			count -= len(chunk.items)
+			list.length -= len(chunk.items)
+			list.bytes -= itemBytes(chunk.items)
+			list.unlink(chunk)
+			continue
+		}
+
+		list.bytes -= itemBytes(chunk.items[:count])
+		chunk.items = append(chunk.items[:0:0], chunk.items[count:]...)
+		list.length -= count
+		count = 0
+	}
+}
+
+func (list *List) dropBack(count int) {
+	for count > 0 {
+		chunk := list.tail
+		if len(chunk.items) <= count {
+			count -= len(chunk.items)
+			list.length -= len(chunk.items)
+			list.bytes -= itemBytes(chunk.items)
+			list.unlink(chunk)
+			continue
+		}
+
+		keep := len(chunk.items) - count
+		list.bytes -= itemBytes(chunk.items[keep:])
+		for offset := keep; offset < len(chunk.items); offset++ {
+			chunk.items[offset] = ""
+		}
+		chunk.items = chunk.items[:keep]
+		list.length -= count
+		count = 0
+	}
+}
+
+func (list *List) linkBefore(mark, chunk *listChunk) {
+	if mark == nil {
+		list.head, list.tail = chunk, chunk
+		return
+	}
+
+	chunk.prev, chunk.next = mark.prev, mark
+	if mark.prev != nil {
+		mark.prev.next = chunk
+	} else {
+		list.head = chunk
+	}
+	mark.prev = chunk
+}
+
+func (list *List) linkAfter(mark, chunk *listChunk) {
+	if mark == nil {
+		list.head, list.tail = chunk, chunk
+		return
+	}
+
+	chunk.prev, chunk.next = mark, mark.next
+	if mark.next != nil {
+		mark.next.prev = chunk
+	} else {
+		list.tail = chunk
+	}
+	mark.next = chunk
+}
+
+func (list *List) unlink(chunk *listChunk) {
+	if chunk.prev != nil {
+		chunk.prev.next = chunk.next
+	} else {
+		list.head = chunk.next
+	}
+
+	if chunk.next != nil {
+		chunk.next.prev = chunk.prev
+	} else {
+		list.tail = chunk.prev
+	}
+
+	chunk.prev, chunk.next = nil, nil
+}
+
+func itemBytes(items []string) int {
+	bytes := 0
+	for _, item := range items {
+		bytes += len(item)
+	}
+
+	return bytes
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func makeTestList(values ...string) *List {
+	list := MakeList()
+	list.Push(ListRight, values...)
+	return list
+}
+
+func TestListPush(t *testing.T) {
+	list := MakeList()
+
+	t.Run("push values to both ends", func(t *testing.T) {
+		list.Push(ListRight, "b", "c")
+		list.Push(ListLeft, "a", "z")
+
+		assertInterface(t, []string{"z", "a", "b", "c"}, list.Slice(0, -1))
+		assertInterface(t, 4, list.Len())
+	})
+}
+
+func TestListPop(t *testing.T) {
+	list := makeTestList("a", "b", "c")
+
+	t.Run("pop values from both ends", func(t *testing.T) {
+		value, _ := list.Pop(ListLeft)
+		assertInterface(t, "a", value)
+
+		value, _ = list.Pop(ListRight)
+		assertInterface(t, "c", value)
+	})
+
+	t.Run("pop from empty list", func(t *testing.T) {
+		list.Pop(ListLeft)
+		if _, ok := list.Pop(ListRight); ok {
+			t.Errorf("expected false, got true")
+		}
+	})
+}
+
+func TestListIndex(t *testing.T) {
+	list := makeTestList("a", "b", "c")
+
+	t.Run("get values at positive and negative indexes", func(t *testing.T) {
+		value, _ := list.Index(0)
+		assertInterface(t, "a", value)
+
+		value, _ = list.Index(-1)
+		assertInterface(t, "c", value)
+
+		if _, ok := list.Index(3); ok {
+			t.Errorf("expected false, got true")
+		}
+
+		if _, ok := list.Index(-4); ok {
+			t.Errorf("expected false, got true")
+		}
+	})
+
+	t.Run("set values at indexes", func(t *testing.T) {
+		assertInterface(t, true, list.Set(-2, "x"))
+		assertInterface(t, false, list.Set(5, "y"))
+		assertInterface(t, []string{"a", "x", "c"}, list.Slice(0, -1))
+	})
+}
+
+type listSliceTestAux struct {
+	start, stop int
+	expected    []string
+}
+
+func TestListSlice(t *testing.T) {
+	list := makeTestList("a", "b", "c", "d")
+
+	t.Run("test multiple ranges", func(t *testing.T) {
+		tests := []listSliceTestAux{
+			{0, -1, []string{"a", "b", "c", "d"}},
+			{-100, 100, []string{"a", "b", "c", "d"}},
+			{1, 2, []string{"b", "c"}},
+			{-2, -1, []string{"c", "d"}},
+			{2, 1, []string{}},
+			{4, 10, []string{}},
+			{0, -5, []string{}},
+		}
+
+		for _, te := range tests {
+			assertInterface(t, te.expected, list.Slice(te.start, te.stop))
+		}
+	})
+}
+
+func TestListTrim(t *testing.T) {
+	t.Run("trim to inner range", func(t *testing.T) {
+		list := makeTestList("a", "b", "c", "d")
+		list.Trim(1, -2)
+		assertInterface(t, []string{"b", "c"}, list.Slice(0, -1))
+	})
+
+	t.Run("trim to empty range", func(t *testing.T) {
+		list := makeTestList("a", "b")
+		list.Trim(5, 10)
+		assertInterface(t, 0, list.Len())
+	})
+}
+
+func TestListRemove(t *testing.T) {
+	t.Run("remove from head", func(t *testing.T) {
+		list := makeTestList("a", "x", "b", "x", "x")
+		assertInterface(t, 2, list.Remove(2, "x"))
+		assertInterface(t, []string{"a", "b", "x"}, list.Slice(0, -1))
+	})
+
+	t.Run("remove from tail", func(t *testing.T) {
+		list := makeTestList("x", "a", "x", "b", "x")
+		assertInterface(t, 2, list.Remove(-2, "x"))
+		assertInterface(t, []string{"x", "a", "b"}, list.Slice(0, -1))
+	})
+
+	t.Run("remove all", func(t *testing.T) {
+		list := makeTestList("x", "a", "x")
+		assertInterface(t, 2, list.Remove(0, "x"))
+		assertInterface(t, []string{"a"}, list.Slice(0, -1))
+	})
+}
+
+func TestListInsert(t *testing.T) {
+	list := makeTestList("a", "c")
+
+	t.Run("insert around pivot", func(t *testing.T) {
+		assertInterface(t, true, list.Insert(true, "c", "b"))
+		assertInterface(t, true, list.Insert(false, "c", "d"))
+		assertInterface(t, false, list.Insert(true, "z", "y"))
+		assertInterface(t, []string{"a", "b", "c", "d"}, list.Slice(0, -1))
+	})
+}
+
+func TestListAgainstSliceModel(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	list := MakeList()
+	model := make([]string, 0)
+
+	for step := 0; step < 20000; step++ {
+		value := strconv.Itoa(random.Intn(50))
+
+		switch random.Intn(8) {
+		case 0:
+			list.Push(ListLeft, value)
+			model = append([]string{value}, model...)
+		case 1, 2:
+			list.Push(ListRight, value)
+			model = append(model, value)
+		case 3:
+			if _, ok := list.Pop(ListLeft); ok {
+				model = model[1:]
+			}
+		case 4:
+			if _, ok := list.Pop(ListRight); ok {
+				model = model[:len(model)-1]
+			}
+		case 5:
+			if len(model) > 0 {
+				pivot := model[random.Intn(len(model))]
+				list.Insert(true, pivot, value)
+				for index, item := range model {
+					if item == pivot {
+						model = append(model[:index], append([]string{value}, model[index:]...)...)
+						break
+					}
+				}
+			}
+		case 6:
+			list.Remove(1, value)
+			for index, item := range model {
+				if item == value {
+					model = append(model[:index], model[index+1:]...)
+					break
+				}
+			}
+		case 7:
+			if len(model) > 0 {
+				index := random.Intn(len(model))
+				list.Set(index, value)
+				model[index] = value
+			}
+		}
+
+		if list.Len() != len(model) {
+			t.Fatalf("step %d: expected length %d, got %d", step, len(model), list.Len())
+		}
+	}
+
+	assertInterface(t, model, list.Slice(0, -1))
+
+	for index := range model {
+		if value, _ := list.Index(index); value != model[index] {
+			t.Fatalf("expected %q at %d, got %q", model[index], index, value)
+		}
+	}
+}
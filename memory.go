@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxMemorySamples = 5
+
+	entryOverhead         = 64
+	stringOverhead        = 16
+	intOverhead           = 8
+	listItemOverhead      = 16
+	hashItemOverhead      = 112
+	setItemOverhead       = 104
+	sortedSetItemOverhead = 128
+
+	lfuInitValue = 5
+	lfuLogFactor = 10
+	lfuDecayTime = time.Minute
+)
+
+type EvictionPolicy int32
+
+const (
+	NoEviction EvictionPolicy = iota
+	AllKeysLRU
+	VolatileLRU
+	AllKeysLFU
+	VolatileLFU
+	VolatileTTL
+	AllKeysRandom
+	VolatileRandom
+)
+
+var evictionPolicyNames = []string{
+	"noeviction",
+	"allkeys-lru",
+	"volatile-lru",
+	"allkeys-lfu",
+	"volatile-lfu",
+	"volatile-ttl",
+	"allkeys-random",
+	"volatile-random",
+}
+
+func ParseEvictionPolicy(str string) (EvictionPolicy, error) {
+	for index, name := range evictionPolicyNames {
+		if strings.EqualFold(str, name) {
+			return EvictionPolicy(index), nil
+		}
+	}
+
+	return 0, fmt.Errorf("miniredis: invalid maxmemory policy %q", str)
+}
+
+func (policy EvictionPolicy) String() string {
+	return evictionPolicyNames[policy]
+}
+
+func (policy EvictionPolicy) volatile() bool {
+	return policy == VolatileLRU || policy == VolatileLFU || policy == VolatileTTL || policy == VolatileRandom
+}
+
+func (policy EvictionPolicy) frequency() bool {
+	return policy == AllKeysLFU || policy == VolatileLFU
+}
+
+func ParseMemory(str string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000}, {"b", 1},
+	}
+
+	lower, multiplier := strings.ToLower(str), int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower, multiplier = strings.TrimSuffix(lower, unit.suffix), unit.multiplier
+			break
+		}
+	}
+
+	num, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || num < 0 || num > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("miniredis: invalid memory amount %q", str)
+	}
+
+	return num * multiplier, nil
+}
+
+type OutOfMemoryError struct{}
+
+func (err OutOfMemoryError) Error() string {
+	return "miniredis: command not allowed when used memory > 'maxmemory'."
+}
+
+type memoryState struct {
+	used    int64
+	limit   int64
+	policy  int32
+	samples int32
+	evicted int64
+}
+
+type MemoryInfo struct {
+	Used    int64
+	Limit   int64
+	Policy  EvictionPolicy
+	Samples int
+	Evicted int64
+}
+
+func (store *Store) SetMaxMemory(limit int64, policy EvictionPolicy, samples int) {
+	if samples <= 0 {
+		samples = defaultMaxMemorySamples
+	}
+
+	state := &store.memory
+	atomic.StoreInt32(&state.policy, int32(policy))
+	atomic.StoreInt32(&state.samples, int32(samples))
+	atomic.StoreInt64(&state.limit, limit)
+}
+
+func (store *Store) Memory() MemoryInfo {
+	state := &store.memory
+	return MemoryInfo{
+		Used:    atomic.LoadInt64(&state.used),
+		Limit:   atomic.LoadInt64(&state.limit),
+		Policy:  store.evictionPolicy(),
+		Samples: int(atomic.LoadInt32(&state.samples)),
+		Evicted: atomic.LoadInt64(&state.evicted),
+	}
+}
+
+func (store *Store) evictionPolicy() EvictionPolicy {
+	return EvictionPolicy(atomic.LoadInt32(&store.memory.policy))
+}
+
+func valueMemory(value Value) int64 {
+	switch typed := value.(type) {
+	case string:
+		return int64(stringOverhead + len(typed))
+	case int:
+		return intOverhead
+	case *List:
+		return typed.Memory()
+	case *Hash:
+		return typed.Memory()
+	case *Set:
+		return typed.Memory()
+	case *SortedSet:
+		return typed.Memory()
+	}
+
+	return 0
+}
+
+func (store *Store) account(key string) {
+	e, ok := store.lookup(key)
+	if !ok {
+		return
+	}
+
+	size := int64(entryOverhead+len(key)) + valueMemory(e.value)
+	atomic.AddInt64(&store.memory.used, size-e.size)
+	e.size = size
+}
+
+func (store *Store) unaccount(e *entry) {
+	atomic.AddInt64(&store.memory.used, -e.size)
+}
+
+func (store *Store) accessed(e *entry, now int64) {
+	atomic.StoreInt64(&e.access, now)
+
+	if store.evictionPolicy().frequency() {
+		counter := lfuIncrement(lfuCounter(atomic.LoadUint64(&e.frequency), now))
+		atomic.StoreUint64(&e.frequency, lfuPack(counter, now))
+	}
+}
+
+func lfuPack(counter uint64, now int64) uint64 {
+	return uint64(now/int64(lfuDecayTime))<<8 | counter
+}
+
+func lfuCounter(packed uint64, now int64) uint64 {
+	counter := packed & 0xff
+	if periods := uint64(now/int64(lfuDecayTime)) - packed>>8; periods < counter {
+		return counter - periods
+	}
+
+	return 0
+}
+
+func lfuIncrement(counter uint64) uint64 {
+	if counter == 255 {
+		return counter
+	}
+
+	base := 0.0
+	if counter > lfuInitValue {
+		base = float64(counter - lfuInitValue)
+	}
+
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+
+	return counter
+}
+
+func (store *Store) freeMemory() error {
+	state := &store.memory
+	limit := atomic.LoadInt64(&state.limit)
+	if limit <= 0 || atomic.LoadInt64(&state.used) <= limit {
+		return nil
+	}
+
+	policy := store.evictionPolicy()
+	if policy == NoEviction {
+		return OutOfMemoryError{}
+	}
+
+	for atomic.LoadInt64(&state.used) > limit {
+		key, ok := store.evictionCandidate(policy)
+		if !ok {
+			return OutOfMemoryError{}
+		}
+
+		store.evict(key)
+	}
+
+	return nil
+}
+
+func (store *Store) evictionCandidate(policy EvictionPolicy) (string, bool) {
+	samples := int(atomic.LoadInt32(&store.memory.samples))
+	if policy == AllKeysRandom || policy == VolatileRandom {
+		samples = 1
+	}
+
+	var keys []string
+	if policy.volatile() {
+		keys = store.sampleVolatileKeys(samples)
+	} else {
+		keys = store.sampleKeys(samples)
+	}
+
+	now := time.Now().UnixNano()
+	best, bestScore, found := "", 0.0, false
+	for _, key := range keys {
+		e, ok := store.peek(key)
+		if !ok {
+			continue
+		}
+
+		if score := evictionScore(e, policy, now); !found || score > bestScore {
+			best, bestScore, found = key, score, true
+		}
+	}
+
+	return best, found
+}
+
+func evictionScore(e *entry, policy EvictionPolicy, now int64) float64 {
+	switch policy {
+	case AllKeysLRU, VolatileLRU:
+		return float64(now - atomic.LoadInt64(&e.access))
+	case AllKeysLFU, VolatileLFU:
+		return float64(255 - lfuCounter(atomic.LoadUint64(&e.frequency), now))
+	case VolatileTTL:
+		return -float64(e.deadline)
+	}
+
+	return 0
+}
+
+func (store *Store) sampleKeys(count int) []string {
+	keys := make([]string, 0, count)
+	store.rangeShards(func(shard *storeShard) bool {
+		for key := range shard.entries {
+			if len(keys) == count {
+				break
+			}
+
+			keys = append(keys, key)
+		}
+
+		return len(keys) < count
+	})
+
+	return keys
+}
+
+func (store *Store) sampleVolatileKeys(count int) []string {
+	keys := make([]string, 0, count)
+	store.rangeShards(func(shard *storeShard) bool {
+		for taken := 0; taken < len(shard.expires) && len(keys) < count; taken++ {
+			keys = append(keys, shard.expires[rand.Intn(len(shard.expires))].key)
+		}
+
+		return len(keys) < count
+	})
+
+	return keys
+}
+
+func (store *Store) evict(key string) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	if e, ok := store.lookup(key); ok {
+		store.remove(key, e)
+		store.propagate("DEL", key)
+		atomic.AddInt64(&store.memory.evicted, 1)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func maxMemoryTestAux(keys int, policy EvictionPolicy) (*Store, Interpreter) {
+	store := new(Store)
+	store.SetMaxMemory(int64(keys)*entryMemoryTestAux("key:0", "value"), policy, 100)
+
+	return store, Interpreter{Store: store}.WithClient(NewClient(nil))
+}
+
+func entryMemoryTestAux(key, value string) int64 {
+	return int64(entryOverhead+len(key)) + valueMemory(value)
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	store := new(Store)
+	intr := Interpreter{Store: store}.WithClient(NewClient(nil))
+
+	t.Run("account strings", func(t *testing.T) {
+		intr.Exec("SET key value")
+		assertInterface(t, entryMemoryTestAux("key", "value"), store.Memory().Used)
+
+		intr.Exec("SET key longer-value")
+		assertInterface(t, entryMemoryTestAux("key", "longer-value"), store.Memory().Used)
+
+		intr.Exec("DEL key")
+		assertInterface(t, int64(0), store.Memory().Used)
+	})
+
+	t.Run("account modified collections", func(t *testing.T) {
+		cmds := []string{
+			"RPUSH list a b c d",
+			"LPUSH list z",
+			"LSET list 1 longer",
+			"LINSERT list BEFORE c x",
+			"LREM list 1 d",
+			"LTRIM list 1 -2",
+			"LPOP list",
+			"LMOVE list other LEFT RIGHT",
+			"HSET hash f v g w",
+			"HSET hash f longer",
+			"HINCRBY hash n 10",
+			"HDEL hash g",
+			"SADD set a b c",
+			"SREM set a",
+			"SPOP set",
+			"SUNIONSTORE union set missing",
+			"ZADD zset 1 a",
+			"ZADD zset 2 a",
+			"INCR counter",
+			"SET volatile value EX 100",
+		}
+
+		for _, cmd := range cmds {
+			if _, err := intr.Exec(cmd); err != nil {
+				t.Fatalf("%s: expected nil, got %q", cmd, err)
+			}
+		}
+
+		list, _ := store.loadList("list", false)
+		assertInterface(t, int64(len("x")+listItemOverhead), list.Memory())
+
+		hash, _ := store.loadHash("hash", false)
+		assertInterface(t, int64(len("flonger")+len("n10")+hashItemOverhead*2), hash.Memory())
+
+		if used := store.Memory().Used; used <= 0 {
+			t.Fatalf("expected used memory to be positive, got %d", used)
+		}
+
+		intr.Exec("DEL list other hash set union zset counter volatile")
+		assertInterface(t, 0, store.DbSize())
+		assertInterface(t, int64(0), store.Memory().Used)
+	})
+}
+
+func TestMaxMemory(t *testing.T) {
+	t.Run("reject writes with noeviction", func(t *testing.T) {
+		store, intr := maxMemoryTestAux(2, NoEviction)
+
+		for index := 0; index < 3; index++ {
+			if _, err := intr.Exec("SET key:" + strconv.Itoa(index) + " value"); err != nil {
+				t.Fatalf("expected nil, got %q", err)
+			}
+		}
+
+		_, err := intr.Exec("SET key:3 value")
+		assertInterface(t, OutOfMemoryError{}, err)
+		assertInterface(t, "OOM command not allowed when used memory > 'maxmemory'.", respErrorMessage(err))
+
+		assertExec(t, intr, execTestAux{"GET key:0", 0, "value"})
+		assertExec(t, intr, execTestAux{"EXPIRE key:0 100", 0, 1})
+		assertExec(t, intr, execTestAux{"DEL key:0", 0, 1})
+		assertExec(t, intr, execTestAux{"SET key:3 value", 0, true})
+		assertInterface(t, int64(0), store.Memory().Evicted)
+	})
+
+	t.Run("evict least recently used keys", func(t *testing.T) {
+		store, intr := maxMemoryTestAux(3, AllKeysLRU)
+
+		intr.Exec("SET key:0 value")
+		intr.Exec("SET key:1 value")
+		intr.Exec("SET key:2 value")
+		intr.Exec("GET key:0")
+		intr.Exec("SET key:3 value")
+		intr.Exec("SET key:4 value")
+
+		assertGet(t, store, "key:0", "value", true, false)
+		assertGet(t, store, "key:1", "", false, false)
+		assertGet(t, store, "key:2", "value", true, false)
+		assertInterface(t, int64(1), store.Memory().Evicted)
+	})
+
+	t.Run("evict least frequently used keys", func(t *testing.T) {
+		store, intr := maxMemoryTestAux(3, AllKeysLFU)
+
+		for index := 0; index < 4; index++ {
+			intr.Exec("SET key:" + strconv.Itoa(index) + " value")
+		}
+
+		for index := 0; index < 50; index++ {
+			intr.Exec("GET key:0")
+			intr.Exec("GET key:2")
+			intr.Exec("GET key:3")
+		}
+
+		intr.Exec("SET key:4 value")
+
+		assertGet(t, store, "key:1", "", false, false)
+		assertInterface(t, 4, store.DbSize())
+	})
+
+	t.Run("evict keys closest to expire", func(t *testing.T) {
+		store, intr := maxMemoryTestAux(3, VolatileTTL)
+
+		intr.Exec("SET key:0 value")
+		intr.Exec("SET key:1 value EX 100")
+		intr.Exec("SET key:2 value EX 10")
+		intr.Exec("SET key:3 value")
+		intr.Exec("SET key:4 value")
+
+		assertGet(t, store, "key:2", "", false, false)
+		assertGet(t, store, "key:1", "value", true, false)
+
+		intr.Exec("SET key:5 value")
+		assertGet(t, store, "key:1", "", false, false)
+
+		_, err := intr.Exec("SET key:6 value")
+		assertInterface(t, OutOfMemoryError{}, err)
+		assertInterface(t, 4, store.DbSize())
+	})
+
+	t.Run("evict random keys", func(t *testing.T) {
+		store, intr := maxMemoryTestAux(10, AllKeysRandom)
+
+		for index := 0; index < 100; index++ {
+			intr.Exec("SET key:" + strconv.Itoa(index) + " value")
+		}
+
+		info := store.Memory()
+		assertInterface(t, int64(100), int64(store.DbSize())+info.Evicted)
+		if info.Used > info.Limit+entryMemoryTestAux("key:99", "value") {
+			t.Errorf("expected used memory to stay close to %d, got %d", info.Limit, info.Used)
+		}
+	})
+
+	t.Run("evict only volatile keys", func(t *testing.T) {
+		for _, policy := range []EvictionPolicy{VolatileLRU, VolatileLFU, VolatileRandom} {
+			store, intr := maxMemoryTestAux(3, policy)
+
+			intr.Exec("SET key:0 value")
+			intr.Exec("SET key:1 value EX 100")
+			intr.Exec("SET key:2 value")
+			intr.Exec("SET key:3 value")
+			intr.Exec("SET key:4 value")
+
+			assertGet(t, store, "key:1", "", false, false)
+			assertGet(t, store, "key:0", "value", true, false)
+			assertGet(t, store, "key:2", "value", true, false)
+		}
+	})
+
+	t.Run("propagate evicted keys", func(t *testing.T) {
+		dir := snapshotTestDir(t)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "appendonly.aof")
+		store, intr := openAofTestAux(t, path)
+		store.SetMaxMemory(entryMemoryTestAux("key:0", "value"), AllKeysLRU, 5)
+
+		intr.Exec("SET key:0 value")
+		intr.Exec("SET key:1 value")
+		intr.Exec("SET key:2 value")
+		store.CloseAppendOnlyFile()
+
+		records := readAofTestAux(t, path)
+		assertInterface(t, [][]string{{"SET", "key:0", "value"}, {"SET", "key:1", "value"}, {"DEL", "key:0"}, {"SET", "key:2", "value"}}, records)
+	})
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	for _, name := range evictionPolicyNames {
+		policy, err := ParseEvictionPolicy(name)
+		assertInterface(t, nil, err)
+		assertInterface(t, name, policy.String())
+	}
+
+	if _, err := ParseEvictionPolicy("sometimes"); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	cases := map[string]int64{"0": 0, "100": 100, "1k": 1000, "1kb": 1024, "2MB": 2 << 20, "1g": 1000 * 1000 * 1000, "3gb": 3 << 30}
+	for str, expected := range cases {
+		bytes, err := ParseMemory(str)
+		assertInterface(t, nil, err)
+		assertInterface(t, expected, bytes)
+	}
+
+	for _, str := range []string{"", "mb", "-1", "1tb", "99999999999gb"} {
+		if _, err := ParseMemory(str); err == nil {
+			t.Errorf("%q: expected error, got nil", str)
+		}
+	}
+}
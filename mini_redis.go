@@ -2,66 +2,205 @@ package main
 
 import (
 	"bufio"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
+	appendOnly := flag.Bool("appendonly", false, "log every write command to "+defaultAppendOnlyPath)
+	appendFsync := flag.String("appendfsync", "everysec", "fsync policy of the append only file: always, everysec or no")
+	importRdb := flag.String("import-rdb", "", "import the keys of a Redis RDB file on startup")
+	replicaOf := flag.String("replicaof", "", "replicate the leader listening on host:port")
+	maxMemory := flag.String("maxmemory", "0", "memory limit for the dataset, e.g. 100mb; 0 disables the limit")
+	maxMemoryPolicy := flag.String("maxmemory-policy", "noeviction", "what to evict once maxmemory is reached: noeviction, allkeys-lru, volatile-lru, allkeys-lfu, volatile-lfu, volatile-ttl, allkeys-random or volatile-random")
+	maxMemorySamples := flag.Int("maxmemory-samples", defaultMaxMemorySamples, "number of keys sampled for each eviction")
+	flag.Parse()
+
 	store := new(Store)
+	if err := configureMaxMemory(store, *maxMemory, *maxMemoryPolicy, *maxMemorySamples); err != nil {
+		log.Fatal(err)
+	}
+
+	if *appendOnly {
+		policy, err := ParseFsyncPolicy(*appendFsync)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		store.SetSnapshotPath(defaultSnapshotPath)
+		if err := store.OpenAppendOnlyFile(defaultAppendOnlyPath, policy); err != nil {
+			log.Fatal(err)
+		}
+	} else if err := store.OpenSnapshot(defaultSnapshotPath); err != nil {
+		log.Fatal(err)
+	}
+
+	if *importRdb != "" {
+		if err := importRdbFile(store, *importRdb); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *replicaOf != "" {
+		store.ReplicaOf(*replicaOf)
+	}
 
 	go serveHttp(store)
+	go serveResp(store)
 	runShell(store)
 }
 
-const defaultHttpPort = "8080"
+func configureMaxMemory(store *Store, limit, policy string, samples int) error {
+	bytes, err := ParseMemory(limit)
+	if err != nil {
+		return err
+	}
+
+	evictionPolicy, err := ParseEvictionPolicy(policy)
+	if err != nil {
+		return err
+	}
+
+	store.SetMaxMemory(bytes, evictionPolicy, samples)
+	return nil
+}
+
+func importRdbFile(store *Store, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	count, err := store.ImportRdb(file)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d keys from %q", count, path)
+	return nil
+}
+
+const (
+	defaultHttpPort = "8080"
+	defaultRespPort = "6379"
+)
 
 func serveHttp(store *Store) {
-	handler := HttpHandler{Interpreter{store}}
+	handler := HttpHandler{Interpreter: Interpreter{Store: store}}
 
 	addr := fmt.Sprintf(":%s", defaultHttpPort)
 	err := http.ListenAndServe(addr, handler)
 	log.Fatal(err)
 }
 
+func serveResp(store *Store) {
+	server := RespServer{Interpreter{Store: store}}
+
+	addr := fmt.Sprintf(":%s", defaultRespPort)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Fatal(server.Serve(listener))
+}
+
 type HttpHandler struct {
 	Interpreter
+	HeartbeatInterval time.Duration
 }
 
 func (handler HttpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var serveErr error
+	if req.URL.Path == "/subscribe" {
+		handler.serveSubscribe(w, req)
+		return
+	}
+
+	status := http.StatusOK
+	value, err := handler.execRequest(req)
+	if err != nil {
+		status, value = http.StatusBadRequest, map[string]string{"error": err.Error()}
+	}
+
+	if err = respondJson(w, status, value); err != nil {
+		log.Printf("Got the following error while serving http request: %v", err)
+	}
+}
+
+func (handler HttpHandler) execRequest(req *http.Request) (interface{}, error) {
+	encoding := req.FormValue("encoding")
+	if encoding != "" && encoding != "base64" {
+		return nil, fmt.Errorf("Unsupported \"encoding\" query parameter %q", encoding)
+	}
 
-	if cmd := req.FormValue("cmd"); cmd == "" {
-		serveErr = respondJson(w, http.StatusBadRequest, map[string]string{
-			"error": "No valid \"cmd\" query parameter identified",
-		})
+	var value interface{}
+	var err error
+
+	intr := handler.WithClient(NewClient(req.Context().Done()))
+	defer intr.Disconnect()
+	if args := req.Form["arg"]; len(args) > 0 {
+		value, err = intr.ExecArgs(args)
+	} else if cmd := req.FormValue("cmd"); cmd != "" {
+		value, err = intr.Exec(cmd)
 	} else {
-		if value, err := handler.Exec(cmd); err == nil {
-			serveErr = respondJson(w, http.StatusOK, value)
-		} else {
-			serveErr = respondJson(w, http.StatusBadRequest, map[string]string{
-				"error": err.Error(),
-			})
-		}
+		return nil, errors.New("No valid \"cmd\" or \"arg\" query parameter identified")
+	}
+
+	if err == nil && encoding == "base64" {
+		value = encodeBase64(value)
 	}
 
-	if serveErr != nil {
-		log.Fatal("Got the following error while serving http request: ", serveErr)
+	return value, err
+}
+
+func encodeBase64(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case string:
+		return base64.StdEncoding.EncodeToString([]byte(typed))
+	case []string:
+		encoded := make([]string, len(typed))
+		for index, item := range typed {
+			encoded[index] = base64.StdEncoding.EncodeToString([]byte(item))
+		}
+		return encoded
+	case []interface{}:
+		encoded := make([]interface{}, len(typed))
+		for index, item := range typed {
+			encoded[index] = encodeBase64(item)
+		}
+		return encoded
 	}
+
+	return value
 }
 
 func respondJson(w http.ResponseWriter, status int, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 
-	return json.NewEncoder(w).Encode(data)
+	_, err = w.Write(append(body, '\n'))
+	return err
 }
 
 func runShell(store *Store) {
-	intr := Interpreter{store}
+	intr := Interpreter{Store: store}.WithClient(NewClient(nil))
 	fmt.Println("Type \"exit\" to leave")
 
 	scanner := bufio.NewReader(os.Stdin)
@@ -83,10 +222,33 @@ func runShell(store *Store) {
 			return
 		default:
 			if actual, err := intr.Exec(cmd); err == nil {
-				fmt.Printf("  %v\n", actual)
+				fmt.Printf("  %s\n", formatShellValue(actual))
 			} else {
 				fmt.Println("Command failed with the following error: ", err)
 			}
 		}
 	}
 }
+
+func formatShellValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "(nil)"
+	case string:
+		return strconv.Quote(typed)
+	case []string:
+		items := make([]string, len(typed))
+		for index, item := range typed {
+			items[index] = strconv.Quote(item)
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case []interface{}:
+		items := make([]string, len(typed))
+		for index, item := range typed {
+			items[index] = formatShellValue(item)
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveHttpTestAux(t *testing.T, handler HttpHandler, query url.Values) (int, interface{}) {
+	req := httptest.NewRequest("GET", "/?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var body interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+
+	return rec.Code, body
+}
+
+type httpTestAux struct {
+	args     []string
+	expected interface{}
+}
+
+func TestHttpHandler(t *testing.T) {
+	store := new(Store)
+	handler := HttpHandler{Interpreter: Interpreter{Store: store}}
+
+	t.Run("execute command from cmd parameter", func(t *testing.T) {
+		code, body := serveHttpTestAux(t, handler, url.Values{"cmd": {"INCR xyz"}})
+		assertInterface(t, http.StatusOK, code)
+		assertInterface(t, float64(1), body)
+	})
+
+	t.Run("execute command from arg parameters", func(t *testing.T) {
+		code, body := serveHttpTestAux(t, handler, url.Values{"arg": {"SET", "k\x00ey", "a b\x00\xff"}})
+		assertInterface(t, http.StatusOK, code)
+		assertInterface(t, true, body)
+	})
+
+	t.Run("get binary value encoded as base64", func(t *testing.T) {
+		code, body := serveHttpTestAux(t, handler, url.Values{"arg": {"GET", "k\x00ey"}, "encoding": {"base64"}})
+		assertInterface(t, http.StatusOK, code)
+		assertInterface(t, base64.StdEncoding.EncodeToString([]byte("a b\x00\xff")), body)
+	})
+
+	t.Run("execute request without command", func(t *testing.T) {
+		code, _ := serveHttpTestAux(t, handler, url.Values{})
+		assertInterface(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("reply with infinite scores", func(t *testing.T) {
+		code, body := serveHttpTestAux(t, handler, url.Values{"arg": {"ZADD", "zset", "+inf", "max", "-inf", "min"}})
+		assertInterface(t, http.StatusOK, code)
+		assertInterface(t, float64(2), body)
+
+		code, body = serveHttpTestAux(t, handler, url.Values{"cmd": {"ZADD zset INCR 1 max"}})
+		assertInterface(t, http.StatusOK, code)
+		assertInterface(t, "inf", body)
+
+		code, body = serveHttpTestAux(t, handler, url.Values{"cmd": {"ZRANGEBYSCORE zset -inf +inf WITHSCORES"}})
+		assertInterface(t, http.StatusOK, code)
+		assertInterface(t, []interface{}{"min", "-inf", "max", "inf"}, body)
+	})
+
+	t.Run("reply with infinite member scores", func(t *testing.T) {
+		tests := []httpTestAux{
+			{[]string{"ZSCORE", "zset", "max"}, "inf"},
+			{[]string{"ZMSCORE", "zset", "min", "missing", "max"}, []interface{}{"-inf", nil, "inf"}},
+			{[]string{"ZINCRBY", "zset", "-inf", "other"}, "-inf"},
+			{[]string{"ZINCRBY", "zset", "1.5", "min"}, "-inf"},
+			{[]string{"ZPOPMAX", "zset"}, []interface{}{"max", "inf"}},
+		}
+
+		for _, te := range tests {
+			code, body := serveHttpTestAux(t, handler, url.Values{"arg": te.args})
+			assertInterface(t, http.StatusOK, code)
+			assertInterface(t, te.expected, body)
+		}
+	})
+
+	t.Run("reply with error for values without json encoding", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		respondJson(rec, http.StatusOK, math.Inf(1))
+		assertInterface(t, http.StatusInternalServerError, rec.Code)
+
+		var body map[string]string
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["error"] == "" {
+			t.Errorf("expected error body, got %v (%v)", body, err)
+		}
+	})
+
+	t.Run("execute request with invalid encoding", func(t *testing.T) {
+		code, _ := serveHttpTestAux(t, handler, url.Values{"cmd": {"DBSIZE"}, "encoding": {"hex"}})
+		assertInterface(t, http.StatusBadRequest, code)
+	})
+}
+
+func readSseEventTestAux(t *testing.T, reader *bufio.Reader) []string {
+	lines := make([]string, 0)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+
+		if line = strings.TrimSuffix(line, "\n"); line == "" {
+			return lines
+		}
+
+		lines = append(lines, line)
+	}
+}
+
+func TestHttpHandlerSubscribe(t *testing.T) {
+	store := new(Store)
+	handler := HttpHandler{Interpreter{Store: store}, time.Hour}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	subscribe := func(server *httptest.Server, ctx context.Context, query url.Values) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", server.URL+"/subscribe?"+query.Encode(), nil)
+
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+
+		return res, bufio.NewReader(res.Body)
+	}
+
+	t.Run("stream published messages", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		res, reader := subscribe(server, ctx, url.Values{"channel": {"news"}, "pattern": {"s*"}, "encoding": {"base64"}})
+		defer res.Body.Close()
+
+		assertInterface(t, http.StatusOK, res.StatusCode)
+		assertInterface(t, "text/event-stream", res.Header.Get("Content-Type"))
+		assertInterface(t, []int{1}, store.PubSubNumSub("news"))
+
+		store.Publish("news", "line\nbreak")
+		assertInterface(t, []string{"event: message", `data: {"channel":"news","payload":"bGluZQpicmVhaw=="}`}, readSseEventTestAux(t, reader))
+
+		store.Publish("sports", "goal")
+		assertInterface(t, []string{"event: message", `data: {"pattern":"s*","channel":"sports","payload":"Z29hbA=="}`}, readSseEventTestAux(t, reader))
+
+		cancel()
+		for start := time.Now(); store.PubSubNumPat() != 0 || store.PubSubNumSub("news")[0] != 0; time.Sleep(time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("expected subscriptions to be released on disconnect")
+			}
+		}
+	})
+
+	t.Run("send heartbeat comments", func(t *testing.T) {
+		server := httptest.NewServer(HttpHandler{Interpreter{Store: store}, 10 * time.Millisecond})
+		defer server.Close()
+
+		res, reader := subscribe(server, context.Background(), url.Values{"channel": {"news"}})
+		defer res.Body.Close()
+
+		assertInterface(t, []string{": heartbeat"}, readSseEventTestAux(t, reader))
+		assertInterface(t, []string{": heartbeat"}, readSseEventTestAux(t, reader))
+	})
+
+	t.Run("subscribe without channels", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/subscribe")
+		if err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+		defer res.Body.Close()
+
+		assertInterface(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+type propagationState struct {
+	command sync.Mutex
+	pending [][]string
+}
+
+func (store *Store) propagating() bool {
+	return atomic.LoadInt32(&store.aof.enabled) != 0 || atomic.LoadInt32(&store.replication.backlogged) != 0
+}
+
+func (store *Store) lockPropagation() UnlockCallback {
+	if !store.propagating() {
+		return func() {}
+	}
+
+	state := &store.propagation
+	state.command.Lock()
+
+	return func() {
+		defer state.command.Unlock()
+
+		pending := state.pending
+		state.pending = nil
+
+		if len(pending) == 0 {
+			return
+		}
+
+		if err := store.appendRecords(pending); err != nil {
+			log.Printf("Got the following error while writing to the append only file: %v", err)
+		}
+
+		store.feedFollowers(pending)
+	}
+}
+
+func (store *Store) pendingMark() int {
+	return len(store.propagation.pending)
+}
+
+func (store *Store) propagate(args ...string) {
+	if store.propagating() {
+		store.propagation.pending = append(store.propagation.pending, args)
+	}
+}
+
+func (store *Store) propagateAt(mark int, records ...[]string) {
+	if !store.propagating() || len(records) == 0 {
+		return
+	}
+
+	state := &store.propagation
+	tail := append([][]string{}, state.pending[mark:]...)
+	state.pending = append(append(state.pending[:mark], records...), tail...)
+}
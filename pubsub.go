@@ -0,0 +1,245 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultSubscriberBuffer = 1024
+
+type pubSub struct {
+	mutex    sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+}
+
+type Message struct {
+	Pattern string
+	Channel string
+	Payload string
+	Matched bool
+}
+
+func (message Message) Reply() []string {
+	if message.Matched {
+		return []string{"pmessage", message.Pattern, message.Channel, message.Payload}
+	}
+
+	return []string{"message", message.Channel, message.Payload}
+}
+
+type Subscriber struct {
+	messages chan Message
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	count    int32
+
+	mutex   sync.Mutex
+	evicted chan struct{}
+	closed  bool
+}
+
+func NewSubscriber(limit int) *Subscriber {
+	return &Subscriber{
+		messages: make(chan Message, limit),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		evicted:  make(chan struct{}),
+	}
+}
+
+func (subscriber *Subscriber) Messages() <-chan Message {
+	return subscriber.messages
+}
+
+func (subscriber *Subscriber) Evicted() <-chan struct{} {
+	return subscriber.evicted
+}
+
+func (subscriber *Subscriber) deliver(message Message) bool {
+	select {
+	case subscriber.messages <- message:
+		return true
+	default:
+	}
+
+	subscriber.mutex.Lock()
+	defer subscriber.mutex.Unlock()
+
+	if !subscriber.closed {
+		subscriber.closed = true
+		close(subscriber.evicted)
+	}
+
+	return false
+}
+
+func (subscriber *Subscriber) Subscriptions() int {
+	return int(atomic.LoadInt32(&subscriber.count))
+}
+
+func (store *Store) Subscribe(subscriber *Subscriber, channels ...string) []int {
+	return store.subscribe(subscriber, false, channels)
+}
+
+func (store *Store) PSubscribe(subscriber *Subscriber, patterns ...string) []int {
+	return store.subscribe(subscriber, true, patterns)
+}
+
+func (store *Store) Unsubscribe(subscriber *Subscriber, channels ...string) ([]string, []int) {
+	return store.unsubscribe(subscriber, false, channels)
+}
+
+func (store *Store) PUnsubscribe(subscriber *Subscriber, patterns ...string) ([]string, []int) {
+	return store.unsubscribe(subscriber, true, patterns)
+}
+
+func (store *Store) UnsubscribeAll(subscriber *Subscriber) {
+	store.Unsubscribe(subscriber)
+	store.PUnsubscribe(subscriber)
+}
+
+func (store *Store) subscribe(subscriber *Subscriber, pattern bool, names []string) []int {
+	registry := &store.pubsub
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	index, own := registry.channels, subscriber.channels
+	if pattern {
+		index, own = registry.patterns, subscriber.patterns
+	}
+
+	if index == nil {
+		index = make(map[string]map[*Subscriber]struct{})
+		if pattern {
+			registry.patterns = index
+		} else {
+			registry.channels = index
+		}
+	}
+
+	counts := make([]int, len(names))
+	for position, name := range names {
+		if _, ok := own[name]; !ok {
+			own[name] = struct{}{}
+
+			if index[name] == nil {
+				index[name] = make(map[*Subscriber]struct{})
+			}
+			index[name][subscriber] = struct{}{}
+		}
+
+		counts[position] = len(subscriber.channels) + len(subscriber.patterns)
+	}
+
+	atomic.StoreInt32(&subscriber.count, int32(len(subscriber.channels)+len(subscriber.patterns)))
+	return counts
+}
+
+func (store *Store) unsubscribe(subscriber *Subscriber, pattern bool, names []string) ([]string, []int) {
+	registry := &store.pubsub
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	index, own := registry.channels, subscriber.channels
+	if pattern {
+		index, own = registry.patterns, subscriber.patterns
+	}
+
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	counts := make([]int, len(names))
+	for position, name := range names {
+		if _, ok := own[name]; ok {
+			delete(own, name)
+
+			delete(index[name], subscriber)
+			if len(index[name]) == 0 {
+				delete(index, name)
+			}
+		}
+
+		counts[position] = len(subscriber.channels) + len(subscriber.patterns)
+	}
+
+	atomic.StoreInt32(&subscriber.count, int32(len(subscriber.channels)+len(subscriber.patterns)))
+	return names, counts
+}
+
+func (store *Store) Publish(channel, payload string) int {
+	registry := &store.pubsub
+	registry.mutex.RLock()
+
+	received := 0
+	var evicted []*Subscriber
+
+	for subscriber := range registry.channels[channel] {
+		if subscriber.deliver(Message{Channel: channel, Payload: payload}) {
+			received++
+		} else {
+			evicted = append(evicted, subscriber)
+		}
+	}
+
+	for pattern, subscribers := range registry.patterns {
+		if !globMatch(pattern, channel) {
+			continue
+		}
+
+		for subscriber := range subscribers {
+			if subscriber.deliver(Message{pattern, channel, payload, true}) {
+				received++
+			} else {
+				evicted = append(evicted, subscriber)
+			}
+		}
+	}
+
+	registry.mutex.RUnlock()
+
+	for _, subscriber := range evicted {
+		store.UnsubscribeAll(subscriber)
+	}
+
+	return received
+}
+
+func (store *Store) PubSubChannels(pattern string) []string {
+	store.pubsub.mutex.RLock()
+	defer store.pubsub.mutex.RUnlock()
+
+	channels := make([]string, 0)
+	for channel := range store.pubsub.channels {
+		if globMatch(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+
+	sort.Strings(channels)
+	return channels
+}
+
+func (store *Store) PubSubNumSub(channels ...string) []int {
+	store.pubsub.mutex.RLock()
+	defer store.pubsub.mutex.RUnlock()
+
+	counts := make([]int, len(channels))
+	for index, channel := range channels {
+		counts[index] = len(store.pubsub.channels[channel])
+	}
+
+	return counts
+}
+
+func (store *Store) PubSubNumPat() int {
+	store.pubsub.mutex.RLock()
+	defer store.pubsub.mutex.RUnlock()
+
+	return len(store.pubsub.patterns)
+}
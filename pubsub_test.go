@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func receiveMessageTestAux(t *testing.T, subscriber *Subscriber) Message {
+	select {
+	case message := <-subscriber.Messages():
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected message to be delivered")
+	}
+
+	return Message{}
+}
+
+func TestPubSub(t *testing.T) {
+	store := new(Store)
+	first, second := NewSubscriber(8), NewSubscriber(8)
+
+	t.Run("subscribe to channels and patterns", func(t *testing.T) {
+		assertInterface(t, []int{1, 2, 2}, store.Subscribe(first, "news", "sports", "news"))
+		assertInterface(t, []int{3}, store.PSubscribe(first, "n*"))
+		assertInterface(t, []int{1}, store.PSubscribe(second, "n?ws"))
+		assertInterface(t, 3, first.Subscriptions())
+	})
+
+	t.Run("publish to subscribers", func(t *testing.T) {
+		assertInterface(t, 3, store.Publish("news", "hello"))
+		assertInterface(t, Message{Channel: "news", Payload: "hello"}, receiveMessageTestAux(t, first))
+		assertInterface(t, Message{"n*", "news", "hello", true}, receiveMessageTestAux(t, first))
+		assertInterface(t, Message{"n?ws", "news", "hello", true}, receiveMessageTestAux(t, second))
+
+		assertInterface(t, 0, store.Publish("weather", "sunny"))
+	})
+
+	t.Run("introspect subscriptions", func(t *testing.T) {
+		assertInterface(t, []string{"news", "sports"}, store.PubSubChannels("*"))
+		assertInterface(t, []string{"sports"}, store.PubSubChannels("s*"))
+		assertInterface(t, []int{1, 0}, store.PubSubNumSub("news", "weather"))
+		assertInterface(t, 2, store.PubSubNumPat())
+	})
+
+	t.Run("unsubscribe from channels and patterns", func(t *testing.T) {
+		names, counts := store.Unsubscribe(first, "news", "weather")
+		assertInterface(t, []string{"news", "weather"}, names)
+		assertInterface(t, []int{2, 2}, counts)
+
+		names, counts = store.Unsubscribe(first)
+		assertInterface(t, []string{"sports"}, names)
+		assertInterface(t, []int{1}, counts)
+
+		store.UnsubscribeAll(first)
+		store.UnsubscribeAll(second)
+
+		assertInterface(t, 0, first.Subscriptions())
+		assertInterface(t, []string{}, store.PubSubChannels("*"))
+		assertInterface(t, 0, store.PubSubNumPat())
+		assertInterface(t, 0, store.Publish("news", "hello"))
+	})
+
+	t.Run("evict slow subscribers", func(t *testing.T) {
+		slow := NewSubscriber(2)
+		store.Subscribe(slow, "news")
+		store.Subscribe(first, "news")
+
+		for index := 0; index < 2; index++ {
+			assertInterface(t, 2, store.Publish("news", "hello"))
+			receiveMessageTestAux(t, first)
+		}
+		assertInterface(t, 1, store.Publish("news", "hello"))
+
+		select {
+		case <-slow.Evicted():
+		default:
+			t.Errorf("expected slow subscriber to be evicted")
+		}
+
+		assertInterface(t, 0, slow.Subscriptions())
+		assertInterface(t, []int{1}, store.PubSubNumSub("news"))
+	})
+}
@@ -0,0 +1,887 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	rdbMagic      = "REDIS"
+	rdbMinVersion = 1
+	rdbMaxVersion = 12
+)
+
+const (
+	rdbTypeString          byte = 0
+	rdbTypeList            byte = 1
+	rdbTypeSet             byte = 2
+	rdbTypeZSet            byte = 3
+	rdbTypeHash            byte = 4
+	rdbTypeZSet2           byte = 5
+	rdbTypeHashZipmap      byte = 9
+	rdbTypeListZiplist     byte = 10
+	rdbTypeSetIntset       byte = 11
+	rdbTypeZSetZiplist     byte = 12
+	rdbTypeHashZiplist     byte = 13
+	rdbTypeListQuicklist   byte = 14
+	rdbTypeHashListpack    byte = 16
+	rdbTypeZSetListpack    byte = 17
+	rdbTypeListQuicklist2  byte = 18
+	rdbTypeSetListpack     byte = 20
+	rdbOpcodeSlotInfo      byte = 0xf4
+	rdbOpcodeFunctionPreGA byte = 0xf5
+	rdbOpcodeFunction2     byte = 0xf6
+	rdbOpcodeModuleAux     byte = 0xf7
+	rdbOpcodeIdle          byte = 0xf8
+	rdbOpcodeFreq          byte = 0xf9
+	rdbOpcodeAux           byte = 0xfa
+	rdbOpcodeResizeDb      byte = 0xfb
+	rdbOpcodeExpireTimeMs  byte = 0xfc
+	rdbOpcodeExpireTime    byte = 0xfd
+	rdbOpcodeSelectDb      byte = 0xfe
+	rdbOpcodeEOF           byte = 0xff
+)
+
+const (
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLZF   = 3
+)
+
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+var rdbTypeNames = map[byte]string{
+	6:  "module",
+	7:  "module",
+	15: "stream",
+	19: "stream",
+	21: "stream",
+	22: "hash with field expiration",
+	23: "hash with field expiration",
+	24: "hash with field expiration",
+	25: "hash with field expiration",
+}
+
+var rdbChecksumTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+var errCorruptedRdbEncoding = errors.New("corrupted RDB encoding")
+
+type UnsupportedRdbTypeError struct {
+	Key  string
+	Type byte
+}
+
+func (err UnsupportedRdbTypeError) Error() string {
+	name, ok := rdbTypeNames[err.Type]
+	if !ok {
+		name = "unknown"
+	}
+
+	return fmt.Sprintf("miniredis: key %q holds an unsupported RDB value of type %d (%s)", err.Key, err.Type, name)
+}
+
+func (store *Store) ImportRdb(r io.Reader) (int, error) {
+	entries, err := readRdb(r)
+	if _, ok := err.(UnsupportedRdbTypeError); err != nil && !ok {
+		return 0, fmt.Errorf("miniredis: could not import RDB file: %v", err)
+	} else if err != nil {
+		return 0, err
+	}
+
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	unlockPropagation := store.lockPropagation()
+	defer unlockPropagation()
+
+	count, now := 0, time.Now().UnixNano()
+	for _, e := range entries {
+		if e.deadline != 0 && e.deadline <= now {
+			continue
+		}
+
+		unlock := store.LockKey(e.key)
+		store.put(e.key, e.value, e.deadline)
+		unlock()
+
+		store.propagate("DEL", e.key)
+		for _, record := range rewriteRecords(e) {
+			store.propagate(record...)
+		}
+
+		if _, ok := e.value.(*List); ok {
+			store.serveBlocked(e.key)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+type rdbReader struct {
+	reader   *bufio.Reader
+	checksum uint64
+	version  int
+}
+
+func readRdb(r io.Reader) ([]dumpEntry, error) {
+	reader := &rdbReader{reader: bufio.NewReader(r)}
+
+	header, err := reader.readRaw(len(rdbMagic) + 4)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(header[:len(rdbMagic)]) != rdbMagic {
+		return nil, errors.New("invalid RDB header")
+	}
+
+	reader.version, err = strconv.Atoi(string(header[len(rdbMagic):]))
+	if err != nil || reader.version < rdbMinVersion || reader.version > rdbMaxVersion {
+		return nil, fmt.Errorf("unsupported RDB version %q", header[len(rdbMagic):])
+	}
+
+	var entries []dumpEntry
+	var deadline int64
+	var db int
+	for {
+		kind, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case rdbOpcodeEOF:
+			return entries, reader.verifyChecksum()
+		case rdbOpcodeSelectDb:
+			db, err = reader.readLength()
+		case rdbOpcodeResizeDb:
+			err = reader.skipLengths(2)
+		case rdbOpcodeSlotInfo:
+			err = reader.skipLengths(3)
+		case rdbOpcodeExpireTime:
+			var seconds int64
+			seconds, err = reader.readInt(4)
+			deadline = seconds * int64(time.Second)
+		case rdbOpcodeExpireTimeMs:
+			var millis int64
+			millis, err = reader.readInt(8)
+			deadline = millis * int64(time.Millisecond)
+		case rdbOpcodeAux:
+			_, err = reader.readString()
+			if err == nil {
+				_, err = reader.readString()
+			}
+		case rdbOpcodeFreq:
+			_, err = reader.ReadByte()
+		case rdbOpcodeIdle:
+			_, err = reader.readLength()
+		case rdbOpcodeFunction2:
+			if _, err = reader.readString(); err == nil {
+				log.Printf("Skipping function library stored in the RDB file")
+			}
+		case rdbOpcodeFunctionPreGA, rdbOpcodeModuleAux:
+			return nil, fmt.Errorf("unsupported RDB opcode 0x%x", kind)
+		default:
+			var e dumpEntry
+			if e, err = reader.readEntry(kind, deadline); err != nil {
+				return nil, err
+			}
+
+			if db != 0 {
+				return nil, fmt.Errorf("key %q belongs to database %d, only database 0 can be imported", e.key, db)
+			}
+
+			if e.value != nil {
+				entries = append(entries, e)
+			}
+			deadline = 0
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (reader *rdbReader) readRaw(size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(reader.reader, buf); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	reader.checksum = rdbChecksum(reader.checksum, buf)
+	return buf, nil
+}
+
+func rdbChecksum(crc uint64, buf []byte) uint64 {
+	return ^crc64.Update(^crc, rdbChecksumTable, buf)
+}
+
+func (reader *rdbReader) ReadByte() (byte, error) {
+	buf, err := reader.readRaw(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return buf[0], nil
+}
+
+func (reader *rdbReader) verifyChecksum() error {
+	if reader.version < 5 {
+		return nil
+	}
+
+	expected := reader.checksum
+
+	sum := make([]byte, 8)
+	if _, err := io.ReadFull(reader.reader, sum); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if actual := binary.LittleEndian.Uint64(sum); actual != 0 && actual != expected {
+		return errors.New("RDB checksum mismatch")
+	}
+
+	return nil
+}
+
+func (reader *rdbReader) readInt(size int) (int64, error) {
+	buf, err := reader.readRaw(size)
+	if err != nil {
+		return 0, err
+	}
+
+	return littleEndianInt(buf, size), nil
+}
+
+func (reader *rdbReader) readLengthEncoding() (int, bool, error) {
+	first, err := reader.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch first >> 6 {
+	case 0:
+		return int(first & 0x3f), false, nil
+	case 1:
+		next, err := reader.ReadByte()
+		return int(first&0x3f)<<8 | int(next), false, err
+	case 3:
+		return int(first & 0x3f), true, nil
+	}
+
+	var length uint64
+	switch first {
+	case 0x80:
+		buf, err := reader.readRaw(4)
+		if err != nil {
+			return 0, false, err
+		}
+		length = uint64(binary.BigEndian.Uint32(buf))
+	case 0x81:
+		buf, err := reader.readRaw(8)
+		if err != nil {
+			return 0, false, err
+		}
+		length = binary.BigEndian.Uint64(buf)
+	default:
+		return 0, false, fmt.Errorf("invalid RDB length encoding 0x%x", first)
+	}
+
+	if length > math.MaxInt32 {
+		return 0, false, errors.New("invalid RDB length")
+	}
+
+	return int(length), false, nil
+}
+
+func (reader *rdbReader) readLength() (int, error) {
+	length, encoded, err := reader.readLengthEncoding()
+	if err == nil && encoded {
+		err = errors.New("unexpected RDB string encoding in length")
+	}
+
+	return length, err
+}
+
+func (reader *rdbReader) skipLengths(count int) error {
+	for index := 0; index < count; index++ {
+		if _, err := reader.readLength(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (reader *rdbReader) readStringValue() (Value, error) {
+	length, encoded, err := reader.readLengthEncoding()
+	if err != nil {
+		return nil, err
+	}
+
+	if !encoded {
+		buf, err := reader.readRaw(length)
+		return string(buf), err
+	}
+
+	switch length {
+	case rdbEncInt8:
+		num, err := reader.readInt(1)
+		return int(num), err
+	case rdbEncInt16:
+		num, err := reader.readInt(2)
+		return int(num), err
+	case rdbEncInt32:
+		num, err := reader.readInt(4)
+		return int(num), err
+	case rdbEncLZF:
+		compressed, err := reader.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		uncompressed, err := reader.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		buf, err := reader.readRaw(compressed)
+		if err != nil {
+			return nil, err
+		}
+
+		buf, err = lzfDecompress(buf, uncompressed)
+		return string(buf), err
+	}
+
+	return nil, fmt.Errorf("unknown RDB string encoding %d", length)
+}
+
+func (reader *rdbReader) readString() (string, error) {
+	value, err := reader.readStringValue()
+	if num, ok := value.(int); ok {
+		return strconv.Itoa(num), err
+	}
+
+	str, _ := value.(string)
+	return str, err
+}
+
+func (reader *rdbReader) readStrings(width int) ([]string, error) {
+	count, err := reader.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+	for index := 0; index < count*width; index++ {
+		value, err := reader.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func (reader *rdbReader) readEntry(kind byte, deadline int64) (dumpEntry, error) {
+	e := dumpEntry{deadline: deadline}
+
+	var err error
+	if e.key, err = reader.readString(); err != nil {
+		return e, err
+	}
+
+	var values []string
+	switch kind {
+	case rdbTypeString:
+		e.value, err = reader.readStringValue()
+		return e, err
+	case rdbTypeList, rdbTypeSet:
+		values, err = reader.readStrings(1)
+	case rdbTypeHash:
+		values, err = reader.readStrings(2)
+	case rdbTypeZSet, rdbTypeZSet2:
+		var sortedSet *SortedSet
+		if sortedSet, err = reader.readSortedSet(kind == rdbTypeZSet2); err == nil && sortedSet.Len() > 0 {
+			e.value = sortedSet
+		}
+		return e, err
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		values, err = reader.readQuicklist(kind == rdbTypeListQuicklist2)
+	default:
+		var buf string
+		if _, ok := rdbBlobDecoders[kind]; !ok {
+			return e, UnsupportedRdbTypeError{e.key, kind}
+		}
+
+		if buf, err = reader.readString(); err == nil {
+			values, err = rdbBlobDecoders[kind]([]byte(buf))
+		}
+	}
+
+	if err != nil || len(values) == 0 {
+		return e, err
+	}
+
+	switch kind {
+	case rdbTypeList, rdbTypeListZiplist, rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		list := MakeList()
+		list.Push(ListRight, values...)
+		e.value = list
+	case rdbTypeSet, rdbTypeSetIntset, rdbTypeSetListpack:
+		set := MakeSet()
+		for _, member := range values {
+			set.Add(member)
+		}
+		e.value = set
+	case rdbTypeHash, rdbTypeHashZipmap, rdbTypeHashZiplist, rdbTypeHashListpack:
+		e.value, err = makeRdbHash(values)
+	case rdbTypeZSetZiplist, rdbTypeZSetListpack:
+		e.value, err = makeRdbSortedSet(values)
+	}
+
+	return e, err
+}
+
+var rdbBlobDecoders = map[byte]func([]byte) ([]string, error){
+	rdbTypeHashZipmap:   zipmapEntries,
+	rdbTypeListZiplist:  ziplistEntries,
+	rdbTypeSetIntset:    intsetEntries,
+	rdbTypeZSetZiplist:  ziplistEntries,
+	rdbTypeHashZiplist:  ziplistEntries,
+	rdbTypeHashListpack: listpackEntries,
+	rdbTypeZSetListpack: listpackEntries,
+	rdbTypeSetListpack:  listpackEntries,
+}
+
+func (reader *rdbReader) readSortedSet(binaryScores bool) (*SortedSet, error) {
+	count, err := reader.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	sortedSet := MakeSortedSet()
+	for index := 0; index < count; index++ {
+		member, err := reader.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var score float64
+		if binaryScores {
+			buf, err := reader.readRaw(8)
+			if err != nil {
+				return nil, err
+			}
+			score = math.Float64frombits(binary.LittleEndian.Uint64(buf))
+		} else if score, err = reader.readScore(); err != nil {
+			return nil, err
+		}
+
+		if math.IsNaN(score) {
+			return nil, fmt.Errorf("invalid score of member %q", member)
+		}
+
+		sortedSet.Set(score, member)
+	}
+
+	return sortedSet, nil
+}
+
+func (reader *rdbReader) readScore() (float64, error) {
+	length, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+
+	buf, err := reader.readRaw(int(length))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+func (reader *rdbReader) readQuicklist(packed bool) ([]string, error) {
+	count, err := reader.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+	for index := 0; index < count; index++ {
+		container := quicklistNodePacked
+		if packed {
+			if container, err = reader.readLength(); err != nil {
+				return nil, err
+			}
+		}
+
+		node, err := reader.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []string
+		switch {
+		case container == quicklistNodePlain:
+			entries = []string{node}
+		case container != quicklistNodePacked:
+			return nil, fmt.Errorf("unknown quicklist container %d", container)
+		case packed:
+			entries, err = listpackEntries([]byte(node))
+		default:
+			entries, err = ziplistEntries([]byte(node))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, entries...)
+	}
+
+	return values, nil
+}
+
+func makeRdbHash(values []string) (*Hash, error) {
+	if len(values)%2 != 0 {
+		return nil, errCorruptedRdbEncoding
+	}
+
+	hash := MakeHash()
+	for index := 0; index < len(values); index += 2 {
+		hash.Set(values[index], values[index+1])
+	}
+
+	return hash, nil
+}
+
+func makeRdbSortedSet(values []string) (*SortedSet, error) {
+	if len(values)%2 != 0 {
+		return nil, errCorruptedRdbEncoding
+	}
+
+	sortedSet := MakeSortedSet()
+	for index := 0; index < len(values); index += 2 {
+		score, err := strconv.ParseFloat(values[index+1], 64)
+		if err != nil || math.IsNaN(score) {
+			return nil, fmt.Errorf("invalid score of member %q", values[index])
+		}
+
+		sortedSet.Set(score, values[index])
+	}
+
+	return sortedSet, nil
+}
+
+func littleEndianInt(buf []byte, size int) int64 {
+	var num uint64
+	for index := size - 1; index >= 0; index-- {
+		num = num<<8 | uint64(buf[index])
+	}
+
+	shift := uint(64 - 8*size)
+	return int64(num<<shift) >> shift
+}
+
+func ziplistEntries(buf []byte) ([]string, error) {
+	if len(buf) < 11 {
+		return nil, errCorruptedRdbEncoding
+	}
+
+	entries := make([]string, 0)
+	for pos := 10; pos < len(buf); {
+		if buf[pos] == 0xff {
+			return entries, nil
+		}
+
+		if buf[pos] < 0xfe {
+			pos++
+		} else {
+			pos += 5
+		}
+
+		if pos >= len(buf) {
+			break
+		}
+
+		encoding := buf[pos]
+		var length int
+		switch encoding >> 6 {
+		case 0:
+			length, pos = int(encoding&0x3f), pos+1
+		case 1:
+			if pos+2 > len(buf) {
+				return nil, errCorruptedRdbEncoding
+			}
+			length, pos = int(encoding&0x3f)<<8|int(buf[pos+1]), pos+2
+		case 2:
+			if pos+5 > len(buf) {
+				return nil, errCorruptedRdbEncoding
+			}
+			length, pos = int(binary.BigEndian.Uint32(buf[pos+1:pos+5])), pos+5
+		default:
+			num, size, err := ziplistInt(buf[pos:])
+			if err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, strconv.FormatInt(num, 10))
+			pos += size
+			continue
+		}
+
+		if length < 0 || pos+length > len(buf) {
+			break
+		}
+
+		entries = append(entries, string(buf[pos:pos+length]))
+		pos += length
+	}
+
+	return nil, errCorruptedRdbEncoding
+}
+
+func ziplistInt(buf []byte) (int64, int, error) {
+	var size int
+	switch encoding := buf[0]; {
+	case encoding == 0xc0:
+		size = 2
+	case encoding == 0xd0:
+		size = 4
+	case encoding == 0xe0:
+		size = 8
+	case encoding == 0xf0:
+		size = 3
+	case encoding == 0xfe:
+		size = 1
+	case encoding >= 0xf1 && encoding <= 0xfd:
+		return int64(encoding&0x0f) - 1, 1, nil
+	default:
+		return 0, 0, errCorruptedRdbEncoding
+	}
+
+	if 1+size > len(buf) {
+		return 0, 0, errCorruptedRdbEncoding
+	}
+
+	return littleEndianInt(buf[1:], size), 1 + size, nil
+}
+
+func listpackEntries(buf []byte) ([]string, error) {
+	if len(buf) < 7 {
+		return nil, errCorruptedRdbEncoding
+	}
+
+	entries := make([]string, 0)
+	for pos := 6; pos < len(buf); {
+		encoding := buf[pos]
+		if encoding == 0xff {
+			return entries, nil
+		}
+
+		var header, size int
+		var num int64
+		isInt := true
+		switch {
+		case encoding&0x80 == 0:
+			num, size = int64(encoding&0x7f), 1
+		case encoding&0xc0 == 0x80:
+			header, isInt = 1, false
+			size = header + int(encoding&0x3f)
+		case encoding&0xe0 == 0xc0:
+			if pos+2 > len(buf) {
+				return nil, errCorruptedRdbEncoding
+			}
+			num, size = int64(encoding&0x1f)<<8|int64(buf[pos+1]), 2
+			if num >= 1<<12 {
+				num -= 1 << 13
+			}
+		case encoding&0xf0 == 0xe0:
+			if pos+2 > len(buf) {
+				return nil, errCorruptedRdbEncoding
+			}
+			header, isInt = 2, false
+			size = header + (int(encoding&0x0f)<<8 | int(buf[pos+1]))
+		case encoding == 0xf0:
+			if pos+5 > len(buf) {
+				return nil, errCorruptedRdbEncoding
+			}
+			header, isInt = 5, false
+			size = header + int(binary.LittleEndian.Uint32(buf[pos+1:pos+5]))
+		case encoding >= 0xf1 && encoding <= 0xf4:
+			width := []int{2, 3, 4, 8}[encoding-0xf1]
+			if pos+1+width > len(buf) {
+				return nil, errCorruptedRdbEncoding
+			}
+			num, size = littleEndianInt(buf[pos+1:], width), 1+width
+		default:
+			return nil, errCorruptedRdbEncoding
+		}
+
+		if size < 0 || pos+size > len(buf) {
+			break
+		}
+
+		if isInt {
+			entries = append(entries, strconv.FormatInt(num, 10))
+		} else {
+			entries = append(entries, string(buf[pos+header:pos+size]))
+		}
+
+		pos += size + listpackBacklenSize(size)
+	}
+
+	return nil, errCorruptedRdbEncoding
+}
+
+func listpackBacklenSize(size int) int {
+	switch {
+	case size < 1<<7:
+		return 1
+	case size < 1<<14:
+		return 2
+	case size < 1<<21:
+		return 3
+	case size < 1<<28:
+		return 4
+	}
+
+	return 5
+}
+
+func intsetEntries(buf []byte) ([]string, error) {
+	if len(buf) < 8 {
+		return nil, errCorruptedRdbEncoding
+	}
+
+	width := int(binary.LittleEndian.Uint32(buf[0:4]))
+	count := int(binary.LittleEndian.Uint32(buf[4:8]))
+	if (width != 2 && width != 4 && width != 8) || count < 0 || len(buf) < 8+width*count {
+		return nil, errCorruptedRdbEncoding
+	}
+
+	entries := make([]string, 0, count)
+	for index := 0; index < count; index++ {
+		entries = append(entries, strconv.FormatInt(littleEndianInt(buf[8+index*width:], width), 10))
+	}
+
+	return entries, nil
+}
+
+func zipmapEntries(buf []byte) ([]string, error) {
+	readLength := func(pos int) (int, int, bool) {
+		switch {
+		case pos >= len(buf) || buf[pos] == 0xff:
+			return 0, pos, false
+		case buf[pos] < 0xfe:
+			return int(buf[pos]), pos + 1, true
+		case pos+5 > len(buf):
+			return 0, pos, false
+		}
+
+		return int(binary.LittleEndian.Uint32(buf[pos+1 : pos+5])), pos + 5, true
+	}
+
+	entries := make([]string, 0)
+	for pos := 1; pos < len(buf); {
+		if buf[pos] == 0xff {
+			return entries, nil
+		}
+
+		length, next, ok := readLength(pos)
+		if !ok || length < 0 || next+length > len(buf) {
+			break
+		}
+		field := string(buf[next : next+length])
+
+		length, next, ok = readLength(next + length)
+		if !ok || length < 0 || next+1+length > len(buf) {
+			break
+		}
+		free := int(buf[next])
+		value := string(buf[next+1 : next+1+length])
+
+		entries = append(entries, field, value)
+		pos = next + 1 + length + free
+	}
+
+	return nil, errCorruptedRdbEncoding
+}
+
+func lzfDecompress(in []byte, length int) ([]byte, error) {
+	out := make([]byte, 0, length)
+	for pos := 0; pos < len(in); {
+		ctrl := int(in[pos])
+		pos++
+
+		if ctrl < 32 {
+			ctrl++
+			if pos+ctrl > len(in) {
+				return nil, errCorruptedRdbEncoding
+			}
+
+			out = append(out, in[pos:pos+ctrl]...)
+			pos += ctrl
+			continue
+		}
+
+		size := ctrl >> 5
+		if size == 7 {
+			if pos >= len(in) {
+				return nil, errCorruptedRdbEncoding
+			}
+			size += int(in[pos])
+			pos++
+		}
+
+		if pos >= len(in) {
+			return nil, errCorruptedRdbEncoding
+		}
+
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[pos]) - 1
+		pos++
+
+		if ref < 0 {
+			return nil, errCorruptedRdbEncoding
+		}
+
+		for index := 0; index < size+2; index++ {
+			out = append(out, out[ref+index])
+		}
+	}
+
+	if len(out) != length {
+		return nil, errCorruptedRdbEncoding
+	}
+
+	return out, nil
+}
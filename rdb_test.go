@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+type rdbTestBuilder struct {
+	bytes.Buffer
+}
+
+func newRdbTestBuilder(version string) *rdbTestBuilder {
+	builder := new(rdbTestBuilder)
+	builder.WriteString("REDIS" + version)
+	builder.aux("redis-ver", "7.2.4")
+	builder.WriteByte(rdbOpcodeSelectDb)
+	builder.length(0)
+	builder.WriteByte(rdbOpcodeResizeDb)
+	builder.length(16)
+	builder.length(1)
+
+	return builder
+}
+
+func (builder *rdbTestBuilder) length(length int) {
+	switch {
+	case length < 1<<6:
+		builder.WriteByte(byte(length))
+	case length < 1<<14:
+		builder.WriteByte(byte(length>>8) | 0x40)
+		builder.WriteByte(byte(length))
+	default:
+		builder.WriteByte(0x80)
+		binary.Write(builder, binary.BigEndian, uint32(length))
+	}
+}
+
+func (builder *rdbTestBuilder) str(str string) {
+	builder.length(len(str))
+	builder.WriteString(str)
+}
+
+func (builder *rdbTestBuilder) aux(key, value string) {
+	builder.WriteByte(rdbOpcodeAux)
+	builder.str(key)
+	builder.str(value)
+}
+
+func (builder *rdbTestBuilder) key(kind byte, key string) {
+	builder.WriteByte(kind)
+	builder.str(key)
+}
+
+func (builder *rdbTestBuilder) finish() []byte {
+	builder.WriteByte(rdbOpcodeEOF)
+	checksum := rdbChecksum(0, builder.Bytes())
+	binary.Write(builder, binary.LittleEndian, checksum)
+
+	return builder.Bytes()
+}
+
+func listpackTestAux(entries ...interface{}) []byte {
+	var body bytes.Buffer
+	for _, entry := range entries {
+		var encoded []byte
+		switch typed := entry.(type) {
+		case int:
+			if typed >= 0 && typed < 128 {
+				encoded = []byte{byte(typed)}
+			} else {
+				encoded = []byte{0xf1, byte(typed), byte(typed >> 8)}
+			}
+		case string:
+			encoded = append([]byte{0x80 | byte(len(typed))}, typed...)
+		}
+
+		body.Write(encoded)
+		body.WriteByte(byte(len(encoded)))
+	}
+	body.WriteByte(0xff)
+
+	buf := make([]byte, 6)
+	binary.LittleEndian.PutUint32(buf, uint32(6+body.Len()))
+	binary.LittleEndian.PutUint16(buf[4:], uint16(len(entries)))
+
+	return append(buf, body.Bytes()...)
+}
+
+func ziplistTestAux(entries ...interface{}) []byte {
+	var body bytes.Buffer
+	previous := 0
+	for _, entry := range entries {
+		var encoded []byte
+		switch typed := entry.(type) {
+		case int:
+			if typed >= 0 && typed <= 12 {
+				encoded = []byte{0xf1 + byte(typed)}
+			} else {
+				encoded = []byte{0xc0, byte(typed), byte(typed >> 8)}
+			}
+		case string:
+			encoded = append([]byte{byte(len(typed))}, typed...)
+		}
+
+		body.WriteByte(byte(previous))
+		body.Write(encoded)
+		previous = 1 + len(encoded)
+	}
+	body.WriteByte(0xff)
+
+	buf := make([]byte, 10)
+	binary.LittleEndian.PutUint32(buf, uint32(10+body.Len()))
+	binary.LittleEndian.PutUint16(buf[8:], uint16(len(entries)))
+
+	return append(buf, body.Bytes()...)
+}
+
+func importRdbTestAux(t *testing.T, data []byte) *Store {
+	store := new(Store)
+	if _, err := store.ImportRdb(bytes.NewReader(data)); err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+
+	return store
+}
+
+func TestImportRdb(t *testing.T) {
+	t.Run("import version 11 encodings", func(t *testing.T) {
+		builder := newRdbTestBuilder("0011")
+
+		builder.key(rdbTypeString, "str")
+		builder.str("value")
+
+		builder.key(rdbTypeString, "int8")
+		builder.Write([]byte{0xc0, 0xf6})
+
+		builder.key(rdbTypeString, "int32")
+		builder.Write([]byte{0xc2, 0x40, 0xe2, 0x01, 0x00})
+
+		builder.key(rdbTypeString, "compressed")
+		builder.Write([]byte{0xc3, 0x05, 0x0a, 0x00, 'a', 0xe0, 0x00, 0x00})
+
+		builder.WriteByte(rdbOpcodeExpireTimeMs)
+		binary.Write(builder, binary.LittleEndian, time.Now().Add(time.Hour).UnixNano()/int64(time.Millisecond))
+		builder.key(rdbTypeString, "volatile")
+		builder.str("value")
+
+		builder.WriteByte(rdbOpcodeExpireTimeMs)
+		binary.Write(builder, binary.LittleEndian, int64(1000))
+		builder.key(rdbTypeString, "expired")
+		builder.str("value")
+
+		builder.key(rdbTypeListQuicklist2, "list")
+		builder.length(2)
+		builder.length(quicklistNodePacked)
+		builder.str(string(listpackTestAux("a", 1, -300)))
+		builder.length(quicklistNodePlain)
+		builder.str("big")
+
+		builder.key(rdbTypeSetListpack, "set")
+		builder.str(string(listpackTestAux("x", 7)))
+
+		builder.key(rdbTypeSetIntset, "intset")
+		builder.str(string([]byte{2, 0, 0, 0, 2, 0, 0, 0, 0xff, 0xff, 0x05, 0x00}))
+
+		builder.key(rdbTypeHashListpack, "hash")
+		builder.str(string(listpackTestAux("field", "value", "n", 5)))
+
+		builder.key(rdbTypeZSetListpack, "zset")
+		builder.str(string(listpackTestAux("a", 1, "b", "2.5")))
+
+		builder.key(rdbTypeZSet2, "zset2")
+		builder.length(2)
+		builder.str("low")
+		binary.Write(builder, binary.LittleEndian, math.Float64bits(math.Inf(-1)))
+		builder.str("high")
+		binary.Write(builder, binary.LittleEndian, math.Float64bits(3.25))
+
+		builder.WriteByte(rdbOpcodeFunction2)
+		builder.str("#!lua name=lib\nredis.register_function('f', function() return 1 end)")
+
+		store := new(Store)
+		count, err := store.ImportRdb(bytes.NewReader(builder.finish()))
+		assertInterface(t, nil, err)
+		assertInterface(t, 11, count)
+		assertInterface(t, 11, store.DbSize())
+
+		assertGet(t, store, "str", "value", true, false)
+		assertGet(t, store, "int8", "-10", true, false)
+		assertGet(t, store, "int32", "123456", true, false)
+		assertGet(t, store, "compressed", "aaaaaaaaaa", true, false)
+		assertGet(t, store, "expired", "", false, false)
+
+		num, _ := store.Incr("int32")
+		assertInterface(t, 123457, num)
+
+		_, _, volatile := store.Deadline("volatile")
+		assertInterface(t, true, volatile)
+
+		values, _ := store.LRange("list", 0, -1)
+		assertInterface(t, []string{"a", "1", "-300", "big"}, values)
+
+		members, _ := store.SMembers("set")
+		assertInterface(t, []string{"7", "x"}, members)
+
+		members, _ = store.SMembers("intset")
+		assertInterface(t, []string{"-1", "5"}, members)
+
+		fields, _ := store.HGetAll("hash")
+		assertInterface(t, []HashItem{{"field", "value"}, {"n", "5"}}, fields)
+
+		items, _ := store.ZRange("zset", 0, 10)
+		assertInterface(t, []SortedSetItem{{1, "a"}, {2.5, "b"}}, items)
+
+		items, _ = store.ZRange("zset2", 0, 10)
+		assertInterface(t, []SortedSetItem{{math.Inf(-1), "low"}, {3.25, "high"}}, items)
+	})
+
+	t.Run("import version 9 encodings", func(t *testing.T) {
+		builder := newRdbTestBuilder("0009")
+
+		builder.WriteByte(rdbOpcodeExpireTime)
+		binary.Write(builder, binary.LittleEndian, uint32(time.Now().Add(time.Hour).Unix()))
+		builder.key(rdbTypeListQuicklist, "list")
+		builder.length(1)
+		builder.str(string(ziplistTestAux("a", 3, 1000)))
+
+		builder.key(rdbTypeZSetZiplist, "zset")
+		builder.str(string(ziplistTestAux("m", "-1.5", "n", 2)))
+
+		builder.key(rdbTypeHashZiplist, "hash")
+		builder.str(string(ziplistTestAux("f", "v")))
+
+		builder.key(rdbTypeHashZipmap, "zipmap")
+		builder.str(string([]byte{1, 1, 'k', 2, 0, 'v', 'w', 0xff}))
+
+		builder.key(rdbTypeZSet, "zset1")
+		builder.length(2)
+		builder.str("x")
+		builder.Write([]byte{3, '0', '.', '5'})
+		builder.str("y")
+		builder.WriteByte(254)
+
+		builder.key(rdbTypeList, "plainlist")
+		builder.length(2)
+		builder.str("p")
+		builder.str("q")
+
+		builder.key(rdbTypeSet, "plainset")
+		builder.length(1)
+		builder.str("s")
+
+		builder.key(rdbTypeHash, "plainhash")
+		builder.length(1)
+		builder.str("a")
+		builder.str("b")
+
+		store := importRdbTestAux(t, builder.finish())
+		assertInterface(t, 8, store.DbSize())
+
+		values, _ := store.LRange("list", 0, -1)
+		assertInterface(t, []string{"a", "3", "1000"}, values)
+
+		_, _, volatile := store.Deadline("list")
+		assertInterface(t, true, volatile)
+
+		items, _ := store.ZRange("zset", 0, 10)
+		assertInterface(t, []SortedSetItem{{-1.5, "m"}, {2, "n"}}, items)
+
+		items, _ = store.ZRange("zset1", 0, 10)
+		assertInterface(t, []SortedSetItem{{0.5, "x"}, {math.Inf(1), "y"}}, items)
+
+		fields, _ := store.HGetAll("hash")
+		assertInterface(t, []HashItem{{"f", "v"}}, fields)
+
+		fields, _ = store.HGetAll("zipmap")
+		assertInterface(t, []HashItem{{"k", "vw"}}, fields)
+
+		values, _ = store.LRange("plainlist", 0, -1)
+		assertInterface(t, []string{"p", "q"}, values)
+
+		isMember, _ := store.SIsMember("plainset", "s")
+		assertInterface(t, true, isMember)
+
+		value, _, _ := store.HGet("plainhash", "a")
+		assertInterface(t, "b", value)
+	})
+
+	t.Run("report unsupported types", func(t *testing.T) {
+		builder := newRdbTestBuilder("0011")
+		builder.key(15, "events")
+		builder.str("ignored")
+
+		_, err := new(Store).ImportRdb(bytes.NewReader(builder.finish()))
+		assertInterface(t, UnsupportedRdbTypeError{"events", 15}, err)
+		assertInterface(t, `miniredis: key "events" holds an unsupported RDB value of type 15 (stream)`, err.Error())
+	})
+
+	t.Run("reject keys in other databases", func(t *testing.T) {
+		builder := newRdbTestBuilder("0010")
+		builder.WriteByte(rdbOpcodeSelectDb)
+		builder.length(3)
+		builder.key(rdbTypeString, "key")
+		builder.str("value")
+
+		_, err := new(Store).ImportRdb(bytes.NewReader(builder.finish()))
+		if err == nil || !strings.Contains(err.Error(), "database 3") {
+			t.Errorf("expected database error, got %v", err)
+		}
+	})
+
+	t.Run("verify checksum", func(t *testing.T) {
+		builder := newRdbTestBuilder("0011")
+		builder.key(rdbTypeString, "key")
+		builder.str("value")
+
+		data := builder.finish()
+		data[len(data)-1] ^= 0xff
+
+		if _, err := new(Store).ImportRdb(bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("expected checksum error, got %v", err)
+		}
+
+		copy(data[len(data)-8:], make([]byte, 8))
+		importRdbTestAux(t, data)
+	})
+
+	t.Run("reject invalid files", func(t *testing.T) {
+		for _, data := range []string{"REDIS", "MINIREDIS", "REDIS0099\xff", "REDIS0011\x00\x03key"} {
+			if _, err := new(Store).ImportRdb(strings.NewReader(data)); err == nil {
+				t.Errorf("%q: expected error, got nil", data)
+			}
+		}
+	})
+}
+
+func TestRdbChecksum(t *testing.T) {
+	assertInterface(t, uint64(0xe9c6d914c4b8d9ca), rdbChecksum(0, []byte("123456789")))
+	assertInterface(t, uint64(0xe9c6d914c4b8d9ca), rdbChecksum(rdbChecksum(0, []byte("1234")), []byte("56789")))
+}
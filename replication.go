@@ -0,0 +1,678 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultFollowerBuffer    = 4096
+	defaultBacklogSize       = 1024 * 1024
+	replicationBacklogTTL    = time.Hour
+	replicationPingInterval  = 10 * time.Second
+	replicationAckInterval   = time.Second
+	replicationTimeout       = 60 * time.Second
+	replicationRetryInterval = time.Second
+	syncMarkLength           = 40
+)
+
+const (
+	LinkConnect    = "connect"
+	LinkConnecting = "connecting"
+	LinkSync       = "sync"
+	LinkConnected  = "connected"
+)
+
+var errReplicationStopped = errors.New("replication stopped")
+
+type ReadOnlyError struct{}
+
+func (err ReadOnlyError) Error() string {
+	return "miniredis: You can't write against a read only replica."
+}
+
+type Follower struct {
+	addr    string
+	stream  chan []byte
+	evicted chan struct{}
+	ack     int64
+}
+
+func (follower *Follower) Stream() <-chan []byte {
+	if follower == nil {
+		return nil
+	}
+
+	return follower.stream
+}
+
+func (follower *Follower) Evicted() <-chan struct{} {
+	if follower == nil {
+		return nil
+	}
+
+	return follower.evicted
+}
+
+type followerSync struct {
+	id      string
+	offset  int64
+	partial bool
+	dump    *storeDump
+	backlog []byte
+}
+
+type leaderLink struct {
+	addr   string
+	status string
+	conn   net.Conn
+	stop   chan struct{}
+}
+
+func (link *leaderLink) stopped() bool {
+	select {
+	case <-link.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+type replicationState struct {
+	mutex           sync.Mutex
+	count           int32
+	following       int32
+	backlogged      int32
+	id              string
+	offset          int64
+	secondaryID     string
+	secondaryOffset int64
+	backlog         *replicationBacklog
+	backlogSize     int
+	backlogTimer    *time.Timer
+	followers       map[*Follower]struct{}
+	ping            chan struct{}
+	link            *leaderLink
+}
+
+type FollowerInfo struct {
+	Addr   string
+	Offset int64
+}
+
+type ReplicationInfo struct {
+	ID         string
+	Following  bool
+	Leader     string
+	LinkStatus string
+	Offset     int64
+	Followers  []FollowerInfo
+}
+
+func (store *Store) Replication() ReplicationInfo {
+	state := &store.replication
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	info := ReplicationInfo{ID: state.id, Offset: state.offset}
+	if link := state.link; link != nil {
+		info.Following, info.Leader, info.LinkStatus = true, link.addr, link.status
+	}
+
+	for follower := range state.followers {
+		info.Followers = append(info.Followers, FollowerInfo{follower.addr, follower.ack})
+	}
+
+	sort.Slice(info.Followers, func(i, j int) bool {
+		return info.Followers[i].Addr < info.Followers[j].Addr
+	})
+
+	return info
+}
+
+func (store *Store) following() bool {
+	return atomic.LoadInt32(&store.replication.following) != 0
+}
+
+func newReplicationID() string {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("miniredis: could not generate replication id: %v", err))
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+func (store *Store) attachFollower(addr, id string, offset int64) (*Follower, followerSync, error) {
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	state := &store.replication
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.link != nil {
+		return nil, followerSync{}, errors.New("miniredis: Followers can't replicate to other followers")
+	}
+
+	if state.id == "" {
+		state.id = newReplicationID()
+	}
+
+	if state.backlog == nil {
+		store.createBacklog()
+	}
+
+	if state.backlogTimer != nil {
+		state.backlogTimer.Stop()
+		state.backlogTimer = nil
+	}
+
+	sync := followerSync{id: state.id, offset: state.offset}
+	if store.canContinue(id, offset) {
+		sync.partial = true
+		sync.backlog, _ = state.backlog.since(offset)
+	} else {
+		sync.dump = store.beginDump()
+	}
+
+	follower := &Follower{
+		addr:    addr,
+		stream:  make(chan []byte, defaultFollowerBuffer),
+		evicted: make(chan struct{}),
+	}
+
+	if state.followers == nil {
+		state.followers = make(map[*Follower]struct{})
+	}
+
+	state.followers[follower] = struct{}{}
+	if atomic.AddInt32(&state.count, 1) == 1 {
+		state.ping = make(chan struct{})
+		go store.pingFollowers(state.ping)
+	}
+
+	return follower, sync, nil
+}
+
+func (store *Store) canContinue(id string, offset int64) bool {
+	state := &store.replication
+	switch {
+	case id == "" || state.backlog == nil:
+		return false
+	case id != state.id && (id != state.secondaryID || offset > state.secondaryOffset):
+		return false
+	}
+
+	_, ok := state.backlog.since(offset)
+	return ok
+}
+
+func (store *Store) createBacklog() {
+	state := &store.replication
+	size := state.backlogSize
+	if size <= 0 {
+		size = defaultBacklogSize
+	}
+
+	state.backlog = newReplicationBacklog(size, state.offset)
+	atomic.StoreInt32(&state.backlogged, 1)
+}
+
+func (store *Store) freeBacklog() {
+	state := &store.replication
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.count != 0 || state.link != nil {
+		return
+	}
+
+	state.backlog, state.backlogTimer = nil, nil
+	atomic.StoreInt32(&state.backlogged, 0)
+}
+
+func (store *Store) detachFollower(follower *Follower) {
+	if follower == nil {
+		return
+	}
+
+	store.replication.mutex.Lock()
+	defer store.replication.mutex.Unlock()
+
+	store.removeFollower(follower)
+}
+
+func (store *Store) ackFollower(follower *Follower, offset int64) {
+	if follower == nil {
+		return
+	}
+
+	store.replication.mutex.Lock()
+	defer store.replication.mutex.Unlock()
+
+	follower.ack = offset
+}
+
+func (store *Store) removeFollower(follower *Follower) {
+	state := &store.replication
+	if _, ok := state.followers[follower]; !ok {
+		return
+	}
+
+	delete(state.followers, follower)
+	close(follower.evicted)
+
+	if atomic.AddInt32(&state.count, -1) == 0 {
+		close(state.ping)
+		state.backlogTimer = time.AfterFunc(replicationBacklogTTL, store.freeBacklog)
+	}
+}
+
+func (store *Store) feedFollowers(records [][]string) {
+	state := &store.replication
+	if atomic.LoadInt32(&state.backlogged) == 0 || store.following() {
+		return
+	}
+
+	var buf bytes.Buffer
+	writer := NewRespWriter(&buf)
+	for _, record := range records {
+		writer.WriteValue(record)
+	}
+	writer.Flush()
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.backlog == nil || state.link != nil {
+		return
+	}
+
+	state.offset += int64(buf.Len())
+	state.backlog.write(buf.Bytes())
+
+	for follower := range state.followers {
+		select {
+		case follower.stream <- buf.Bytes():
+		default:
+			log.Printf("Disconnecting follower %s: replication buffer limit reached", follower.addr)
+			store.removeFollower(follower)
+		}
+	}
+}
+
+func (store *Store) pingFollowers(stop <-chan struct{}) {
+	ticker := time.NewTicker(replicationPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		store.propagation.command.Lock()
+		store.feedFollowers([][]string{{"PING"}})
+		store.propagation.command.Unlock()
+	}
+}
+
+func (store *Store) ReplicaOf(addr string) {
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	store.replicaOf(addr)
+}
+
+func (store *Store) StopReplication() {
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	store.stopReplication()
+}
+
+func (store *Store) replicaOf(addr string) {
+	state := &store.replication
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.link != nil && state.link.addr == addr {
+		return
+	}
+
+	store.stopLink()
+	for follower := range state.followers {
+		store.removeFollower(follower)
+	}
+
+	link := &leaderLink{addr: addr, status: LinkConnect, stop: make(chan struct{})}
+	state.link = link
+	atomic.StoreInt32(&state.following, 1)
+
+	go store.replicate(link)
+}
+
+func (store *Store) stopReplication() {
+	store.replication.mutex.Lock()
+	defer store.replication.mutex.Unlock()
+
+	if store.stopLink() {
+		store.promote()
+	}
+}
+
+func (store *Store) stopLink() bool {
+	state := &store.replication
+	link := state.link
+	if link == nil {
+		return false
+	}
+
+	close(link.stop)
+	if link.conn != nil {
+		link.conn.Close()
+	}
+
+	state.link = nil
+	atomic.StoreInt32(&state.following, 0)
+	return true
+}
+
+func (store *Store) promote() {
+	state := &store.replication
+	if state.id != "" {
+		state.secondaryID, state.secondaryOffset = state.id, state.offset
+	}
+	state.id = newReplicationID()
+
+	if state.backlog == nil {
+		store.createBacklog()
+	}
+
+	if state.count == 0 && state.backlogTimer == nil {
+		state.backlogTimer = time.AfterFunc(replicationBacklogTTL, store.freeBacklog)
+	}
+}
+
+func (store *Store) updateLink(link *leaderLink, status string, conn net.Conn) bool {
+	state := &store.replication
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.link != link {
+		return false
+	}
+
+	link.status = status
+	if conn != nil {
+		link.conn = conn
+	}
+
+	return true
+}
+
+func (store *Store) advanceReplication(link *leaderLink, data []byte) {
+	state := &store.replication
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.link != link {
+		return
+	}
+
+	if state.backlog == nil {
+		store.createBacklog()
+	}
+
+	state.offset += int64(len(data))
+	state.backlog.write(data)
+}
+
+func (store *Store) replicate(link *leaderLink) {
+	for {
+		err := store.syncWithLeader(link)
+		if link.stopped() {
+			return
+		}
+
+		log.Printf("Lost connection to leader %s: %v; retrying in %v", link.addr, err, replicationRetryInterval)
+		store.updateLink(link, LinkConnect, nil)
+
+		select {
+		case <-link.stop:
+			return
+		case <-time.After(replicationRetryInterval):
+		}
+	}
+}
+
+func (store *Store) syncWithLeader(link *leaderLink) error {
+	if !store.updateLink(link, LinkConnecting, nil) {
+		return errReplicationStopped
+	}
+
+	conn, err := net.DialTimeout("tcp", link.addr, replicationTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !store.updateLink(link, LinkSync, conn) {
+		return errReplicationStopped
+	}
+
+	info := store.Replication()
+	id, offset := info.ID, info.Offset
+	if id == "" {
+		id, offset = "?", -1
+	}
+
+	writer := NewRespWriter(conn)
+	writer.WriteValue([]string{"PSYNC", id, strconv.FormatInt(offset, 10)})
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	reader := NewRespReader(idleTimeoutReader{conn, replicationTimeout})
+	if err := store.readSyncReply(link, reader); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go store.ackLeader(writer, done)
+
+	intr := Interpreter{Store: store}.WithClient(NewLeaderClient(nil))
+	txn := intr.client.Transaction()
+
+	var applied bytes.Buffer
+	appliedWriter := NewRespWriter(&applied)
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		if _, err := intr.ExecArgs(args); err != nil {
+			log.Printf("Got the following error while applying %q from leader: %v", args[0], err)
+		}
+
+		appliedWriter.WriteValue(args)
+		if !txn.Active() {
+			appliedWriter.Flush()
+			store.advanceReplication(link, applied.Bytes())
+			applied.Reset()
+		}
+	}
+}
+
+type idleTimeoutReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (reader idleTimeoutReader) Read(buf []byte) (int, error) {
+	reader.conn.SetReadDeadline(time.Now().Add(reader.timeout))
+	return reader.conn.Read(buf)
+}
+
+func (store *Store) readSyncReply(link *leaderLink, reader *RespReader) error {
+	line, err := reader.readLine()
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(line)
+	switch {
+	case strings.HasPrefix(line, "-"):
+		return fmt.Errorf("leader replied: %s", line[1:])
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return protocolError("invalid replication offset %q", fields[2])
+		}
+
+		entries, err := readSyncSnapshot(reader)
+		if err != nil {
+			return err
+		}
+
+		return store.loadFromLeader(link, fields[1], offset, entries)
+	case len(fields) == 2 && fields[0] == "+CONTINUE":
+		return store.continueWithLeader(link, fields[1])
+	}
+
+	return protocolError("unexpected reply to PSYNC %q", line)
+}
+
+func readSyncSnapshot(reader *RespReader) ([]dumpEntry, error) {
+	line, err := reader.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "$EOF:") || len(line) != len("$EOF:")+syncMarkLength {
+		return nil, protocolError("unexpected snapshot header %q", line)
+	}
+
+	// readSnapshot reuses the bufio.Reader as is, so nothing past the snapshot is consumed.
+	entries, err := readSnapshot(reader.reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %v", err)
+	}
+
+	mark := make([]byte, syncMarkLength)
+	if _, err := io.ReadFull(reader.reader, mark); err != nil {
+		return nil, err
+	}
+
+	if string(mark) != line[len("$EOF:"):] {
+		return nil, protocolError("snapshot end mark mismatch")
+	}
+
+	return entries, nil
+}
+
+func (store *Store) loadFromLeader(link *leaderLink, id string, offset int64, entries []dumpEntry) error {
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	if !store.updateLink(link, LinkSync, nil) {
+		return errReplicationStopped
+	}
+
+	store.replaceDataset(entries)
+
+	state := &store.replication
+	state.mutex.Lock()
+	state.id, state.offset = id, offset
+	state.secondaryID, state.secondaryOffset = "", 0
+	store.createBacklog()
+	state.mutex.Unlock()
+
+	store.updateLink(link, LinkConnected, nil)
+
+	if atomic.LoadInt32(&store.aof.enabled) != 0 {
+		if err := store.bgRewriteAof(); err != nil {
+			log.Printf("Got the following error while rewriting the append only file after a full sync: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (store *Store) continueWithLeader(link *leaderLink, id string) error {
+	state := &store.replication
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.link != link {
+		return errReplicationStopped
+	}
+
+	if state.backlog == nil {
+		store.createBacklog()
+	}
+
+	state.id = id
+	link.status = LinkConnected
+	return nil
+}
+
+func (store *Store) replaceDataset(entries []dumpEntry) {
+	for index := range store.shards {
+		shard := store.lockShard(index)
+		for key, e := range shard.entries {
+			store.remove(key, e)
+		}
+		shard.mutex.Unlock()
+	}
+
+	now := time.Now().UnixNano()
+	for _, e := range entries {
+		if e.deadline != 0 && e.deadline <= now {
+			continue
+		}
+
+		unlock := store.LockKey(e.key)
+		store.put(e.key, e.value, e.deadline)
+		unlock()
+	}
+}
+
+func (store *Store) ackLeader(writer *RespWriter, done <-chan struct{}) {
+	ticker := time.NewTicker(replicationAckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		offset := store.Replication().Offset
+		writer.WriteValue([]string{"REPLCONF", "ACK", strconv.FormatInt(offset, 10)})
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
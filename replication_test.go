@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitForReplication(t *testing.T, description string, condition func() bool) {
+	for start := time.Now(); !condition(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected %s", description)
+		}
+	}
+}
+
+func waitForLink(t *testing.T, store *Store, status string) {
+	waitForReplication(t, "link status "+status, func() bool {
+		return store.Replication().LinkStatus == status
+	})
+}
+
+func dropLeaderLink(store *Store) {
+	store.replication.mutex.Lock()
+	defer store.replication.mutex.Unlock()
+
+	store.replication.link.conn.Close()
+}
+
+func startLeaderTestAux(t *testing.T, backlogSize int) (*Store, Interpreter, net.Listener) {
+	store := new(Store)
+	store.replication.backlogSize = backlogSize
+
+	return store, Interpreter{Store: store}.WithClient(NewClient(nil)), startRespServer(t, store)
+}
+
+func TestReplication(t *testing.T) {
+	leader := new(Store)
+	listener := startRespServer(t, leader)
+	defer listener.Close()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	leaderIntr := Interpreter{Store: leader}.WithClient(NewClient(nil))
+
+	leaderIntr.Exec("SET before 1")
+	leaderIntr.Exec("RPUSH list a b")
+	leaderIntr.Exec("SET volatile value EX 100")
+
+	follower := new(Store)
+	followerIntr := Interpreter{Store: follower}.WithClient(NewClient(nil))
+	defer follower.StopReplication()
+
+	follower.Set("stale", "value")
+
+	t.Run("full sync from leader", func(t *testing.T) {
+		assertExec(t, followerIntr, execTestAux{"REPLICAOF " + host + " " + port, 0, true})
+		waitForLink(t, follower, LinkConnected)
+
+		assertInterface(t, 3, follower.DbSize())
+		assertGet(t, follower, "before", "1", true, false)
+		assertGet(t, follower, "stale", "", false, false)
+
+		_, _, volatile := follower.Deadline("volatile")
+		assertInterface(t, true, volatile)
+	})
+
+	t.Run("stream write commands", func(t *testing.T) {
+		waitForReplication(t, "follower to be attached", func() bool {
+			return len(leader.Replication().Followers) == 1
+		})
+
+		leaderIntr.Exec("INCR before")
+		leaderIntr.Exec("MULTI")
+		leaderIntr.Exec("LPUSH list z")
+		leaderIntr.Exec("SADD set m")
+		leaderIntr.Exec("EXEC")
+		leaderIntr.Exec("BLPOP list 0")
+		leaderIntr.Exec("SET after done")
+
+		waitForReplication(t, "write commands to be applied", func() bool {
+			value, _, _ := follower.Get("after")
+			return value == "done"
+		})
+
+		assertGet(t, follower, "before", "2", true, false)
+
+		values, _ := follower.LRange("list", 0, -1)
+		assertInterface(t, []string{"a", "b"}, values)
+
+		isMember, _ := follower.SIsMember("set", "m")
+		assertInterface(t, true, isMember)
+	})
+
+	t.Run("reject writes on follower", func(t *testing.T) {
+		_, err := followerIntr.Exec("SET key value")
+		assertInterface(t, ReadOnlyError{}, err)
+		assertInterface(t, "READONLY You can't write against a read only replica.", respErrorMessage(err))
+
+		followerIntr.Exec("MULTI")
+		followerIntr.Exec("DEL before")
+		_, err = followerIntr.Exec("EXEC")
+		assertInterface(t, ExecAbortError{}, err)
+
+		assertExec(t, followerIntr, execTestAux{"GET before", 0, "2"})
+	})
+
+	t.Run("expose offsets and link status", func(t *testing.T) {
+		offset := leader.Replication().Offset
+		if offset == 0 {
+			t.Fatalf("expected leader offset to advance")
+		}
+
+		waitForReplication(t, "follower to acknowledge the leader offset", func() bool {
+			followers := leader.Replication().Followers
+			return len(followers) == 1 && followers[0].Offset == offset
+		})
+
+		num, _ := strconv.Atoi(port)
+		assertExec(t, followerIntr, execTestAux{"ROLE", 0, []interface{}{"slave", host, num, LinkConnected, offset}})
+
+		role, _ := leaderIntr.Exec("ROLE")
+		followers := role.([]interface{})[2].([]interface{})
+		assertInterface(t, 1, len(followers))
+		assertInterface(t, strconv.FormatInt(offset, 10), followers[0].([]string)[2])
+	})
+
+	t.Run("continue from the backlog after losing the link", func(t *testing.T) {
+		follower.Set("marker", "kept")
+		dropLeaderLink(follower)
+
+		waitForReplication(t, "previous follower to be detached", func() bool {
+			return len(leader.Replication().Followers) == 0
+		})
+
+		leaderIntr.Exec("SET during resync")
+		waitForLink(t, follower, LinkConnected)
+
+		waitForReplication(t, "write to be replicated", func() bool {
+			value, _, _ := follower.Get("during")
+			return value == "resync"
+		})
+
+		assertGet(t, follower, "marker", "kept", true, false)
+		assertInterface(t, leader.Replication().ID, follower.Replication().ID)
+		assertInterface(t, leader.Replication().Offset, follower.Replication().Offset)
+	})
+
+	t.Run("promote follower", func(t *testing.T) {
+		assertExec(t, followerIntr, execTestAux{"REPLICAOF NO ONE", 0, true})
+		assertExec(t, followerIntr, execTestAux{"SET key value", 0, true})
+		assertExec(t, followerIntr, execTestAux{"ROLE", 0, []interface{}{"master", follower.Replication().Offset, []interface{}{}}})
+
+		waitForReplication(t, "follower to be detached", func() bool {
+			return len(leader.Replication().Followers) == 0
+		})
+
+		leaderIntr.Exec("SET after promotion")
+		assertGet(t, follower, "after", "done", true, false)
+	})
+
+	t.Run("reject invalid leader port", func(t *testing.T) {
+		if _, err := followerIntr.Exec("REPLICAOF localhost port"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestPartialResync(t *testing.T) {
+	t.Run("fall back to full sync when the backlog was overrun", func(t *testing.T) {
+		leader, leaderIntr, listener := startLeaderTestAux(t, 64)
+		defer listener.Close()
+
+		follower := new(Store)
+		defer follower.StopReplication()
+
+		follower.ReplicaOf(listener.Addr().String())
+		waitForLink(t, follower, LinkConnected)
+
+		follower.Set("marker", "lost")
+		dropLeaderLink(follower)
+
+		waitForReplication(t, "follower to be detached", func() bool {
+			return len(leader.Replication().Followers) == 0
+		})
+
+		for index := 0; index < 10; index++ {
+			leaderIntr.Exec("INCR counter")
+		}
+
+		waitForReplication(t, "full sync", func() bool {
+			value, _, _ := follower.Get("counter")
+			return value == "10"
+		})
+
+		assertGet(t, follower, "marker", "", false, false)
+		assertInterface(t, leader.Replication().Offset, follower.Replication().Offset)
+	})
+
+	t.Run("continue with a promoted follower", func(t *testing.T) {
+		leader, leaderIntr, listener := startLeaderTestAux(t, 0)
+		defer listener.Close()
+
+		promoted := new(Store)
+		promotedListener := startRespServer(t, promoted)
+		defer promotedListener.Close()
+		defer promoted.StopReplication()
+
+		sibling := new(Store)
+		defer sibling.StopReplication()
+
+		promoted.ReplicaOf(listener.Addr().String())
+		sibling.ReplicaOf(listener.Addr().String())
+		waitForLink(t, promoted, LinkConnected)
+		waitForLink(t, sibling, LinkConnected)
+
+		leaderIntr.Exec("SET key value")
+		waitForReplication(t, "followers to catch up", func() bool {
+			offset := leader.Replication().Offset
+			return promoted.Replication().Offset == offset && sibling.Replication().Offset == offset
+		})
+
+		leaderID := leader.Replication().ID
+		promoted.StopReplication()
+		assertInterface(t, false, promoted.Replication().ID == leaderID)
+
+		promotedIntr := Interpreter{Store: promoted}.WithClient(NewClient(nil))
+		promotedIntr.Exec("SET promoted yes")
+
+		sibling.Set("marker", "kept")
+		sibling.ReplicaOf(promotedListener.Addr().String())
+		waitForReplication(t, "sibling to follow the promoted leader", func() bool {
+			value, _, _ := sibling.Get("promoted")
+			return value == "yes"
+		})
+
+		assertGet(t, sibling, "marker", "kept", true, false)
+		assertInterface(t, promoted.Replication().ID, sibling.Replication().ID)
+	})
+}
+
+func TestSyncSnapshot(t *testing.T) {
+	t.Run("stream snapshot followed by commands", func(t *testing.T) {
+		store, intr, listener := startLeaderTestAux(t, 0)
+		defer listener.Close()
+
+		large := strings.Repeat("x", 64*1024)
+		for index := 0; index < 100; index++ {
+			intr.Exec("SET key:" + strconv.Itoa(index) + " " + large)
+		}
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("SYNC\r\n"))
+		reader := NewRespReader(conn)
+
+		entries, err := readSyncSnapshot(reader)
+		if err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+		assertInterface(t, 100, len(entries))
+
+		waitForReplication(t, "follower to be attached", func() bool {
+			return len(store.Replication().Followers) == 1
+		})
+
+		intr.Exec("SET after 1")
+		args, _ := reader.ReadCommand()
+		assertInterface(t, []string{"SET", "after", "1"}, args)
+	})
+
+	t.Run("reject mismatched end mark", func(t *testing.T) {
+		var payload bytes.Buffer
+		store := new(Store)
+		store.Set("key", "value")
+		store.encodeSnapshot(&payload, store.beginDump())
+
+		mark := strings.Repeat("a", syncMarkLength)
+		input := "$EOF:" + mark + "\r\n" + payload.String() + strings.Repeat("b", syncMarkLength)
+
+		_, err := readSyncSnapshot(&RespReader{bufio.NewReader(strings.NewReader(input))})
+		assertInterface(t, ProtocolError{"snapshot end mark mismatch"}, err)
+
+		_, err = readSyncSnapshot(&RespReader{bufio.NewReader(strings.NewReader("$12\r\n"))})
+		assertInterface(t, ProtocolError{`unexpected snapshot header "$12"`}, err)
+	})
+}
+
+func TestReplicationBacklog(t *testing.T) {
+	backlog := newReplicationBacklog(8, 100)
+
+	data, ok := backlog.since(100)
+	assertInterface(t, true, ok)
+	assertInterface(t, []byte{}, data)
+
+	backlog.write([]byte("abcdef"))
+	backlog.write([]byte("ghij"))
+	assertInterface(t, int64(102), backlog.start())
+
+	data, _ = backlog.since(104)
+	assertInterface(t, "efghij", string(data))
+
+	_, ok = backlog.since(101)
+	assertInterface(t, false, ok)
+
+	_, ok = backlog.since(111)
+	assertInterface(t, false, ok)
+
+	backlog.write([]byte("0123456789"))
+	data, _ = backlog.since(backlog.start())
+	assertInterface(t, "23456789", string(data))
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLength      = 512 * 1024 * 1024
+	maxMultiBulkLength = 1024 * 1024
+	maxInlineLength    = 64 * 1024
+)
+
+type ProtocolError struct {
+	message string
+}
+
+func (err ProtocolError) Error() string {
+	return fmt.Sprintf("miniredis: protocol error: %s", err.message)
+}
+
+func protocolError(format string, args ...interface{}) error {
+	return ProtocolError{fmt.Sprintf(format, args...)}
+}
+
+type RespReader struct {
+	reader *bufio.Reader
+}
+
+func NewRespReader(reader io.Reader) *RespReader {
+	return &RespReader{bufio.NewReader(reader)}
+}
+
+func (resp *RespReader) Buffered() int {
+	return resp.reader.Buffered()
+}
+
+func (resp *RespReader) ReadCommand() ([]string, error) {
+	prefix, err := resp.reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix[0] == '*' {
+		return resp.readMultiBulk()
+	}
+
+	return resp.readInline()
+}
+
+func (resp *RespReader) readMultiBulk() ([]string, error) {
+	line, err := resp.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	switch {
+	case err != nil:
+		return nil, protocolError("invalid multibulk length %q", line[1:])
+	case count > maxMultiBulkLength:
+		return nil, protocolError("multibulk length %d exceeds limit", count)
+	case count <= 0:
+		return []string{}, nil
+	}
+
+	args := make([]string, count)
+	for index := range args {
+		if args[index], err = resp.readBulk(); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
+
+func (resp *RespReader) readBulk() (string, error) {
+	line, err := resp.readLine()
+	if err != nil {
+		return "", err
+	}
+
+	return resp.readBulkBody(line)
+}
+
+func (resp *RespReader) readBulkBody(line string) (string, error) {
+	if line == "" || line[0] != '$' {
+		return "", protocolError("expected '$', got %q", line)
+	}
+
+	length, err := strconv.Atoi(line[1:])
+	switch {
+	case err != nil || length < 0:
+		return "", protocolError("invalid bulk length %q", line[1:])
+	case length > maxBulkLength:
+		return "", protocolError("bulk length %d exceeds limit", length)
+	}
+
+	buf := make([]byte, length+2)
+	if _, err := io.ReadFull(resp.reader, buf); err != nil {
+		return "", unexpectedEOF(err)
+	}
+
+	if buf[length] != '\r' || buf[length+1] != '\n' {
+		return "", protocolError("bulk string is not terminated by CRLF")
+	}
+
+	return string(buf[:length]), nil
+}
+
+func (resp *RespReader) readInline() ([]string, error) {
+	line, err := resp.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := Tokenize(line)
+	if err != nil {
+		return nil, protocolError("%s", strings.TrimPrefix(err.Error(), "miniredis: "))
+	}
+
+	return args, nil
+}
+
+func (resp *RespReader) readLine() (string, error) {
+	var builder strings.Builder
+	for {
+		chunk, isPrefix, err := resp.reader.ReadLine()
+		if err != nil {
+			if builder.Len() > 0 {
+				return "", unexpectedEOF(err)
+			}
+			return "", err
+		}
+
+		if builder.Len()+len(chunk) > maxInlineLength {
+			return "", protocolError("line exceeds %d bytes", maxInlineLength)
+		}
+
+		builder.Write(chunk)
+		if !isPrefix {
+			break
+		}
+	}
+
+	return builder.String(), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+type RespWriter struct {
+	writer *bufio.Writer
+}
+
+func NewRespWriter(writer io.Writer) *RespWriter {
+	return &RespWriter{bufio.NewWriter(writer)}
+}
+
+func (resp *RespWriter) Flush() error {
+	return resp.writer.Flush()
+}
+
+type MultiReply []interface{}
+
+type SimpleString string
+
+type NullArray struct{}
+
+func (NullArray) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func (resp *RespWriter) WriteValue(value interface{}) error {
+	switch typed := value.(type) {
+	case nil:
+		return resp.writeRaw("$-1\r\n")
+	case bool:
+		if typed {
+			return resp.WriteSimpleString("OK")
+		}
+		return resp.writeRaw("$-1\r\n")
+	case int:
+		return resp.WriteInteger(int64(typed))
+	case int64:
+		return resp.WriteInteger(typed)
+	case string:
+		return resp.WriteBulk(typed)
+	case SimpleString:
+		return resp.WriteSimpleString(string(typed))
+	case NullArray:
+		return resp.writeRaw("*-1\r\n")
+	case []byte:
+		return resp.WriteBulk(string(typed))
+	case float64:
+		return resp.WriteBulk(formatFloat(typed))
+	case error:
+		return resp.WriteError(typed)
+	case []string:
+		if err := resp.writeArrayHeader(len(typed)); err != nil {
+			return err
+		}
+		for _, item := range typed {
+			if err := resp.WriteBulk(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case MultiReply:
+		for _, item := range typed {
+			if err := resp.WriteValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if err := resp.writeArrayHeader(len(typed)); err != nil {
+			return err
+		}
+		for _, item := range typed {
+			if err := resp.WriteValue(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return resp.WriteBulk(fmt.Sprint(typed))
+	}
+}
+
+func (resp *RespWriter) WriteSimpleString(str string) error {
+	return resp.writeRaw("+" + str + "\r\n")
+}
+
+func (resp *RespWriter) WriteError(err error) error {
+	return resp.writeRaw("-" + respErrorMessage(err) + "\r\n")
+}
+
+func (resp *RespWriter) WriteInteger(num int64) error {
+	return resp.writeRaw(":" + strconv.FormatInt(num, 10) + "\r\n")
+}
+
+func (resp *RespWriter) WriteBulk(str string) error {
+	if err := resp.writeRaw("$" + strconv.Itoa(len(str)) + "\r\n"); err != nil {
+		return err
+	}
+	if err := resp.writeRaw(str); err != nil {
+		return err
+	}
+
+	return resp.writeRaw("\r\n")
+}
+
+func (resp *RespWriter) writeArrayHeader(length int) error {
+	return resp.writeRaw("*" + strconv.Itoa(length) + "\r\n")
+}
+
+func (resp *RespWriter) writeRaw(str string) error {
+	_, err := resp.writer.WriteString(str)
+	return err
+}
+
+func respErrorMessage(err error) string {
+	message := strings.TrimPrefix(err.Error(), "miniredis: ")
+	message = strings.NewReplacer("\r", " ", "\n", " ").Replace(message)
+
+	switch typed := err.(type) {
+	case ProtocolError:
+		return "ERR Protocol error: " + typed.message
+	case WrongTypeError:
+		return "WRONGTYPE Operation against a key holding the wrong kind of value"
+	case ExecAbortError:
+		return "EXECABORT " + message
+	case ReadOnlyError:
+		return "READONLY " + message
+	case OutOfMemoryError:
+		return "OOM " + message
+	}
+
+	return "ERR " + message
+}
+
+func formatFloat(num float64) string {
+	switch {
+	case math.IsInf(num, 1):
+		return "inf"
+	case math.IsInf(num, -1):
+		return "-inf"
+	}
+
+	return strconv.FormatFloat(num, 'g', -1, 64)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RespServer struct {
+	Interpreter
+}
+
+func (server RespServer) Serve(listener net.Listener) error {
+	defer listener.Close()
+
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+
+				log.Printf("Got the following error while accepting connection: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+
+			return err
+		}
+
+		delay = 0
+		go server.handleConn(conn)
+	}
+}
+
+func (server RespServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	done, stop := make(chan struct{}), make(chan struct{})
+	commands := make(chan []string, 64)
+	defer close(stop)
+
+	subscriber := NewSubscriber(defaultSubscriberBuffer)
+	intr := server.WithClient(NewSubscriberClient(done, subscriber))
+	defer intr.Disconnect()
+	writer := NewRespWriter(conn)
+
+	var follower *Follower
+	defer func() {
+		server.detachFollower(follower)
+	}()
+
+	var readErr error
+	go func() {
+		defer close(done)
+		defer close(commands)
+
+		reader := NewRespReader(conn)
+		for {
+			args, err := reader.ReadCommand()
+			if err != nil {
+				readErr = err
+				return
+			}
+
+			if len(args) == 0 {
+				continue
+			}
+
+			select {
+			case commands <- args:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+loop:
+	for {
+		quit := false
+
+		select {
+		case args, ok := <-commands:
+			if !ok {
+				break loop
+			}
+
+			switch strings.ToUpper(args[0]) {
+			case "QUIT":
+				quit = true
+				writer.WriteSimpleString("OK")
+			case "SYNC", "PSYNC":
+				if follower == nil {
+					follower = server.sync(conn, writer, args)
+				}
+			case "REPLCONF":
+				server.replConf(follower, writer, args)
+			default:
+				exec(intr, writer, args)
+			}
+		case message := <-subscriber.Messages():
+			writer.WriteValue(message.Reply())
+		case <-subscriber.Evicted():
+			log.Printf("Closing connection to %v: subscriber output buffer limit reached", conn.RemoteAddr())
+			return
+		case data := <-follower.Stream():
+			writer.writeRaw(string(data))
+		case <-follower.Evicted():
+			return
+		}
+
+		if quit || (len(commands) == 0 && len(subscriber.Messages()) == 0 && len(follower.Stream()) == 0) {
+			if err := writer.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+
+	if _, ok := readErr.(ProtocolError); ok {
+		writer.WriteError(readErr)
+		writer.Flush()
+	} else if readErr != io.EOF && !isClosedConnError(readErr) {
+		log.Printf("Got the following error while reading from %v: %v", conn.RemoteAddr(), readErr)
+	}
+}
+
+func (server RespServer) sync(conn net.Conn, writer *RespWriter, args []string) *Follower {
+	psync := strings.ToUpper(args[0]) == "PSYNC"
+	if psync && len(args) != 3 || !psync && len(args) != 1 {
+		writer.WriteError(arityError(strings.ToLower(args[0])))
+		return nil
+	}
+
+	id, offset := "?", int64(-1)
+	if psync {
+		var err error
+		if offset, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			writer.WriteError(fmt.Errorf("miniredis: value is not an integer or out of range"))
+			return nil
+		}
+		id = args[1]
+	}
+
+	follower, sync, err := server.attachFollower(conn.RemoteAddr().String(), id, offset)
+	if err != nil {
+		writer.WriteError(err)
+		return nil
+	}
+
+	if sync.partial {
+		writer.WriteSimpleString("CONTINUE " + sync.id)
+		writer.writeRaw(string(sync.backlog))
+		return follower
+	}
+
+	if psync {
+		writer.WriteSimpleString(fmt.Sprintf("FULLRESYNC %s %d", sync.id, sync.offset))
+	}
+
+	mark := newReplicationID()
+	writer.writeRaw("$EOF:" + mark + "\r\n")
+	if err := server.encodeSnapshot(writer.writer, sync.dump); err != nil {
+		log.Printf("Closing connection to %v: could not stream snapshot: %v", conn.RemoteAddr(), err)
+		server.detachFollower(follower)
+		conn.Close()
+		return nil
+	}
+
+	writer.writeRaw(mark)
+	return follower
+}
+
+func (server RespServer) replConf(follower *Follower, writer *RespWriter, args []string) {
+	if len(args) == 3 && strings.ToUpper(args[1]) == "ACK" {
+		if offset, err := strconv.ParseInt(args[2], 10, 64); err == nil {
+			server.ackFollower(follower, offset)
+		}
+		return
+	}
+
+	writer.WriteSimpleString("OK")
+}
+
+func exec(intr Interpreter, writer *RespWriter, args []string) {
+	if value, err := intr.ExecArgs(args); err == nil {
+		writer.WriteValue(value)
+	} else {
+		writer.WriteError(err)
+	}
+}
+
+func isClosedConnError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "use of closed network connection")
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startRespServer(t *testing.T, store *Store) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+
+	server := RespServer{Interpreter{Store: store}}
+	go server.Serve(listener)
+
+	return listener
+}
+
+func dialRespServer(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	return conn, bufio.NewReader(conn)
+}
+
+func assertRespReply(t *testing.T, reader *bufio.Reader, expected string) {
+	buf := make([]byte, len(expected))
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+
+	if actual := string(buf); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRespServer(t *testing.T) {
+	store := new(Store)
+	listener := startRespServer(t, store)
+	defer listener.Close()
+
+	addr := listener.Addr().String()
+	conn, reader := dialRespServer(t, addr)
+	defer conn.Close()
+
+	t.Run("set and get key", func(t *testing.T) {
+		conn.Write([]byte("*3\r\n$3\r\nset\r\n$3\r\nfoo\r\n$3\r\nbar\r\n"))
+		assertRespReply(t, reader, "+OK\r\n")
+
+		conn.Write([]byte("*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"))
+		assertRespReply(t, reader, "$3\r\nbar\r\n")
+	})
+
+	t.Run("set and get binary values", func(t *testing.T) {
+		value := "\x00\r\n\xff" + strings.Repeat("v", 3*1024*1024)
+		conn.Write([]byte(fmt.Sprintf("*3\r\n$3\r\nSET\r\n$4\r\nk\x00\r\n\r\n$%d\r\n%s\r\n", len(value), value)))
+		assertRespReply(t, reader, "+OK\r\n")
+
+		conn.Write([]byte("*2\r\n$3\r\nGET\r\n$4\r\nk\x00\r\n\r\n"))
+		assertRespReply(t, reader, fmt.Sprintf("$%d\r\n%s\r\n", len(value), value))
+	})
+
+	t.Run("get non existing key", func(t *testing.T) {
+		conn.Write([]byte("*2\r\n$3\r\nGET\r\n$4\r\nfizz\r\n"))
+		assertRespReply(t, reader, "$-1\r\n")
+	})
+
+	t.Run("send pipelined commands in pieces", func(t *testing.T) {
+		input := "*2\r\n$4\r\nINCR\r\n$3\r\nctr\r\n*2\r\n$4\r\nINCR\r\n$3\r\nctr\r\nPING\r\n"
+		for index := range input {
+			conn.Write([]byte{input[index]})
+		}
+
+		assertRespReply(t, reader, ":1\r\n:2\r\n$4\r\nPONG\r\n")
+	})
+
+	t.Run("get sorted set range", func(t *testing.T) {
+		conn.Write([]byte("*4\r\n$4\r\nZADD\r\n$1\r\nz\r\n$1\r\n1\r\n$3\r\none\r\n"))
+		assertRespReply(t, reader, ":1\r\n")
+
+		conn.Write([]byte("*4\r\n$6\r\nZRANGE\r\n$1\r\nz\r\n$1\r\n0\r\n$1\r\n0\r\n"))
+		assertRespReply(t, reader, "*1\r\n$3\r\none\r\n")
+	})
+
+	t.Run("execute invalid command", func(t *testing.T) {
+		conn.Write([]byte("*1\r\n$3\r\nSEY\r\n"))
+		line, _ := reader.ReadString('\n')
+		if !strings.HasPrefix(line, "-ERR ") {
+			t.Errorf("expected error reply, got %q", line)
+		}
+	})
+
+	t.Run("quit connection", func(t *testing.T) {
+		conn.Write([]byte("*1\r\n$4\r\nQUIT\r\n"))
+		assertRespReply(t, reader, "+OK\r\n")
+
+		if _, err := reader.ReadByte(); err == nil {
+			t.Errorf("expected connection to be closed")
+		}
+	})
+
+	t.Run("handle protocol error", func(t *testing.T) {
+		conn, reader := dialRespServer(t, addr)
+		defer conn.Close()
+
+		conn.Write([]byte("*1\r\n$x\r\n"))
+
+		line, _ := reader.ReadString('\n')
+		if !strings.HasPrefix(line, "-ERR Protocol error") {
+			t.Errorf("expected protocol error reply, got %q", line)
+		}
+	})
+
+	t.Run("serve multiple clients concurrently", func(t *testing.T) {
+		done := make(chan bool)
+		for x := 0; x < 10; x++ {
+			go func() {
+				defer func() { done <- true }()
+
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					t.Errorf("expected nil, got %q", err)
+					return
+				}
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				for y := 0; y < 100; y++ {
+					conn.Write([]byte("*2\r\n$4\r\nINCR\r\n$6\r\nshared\r\n"))
+					if line, err := reader.ReadString('\n'); err != nil || line[0] != ':' {
+						t.Errorf("expected integer reply, got %q (%v)", line, err)
+						return
+					}
+				}
+			}()
+		}
+
+		for x := 0; x < 10; x++ {
+			<-done
+		}
+
+		assertGet(t, store, "shared", "1000", true, false)
+	})
+}
+
+func TestRespServerBlockingPop(t *testing.T) {
+	store := new(Store)
+	listener := startRespServer(t, store)
+	defer listener.Close()
+
+	addr := listener.Addr().String()
+
+	t.Run("block until another client pushes", func(t *testing.T) {
+		conn, reader := dialRespServer(t, addr)
+		defer conn.Close()
+
+		conn.Write([]byte("*3\r\n$5\r\nBLPOP\r\n$5\r\nqueue\r\n$1\r\n0\r\n"))
+		waitForWaiters(t, store, 1)
+
+		store.RPush("queue", "job")
+		assertRespReply(t, reader, "*2\r\n$5\r\nqueue\r\n$3\r\njob\r\n")
+	})
+
+	t.Run("reply nil on timeout", func(t *testing.T) {
+		conn, reader := dialRespServer(t, addr)
+		defer conn.Close()
+
+		conn.Write([]byte("*3\r\n$5\r\nBRPOP\r\n$5\r\nqueue\r\n$4\r\n0.01\r\n"))
+		assertRespReply(t, reader, "$-1\r\n")
+	})
+
+	t.Run("disconnected client does not consume values", func(t *testing.T) {
+		conn, _ := dialRespServer(t, addr)
+		conn.Write([]byte("*3\r\n$5\r\nBLPOP\r\n$5\r\nqueue\r\n$1\r\n0\r\n"))
+		waitForWaiters(t, store, 1)
+
+		conn.Close()
+		waitForWaiters(t, store, 0)
+
+		store.RPush("queue", "job")
+		count, _ := store.LLen("queue")
+		assertInterface(t, 1, count)
+	})
+}
+
+func TestRespServerPubSub(t *testing.T) {
+	store := new(Store)
+	listener := startRespServer(t, store)
+	defer listener.Close()
+
+	conn, reader := dialRespServer(t, listener.Addr().String())
+	defer conn.Close()
+
+	conn.Write([]byte("SUBSCRIBE news\r\nPSUBSCRIBE s*\r\n"))
+	assertRespReply(t, reader, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	assertRespReply(t, reader, "*3\r\n$10\r\npsubscribe\r\n$2\r\ns*\r\n:2\r\n")
+
+	store.Publish("news", "hello")
+	assertRespReply(t, reader, "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+
+	store.Publish("sports", "goal")
+	assertRespReply(t, reader, "*4\r\n$8\r\npmessage\r\n$2\r\ns*\r\n$6\r\nsports\r\n$4\r\ngoal\r\n")
+
+	conn.Write([]byte("GET news\r\nPING\r\n"))
+	assertRespReply(t, reader, "-ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+	assertRespReply(t, reader, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+
+	conn.Write([]byte("UNSUBSCRIBE\r\nPUNSUBSCRIBE\r\nECHO done\r\n"))
+	assertRespReply(t, reader, "*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	assertRespReply(t, reader, "*3\r\n$12\r\npunsubscribe\r\n$2\r\ns*\r\n:0\r\n")
+	assertRespReply(t, reader, "$4\r\ndone\r\n")
+
+	conn.Write([]byte("SUBSCRIBE news\r\n"))
+	assertRespReply(t, reader, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	conn.Close()
+
+	for start := time.Now(); store.PubSubNumSub("news")[0] != 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected subscriptions to be released on disconnect")
+		}
+	}
+}
+
+func TestRespServerTransaction(t *testing.T) {
+	store := new(Store)
+	listener := startRespServer(t, store)
+	defer listener.Close()
+
+	conn, reader := dialRespServer(t, listener.Addr().String())
+	defer conn.Close()
+
+	conn.Write([]byte("MULTI\r\nSET a 1\r\nHSET a f v\r\nEXEC\r\n"))
+	assertRespReply(t, reader, "+OK\r\n+QUEUED\r\n+QUEUED\r\n")
+	assertRespReply(t, reader, "*2\r\n+OK\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+
+	conn.Write([]byte("MULTI\r\nSET a\r\nEXEC\r\n"))
+	assertRespReply(t, reader, "+OK\r\n-ERR wrong number of arguments for \"set\" command\r\n")
+	assertRespReply(t, reader, "-EXECABORT Transaction discarded because of previous errors.\r\n")
+
+	conn.Write([]byte("WATCH a\r\n"))
+	assertRespReply(t, reader, "+OK\r\n")
+
+	store.Set("a", "2")
+
+	conn.Write([]byte("MULTI\r\nGET a\r\nEXEC\r\n"))
+	assertRespReply(t, reader, "+OK\r\n+QUEUED\r\n*-1\r\n")
+}
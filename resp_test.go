@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRespReaderReadCommand(t *testing.T) {
+	t.Run("read multibulk command", func(t *testing.T) {
+		reader := NewRespReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n"))
+		assertReadCommand(t, reader, []string{"SET", "foo", "bar"})
+	})
+
+	t.Run("read inline command", func(t *testing.T) {
+		reader := NewRespReader(strings.NewReader("GET  foo\r\n"))
+		assertReadCommand(t, reader, []string{"GET", "foo"})
+	})
+
+	t.Run("read pipelined commands", func(t *testing.T) {
+		reader := NewRespReader(strings.NewReader("*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\nx\r\n"))
+		assertReadCommand(t, reader, []string{"PING"})
+		assertReadCommand(t, reader, []string{"GET", "x"})
+
+		if _, err := reader.ReadCommand(); err != io.EOF {
+			t.Errorf("expected EOF, got %v", err)
+		}
+	})
+
+	t.Run("read command from partial reads", func(t *testing.T) {
+		input := "*2\r\n$4\r\nECHO\r\n$11\r\nhello world\r\n"
+		reader := NewRespReader(iotest.OneByteReader(strings.NewReader(input)))
+		assertReadCommand(t, reader, []string{"ECHO", "hello world"})
+	})
+
+	t.Run("read large bulk payload", func(t *testing.T) {
+		payload := strings.Repeat("x", 4*1024*1024)
+		input := "*2\r\n$4\r\nECHO\r\n$4194304\r\n" + payload + "\r\n"
+		reader := NewRespReader(iotest.HalfReader(strings.NewReader(input)))
+		assertReadCommand(t, reader, []string{"ECHO", payload})
+	})
+
+	t.Run("read bulk containing CRLF", func(t *testing.T) {
+		reader := NewRespReader(strings.NewReader("*1\r\n$4\r\na\r\nb\r\n"))
+		assertReadCommand(t, reader, []string{"a\r\nb"})
+	})
+
+	t.Run("read truncated command", func(t *testing.T) {
+		reader := NewRespReader(strings.NewReader("*2\r\n$3\r\nGET\r\n$3\r\nfo"))
+		if _, err := reader.ReadCommand(); err != io.ErrUnexpectedEOF {
+			t.Errorf("expected unexpected EOF, got %v", err)
+		}
+	})
+
+	t.Run("read invalid commands", func(t *testing.T) {
+		inputs := []string{
+			"*x\r\n",
+			"*1\r\n:3\r\n",
+			"*1\r\n$-2\r\n",
+			"*1\r\n$3\r\nfoobar\r\n",
+		}
+
+		for _, input := range inputs {
+			reader := NewRespReader(strings.NewReader(input))
+			if _, err := reader.ReadCommand(); err == nil {
+				t.Errorf("expected error for %q, got nil", input)
+			} else if _, ok := err.(ProtocolError); !ok {
+				t.Errorf("expected protocol error for %q, got %v", input, err)
+			}
+		}
+	})
+}
+
+func assertReadCommand(t *testing.T, reader *RespReader, expected []string) {
+	if args, err := reader.ReadCommand(); err == nil {
+		assertInterface(t, expected, args)
+	} else {
+		t.Errorf("expected nil, got %q", err)
+	}
+}
+
+type respWriterTestAux struct {
+	value    interface{}
+	expected string
+}
+
+func TestRespWriterWriteValue(t *testing.T) {
+	t.Run("write multiple values", func(t *testing.T) {
+		tests := []respWriterTestAux{
+			{nil, "$-1\r\n"},
+			{true, "+OK\r\n"},
+			{false, "$-1\r\n"},
+			{42, ":42\r\n"},
+			{"bar", "$3\r\nbar\r\n"},
+			{"", "$0\r\n\r\n"},
+			{1.5, "$3\r\n1.5\r\n"},
+			{errors.New("miniredis: bad\r\nthing"), "-ERR bad  thing\r\n"},
+			{WrongTypeError{"foo", "hash"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+			{[]string{"a", "bc"}, "*2\r\n$1\r\na\r\n$2\r\nbc\r\n"},
+			{[]string{}, "*0\r\n"},
+			{NullArray{}, "*-1\r\n"},
+			{[]interface{}{1, nil, []string{"x"}}, "*3\r\n:1\r\n$-1\r\n*1\r\n$1\r\nx\r\n"},
+		}
+
+		for _, te := range tests {
+			buf := new(bytes.Buffer)
+			writer := NewRespWriter(buf)
+			writer.WriteValue(te.value)
+			writer.Flush()
+
+			assertInterface(t, te.expected, buf.String())
+		}
+	})
+}
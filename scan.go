@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+)
+
+const defaultScanCount = 10
+
+type scanOrder struct {
+	slots []scanSlot
+	seqs  map[string]uint64
+	last  uint64
+	holes int
+}
+
+type scanSlot struct {
+	seq     uint64
+	member  string
+	removed bool
+}
+
+func makeScanOrder() scanOrder {
+	return scanOrder{seqs: make(map[string]uint64)}
+}
+
+func (order *scanOrder) clone() scanOrder {
+	clone := scanOrder{
+		make([]scanSlot, 0, len(order.slots)-order.holes),
+		make(map[string]uint64, len(order.seqs)),
+		order.last,
+		0,
+	}
+
+	for _, slot := range order.slots {
+		if !slot.removed {
+			clone.slots = append(clone.slots, slot)
+			clone.seqs[slot.member] = slot.seq
+		}
+	}
+
+	return clone
+}
+
+func (order *scanOrder) add(member string) {
+	order.last++
+	order.seqs[member] = order.last
+	order.slots = append(order.slots, scanSlot{seq: order.last, member: member})
+}
+
+func (order *scanOrder) remove(member string) {
+	seq, ok := order.seqs[member]
+	if !ok {
+		return
+	}
+
+	delete(order.seqs, member)
+	order.slots[order.search(seq)] = scanSlot{seq: seq, removed: true}
+	order.holes++
+
+	if order.holes > len(order.slots)/2 {
+		order.compact()
+	}
+}
+
+func (order *scanOrder) compact() {
+	live := order.slots[:0]
+	for _, slot := range order.slots {
+		if !slot.removed {
+			live = append(live, slot)
+		}
+	}
+
+	for index := len(live); index < len(order.slots); index++ {
+		order.slots[index] = scanSlot{}
+	}
+
+	order.slots = live
+	order.holes = 0
+}
+
+func (order *scanOrder) search(seq uint64) int {
+	return sort.Search(len(order.slots), func(index int) bool {
+		return order.slots[index].seq >= seq
+	})
+}
+
+func (order *scanOrder) scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	members, visited := make([]string, 0), 0
+	for position := order.search(cursor); position < len(order.slots); position++ {
+		slot := order.slots[position]
+		if slot.removed {
+			continue
+		}
+
+		if visited == count {
+			return members, slot.seq
+		}
+
+		visited++
+		if pattern == "" || globMatch(pattern, slot.member) {
+			members = append(members, slot.member)
+		}
+	}
+
+	return members, 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestScanOrder(t *testing.T) {
+	t.Run("scan members in insertion order", func(t *testing.T) {
+		order := makeScanOrder()
+		for _, member := range []string{"c", "a", "b"} {
+			order.add(member)
+		}
+
+		members, cursor := order.scan(0, 2, "")
+		assertInterface(t, []string{"c", "a"}, members)
+		assertInterface(t, uint64(3), cursor)
+
+		members, cursor = order.scan(cursor, 2, "")
+		assertInterface(t, []string{"b"}, members)
+		assertInterface(t, uint64(0), cursor)
+	})
+
+	t.Run("keep cursors valid across compaction", func(t *testing.T) {
+		order := makeScanOrder()
+		for index := 0; index < 100; index++ {
+			order.add(strconv.Itoa(index))
+		}
+
+		members, cursor := order.scan(0, 10, "")
+		for index := 10; index < 90; index++ {
+			order.remove(strconv.Itoa(index))
+		}
+		assertInterface(t, true, len(order.slots) < 50)
+
+		for cursor != 0 {
+			var page []string
+			page, cursor = order.scan(cursor, 10, "")
+			members = append(members, page...)
+		}
+
+		assertInterface(t, 20, len(members))
+		assertInterface(t, "90", members[10])
+	})
+
+	t.Run("skip removed members", func(t *testing.T) {
+		order := makeScanOrder()
+		for _, member := range []string{"a", "b", "c", "d"} {
+			order.add(member)
+		}
+
+		order.remove("b")
+		order.add("b")
+
+		members, cursor := order.scan(0, 10, "")
+		assertInterface(t, []string{"a", "c", "d", "b"}, members)
+		assertInterface(t, uint64(0), cursor)
+
+		clone := order.clone()
+		assertInterface(t, 0, clone.holes)
+		assertInterface(t, order.last, clone.last)
+
+		members, _ = clone.scan(0, 10, "")
+		assertInterface(t, []string{"a", "c", "d", "b"}, members)
+	})
+}
+
+func BenchmarkHashScan1M(b *testing.B) {
+	hash := MakeHash()
+	for index := 0; index < 1000000; index++ {
+		hash.Set("field:"+strconv.Itoa(index), "value")
+	}
+
+	b.ResetTimer()
+
+	var cursor uint64
+	for n := 0; n < b.N; n++ {
+		_, cursor = hash.Scan(cursor, 10, "")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+)
+
+type Set struct {
+	items []string
+	index map[string]int
+	order scanOrder
+	bytes int
+}
+
+func MakeSet() *Set {
+	return &Set{
+		make([]string, 0),
+		make(map[string]int),
+		makeScanOrder(),
+		0,
+	}
+}
+
+func (set *Set) Clone() *Set {
+	clone := &Set{
+		append(make([]string, 0, len(set.items)), set.items...),
+		make(map[string]int, len(set.index)),
+		set.order.clone(),
+		set.bytes,
+	}
+
+	for member, index := range set.index {
+		clone.index[member] = index
+	}
+
+	return clone
+}
+
+func (set *Set) Add(member string) bool {
+	if _, ok := set.index[member]; ok {
+		return false
+	}
+
+	set.index[member] = len(set.items)
+	set.items = append(set.items, member)
+	set.order.add(member)
+	set.bytes += len(member)
+	return true
+}
+
+func (set *Set) Remove(member string) bool {
+	index, ok := set.index[member]
+	if !ok {
+		return false
+	}
+
+	last := len(set.items) - 1
+	set.items[index] = set.items[last]
+	set.index[set.items[index]] = index
+	set.items[last] = ""
+	set.items = set.items[:last]
+	delete(set.index, member)
+	set.order.remove(member)
+	set.bytes -= len(member)
+
+	return true
+}
+
+func (set *Set) Has(member string) bool {
+	_, ok := set.index[member]
+	return ok
+}
+
+func (set *Set) Len() int {
+	return len(set.items)
+}
+
+func (set *Set) Memory() int64 {
+	return int64(set.bytes + len(set.items)*setItemOverhead)
+}
+
+func (set *Set) Members() []string {
+	members := append([]string{}, set.items...)
+	sort.Strings(members)
+
+	return members
+}
+
+func (set *Set) Pop(count int) []string {
+	members := make([]string, 0)
+	for len(members) < count && len(set.items) > 0 {
+		member := set.items[rand.Intn(len(set.items))]
+		set.Remove(member)
+		members = append(members, member)
+	}
+
+	return members
+}
+
+func (set *Set) Random(count int) []string {
+	if count < 0 {
+		size := len(set.items)
+		if count > -size {
+			size = -count
+		}
+
+		members := make([]string, 0, size)
+		for len(set.items) > 0 && len(members) < -count {
+			members = append(members, set.items[rand.Intn(len(set.items))])
+		}
+
+		return members
+	}
+
+	if count >= len(set.items) {
+		return set.Members()
+	}
+
+	members := make([]string, 0, count)
+	for _, index := range sampleIndexes(len(set.items), count) {
+		members = append(members, set.items[index])
+	}
+
+	return members
+}
+
+func sampleIndexes(size, count int) []int {
+	chosen := make(map[int]bool, count)
+	indexes := make([]int, 0, count)
+	for upper := size - count; upper < size; upper++ {
+		index := rand.Intn(upper + 1)
+		if chosen[index] {
+			index = upper
+		}
+
+		chosen[index] = true
+		indexes = append(indexes, index)
+	}
+
+	rand.Shuffle(len(indexes), func(i, j int) {
+		indexes[i], indexes[j] = indexes[j], indexes[i]
+	})
+
+	return indexes
+}
+
+func (set *Set) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	return set.order.scan(cursor, count, pattern)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+func TestSetAdd(t *testing.T) {
+	set := MakeSet()
+
+	t.Run("add new and existing members", func(t *testing.T) {
+		assertInterface(t, true, set.Add("a"))
+		assertInterface(t, false, set.Add("a"))
+		assertInterface(t, true, set.Add("b"))
+		assertInterface(t, 2, set.Len())
+	})
+}
+
+func TestSetRemove(t *testing.T) {
+	set := MakeSet()
+	set.Add("a")
+	set.Add("b")
+	set.Add("c")
+
+	t.Run("remove members", func(t *testing.T) {
+		assertInterface(t, true, set.Remove("a"))
+		assertInterface(t, false, set.Remove("a"))
+		assertInterface(t, false, set.Has("a"))
+		assertInterface(t, true, set.Has("c"))
+		assertInterface(t, []string{"b", "c"}, set.Members())
+	})
+}
+
+func TestSetPop(t *testing.T) {
+	set := MakeSet()
+	set.Add("a")
+	set.Add("b")
+	set.Add("c")
+
+	t.Run("pop more members than available", func(t *testing.T) {
+		members := set.Pop(5)
+		sort.Strings(members)
+
+		assertInterface(t, []string{"a", "b", "c"}, members)
+		assertInterface(t, 0, set.Len())
+	})
+}
+
+func TestSetRandom(t *testing.T) {
+	set := MakeSet()
+	set.Add("a")
+	set.Add("b")
+	set.Add("c")
+
+	t.Run("get distinct random members", func(t *testing.T) {
+		members := set.Random(2)
+		if len(members) != 2 || members[0] == members[1] {
+			t.Errorf("expected two distinct members, got %v", members)
+		}
+
+		assertInterface(t, []string{"a", "b", "c"}, set.Random(10))
+	})
+
+	t.Run("get repeated random members", func(t *testing.T) {
+		members := set.Random(-10)
+		assertInterface(t, 10, len(members))
+
+		for _, member := range members {
+			if !set.Has(member) {
+				t.Errorf("expected member of set, got %q", member)
+			}
+		}
+	})
+
+	t.Run("bound repeated members by the set size", func(t *testing.T) {
+		assertInterface(t, []string{}, set.Random(math.MinInt64))
+
+		members := MakeSet().Random(-1000000000)
+		assertInterface(t, []string{}, members)
+		assertInterface(t, 0, cap(members))
+	})
+}
+
+func TestSampleIndexes(t *testing.T) {
+	t.Run("sample distinct indexes in range", func(t *testing.T) {
+		for _, count := range []int{0, 1, 5, 10} {
+			seen := map[int]bool{}
+			for _, index := range sampleIndexes(10, count) {
+				if index < 0 || index >= 10 || seen[index] {
+					t.Fatalf("expected distinct index in [0, 10), got %d", index)
+				}
+
+				seen[index] = true
+			}
+
+			assertInterface(t, count, len(seen))
+		}
+	})
+
+	t.Run("sample every index eventually", func(t *testing.T) {
+		hits := make([]int, 100)
+		for round := 0; round < 1000; round++ {
+			for _, index := range sampleIndexes(100, 3) {
+				hits[index]++
+			}
+		}
+
+		for index, count := range hits {
+			if count == 0 {
+				t.Errorf("expected index %d to be sampled", index)
+			}
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+const storeShards = 256
+
+type storeShard struct {
+	mutex   sync.RWMutex
+	entries map[string]*entry
+	expires expireHeap
+	dumps   []*storeDump
+}
+
+func keyHash(key string) uint32 {
+	hash := uint32(2166136261)
+	for index := 0; index < len(key); index++ {
+		hash ^= uint32(key[index])
+		hash *= 16777619
+	}
+
+	return hash
+}
+
+func shardIndex(key string) int {
+	return int(keyHash(key) % storeShards)
+}
+
+func (store *Store) shard(key string) *storeShard {
+	return &store.shards[shardIndex(key)]
+}
+
+func (store *Store) lockShard(index int) *storeShard {
+	shard := &store.shards[index]
+	shard.mutex.Lock()
+
+	if len(shard.dumps) > 0 {
+		shard.capture(index)
+	}
+
+	return shard
+}
+
+func (shard *storeShard) capture(index int) {
+	entries := make([]dumpEntry, 0, len(shard.entries))
+	for key, e := range shard.entries {
+		entries = append(entries, dumpEntry{key, cloneValue(e.value), e.deadline})
+	}
+
+	for _, dump := range shard.dumps {
+		dump.shards[index] = entries
+	}
+
+	shard.dumps = nil
+}
+
+func (store *Store) lookup(key string) (*entry, bool) {
+	e, ok := store.shard(key).entries[key]
+	return e, ok
+}
+
+func (store *Store) peek(key string) (*entry, bool) {
+	shard := store.shard(key)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	e, ok := shard.entries[key]
+	return e, ok
+}
+
+func (store *Store) rangeShards(fn func(shard *storeShard) bool) {
+	start := rand.Intn(storeShards)
+	for offset := 0; offset < storeShards; offset++ {
+		shard := &store.shards[(start+offset)%storeShards]
+
+		shard.mutex.RLock()
+		more := fn(shard)
+		shard.mutex.RUnlock()
+
+		if !more {
+			return
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockKey(t *testing.T) {
+	t.Run("lock keys sharing a shard once", func(t *testing.T) {
+		store := new(Store)
+
+		other := "b"
+		for x := 0; shardIndex(other) != shardIndex("a"); x++ {
+			other = "b" + strconv.Itoa(x)
+		}
+
+		unlock := store.LockKeys("a", other, "a", "c")
+		unlock()
+
+		store.LockKey(other)()
+	})
+
+	t.Run("serialize holders of the same key", func(t *testing.T) {
+		store := new(Store)
+
+		var wg sync.WaitGroup
+		count := 0
+		for x := 0; x < 50; x++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for y := 0; y < 100; y++ {
+					unlock := store.LockKey("counter")
+					count++
+					unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+		assertInterface(t, 5000, count)
+	})
+
+	t.Run("keep lock while others wait", func(t *testing.T) {
+		store := new(Store)
+		unlock := store.LockKey("key")
+
+		acquired := make(chan UnlockCallback)
+		go func() {
+			acquired <- store.LockKey("key")
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatalf("expected lock to be held")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		unlock()
+		(<-acquired)()
+	})
+}
+
+func TestRLockKey(t *testing.T) {
+	t.Run("share lock between readers", func(t *testing.T) {
+		store := new(Store)
+		store.Set("key", "value")
+		unlock := store.RLockKey("key")
+
+		acquired := make(chan UnlockCallback)
+		go func() {
+			acquired <- store.RLockKeys("key", "other")
+		}()
+
+		select {
+		case other := <-acquired:
+			other()
+		case <-time.After(time.Second):
+			t.Fatalf("expected shared lock to be acquired")
+		}
+
+		go func() {
+			acquired <- store.LockKey("key")
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatalf("expected writer to wait for readers")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		unlock()
+		(<-acquired)()
+	})
+
+	t.Run("take exclusive lock to expire keys", func(t *testing.T) {
+		store := new(Store)
+		store.SetWithDeadline("key", "value", time.Now().Add(-time.Second))
+		assertInterface(t, 1, store.DbSize())
+
+		unlock := store.RLockKey("key")
+		assertInterface(t, 0, store.DbSize())
+
+		acquired := make(chan UnlockCallback)
+		go func() {
+			acquired <- store.RLockKey("key")
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatalf("expected exclusive lock to be held")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		unlock()
+		(<-acquired)()
+	})
+}
+
+func BenchmarkLockKeyChurn(b *testing.B) {
+	store := new(Store)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		key := "churn:" + strconv.Itoa(n)
+		store.Set(key, "value")
+		store.Get(key)
+		store.Del(key)
+	}
+
+	b.StopTimer()
+	if size := rawSize(store); size != 0 {
+		b.Fatalf("expected store to be empty after %d keys, got %d entries", b.N, size)
+	}
+}
+
+func BenchmarkLockKeyChurnParallel(b *testing.B) {
+	store := new(Store)
+
+	var mutex sync.Mutex
+	worker := 0
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		mutex.Lock()
+		prefix := "churn:" + strconv.Itoa(worker) + ":"
+		worker++
+		mutex.Unlock()
+
+		for x := 0; pb.Next(); x++ {
+			key := prefix + strconv.Itoa(x)
+			store.Set(key, "value")
+			store.Get(key)
+			store.Del(key)
+		}
+	})
+
+	b.StopTimer()
+	if size := rawSize(store); size != 0 {
+		b.Fatalf("expected store to be empty after %d keys, got %d entries", b.N, size)
+	}
+}
+
+const parallelKeysCount = 100000
+
+func parallelStoreTestAux() (*Store, []string) {
+	store := new(Store)
+	keys := make([]string, parallelKeysCount)
+	for x := range keys {
+		keys[x] = "key:" + strconv.Itoa(x)
+		store.Set(keys[x], "value")
+	}
+
+	return store, keys
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	store, keys := parallelStoreTestAux()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for x := rand.Int(); pb.Next(); x++ {
+			store.Get(keys[x%len(keys)])
+		}
+	})
+}
+
+func BenchmarkSetParallel(b *testing.B) {
+	store, keys := parallelStoreTestAux()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for x := rand.Int(); pb.Next(); x++ {
+			store.Set(keys[x%len(keys)], "value")
+		}
+	})
+}
+
+func BenchmarkMixedParallel(b *testing.B) {
+	store, keys := parallelStoreTestAux()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for x := rand.Int(); pb.Next(); x++ {
+			key := keys[x%len(keys)]
+			switch x % 10 {
+			case 0:
+				store.SetEx(key, "value", 100)
+			case 1:
+				store.Incr("counter:" + strconv.Itoa(x%100))
+			default:
+				store.Get(key)
+			}
+		}
+	})
+}
+
+func BenchmarkDbSize(b *testing.B) {
+	store, _ := parallelStoreTestAux()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		store.DbSize()
+	}
+}
@@ -0,0 +1,607 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSnapshotPath = "dump.mrdb"
+	snapshotMagic       = "MINIREDIS"
+	snapshotVersion     = 1
+)
+
+const (
+	snapshotString byte = iota
+	snapshotInt
+	snapshotSortedSet
+	snapshotHash
+	snapshotList
+	snapshotSet
+	snapshotEOF byte = 0xff
+)
+
+type snapshotState struct {
+	mutex    sync.Mutex
+	path     string
+	saving   bool
+	lastSave time.Time
+}
+
+type dumpEntry struct {
+	key      string
+	value    Value
+	deadline int64
+}
+
+func (store *Store) SetSnapshotPath(path string) {
+	state := &store.snapshots
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.path = path
+	state.lastSave = time.Now()
+}
+
+func (store *Store) OpenSnapshot(path string) error {
+	store.SetSnapshotPath(path)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := readSnapshot(file)
+	if err != nil {
+		return fmt.Errorf("miniredis: could not load snapshot %q: %v", path, err)
+	}
+
+	now := time.Now().UnixNano()
+	for _, e := range entries {
+		if e.deadline == 0 || e.deadline > now {
+			store.put(e.key, e.value, e.deadline)
+		}
+	}
+
+	return nil
+}
+
+func (store *Store) Save() error {
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	return store.save()
+}
+
+func (store *Store) BgSave() error {
+	store.txnLock.Lock()
+	defer store.txnLock.Unlock()
+
+	return store.bgSave()
+}
+
+func (store *Store) LastSave() time.Time {
+	store.snapshots.mutex.Lock()
+	defer store.snapshots.mutex.Unlock()
+
+	return store.snapshots.lastSave
+}
+
+func (store *Store) save() error {
+	path, err := store.beginSave()
+	if err != nil {
+		return err
+	}
+
+	err = store.writeSnapshot(path, store.beginDump())
+	store.endSave(err)
+
+	return err
+}
+
+func (store *Store) bgSave() error {
+	path, err := store.beginSave()
+	if err != nil {
+		return err
+	}
+
+	dump := store.beginDump()
+	go func() {
+		err := store.writeSnapshot(path, dump)
+		if err != nil {
+			log.Printf("Got the following error while saving snapshot: %v", err)
+		}
+
+		store.endSave(err)
+	}()
+
+	return nil
+}
+
+func (store *Store) beginSave() (string, error) {
+	state := &store.snapshots
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.saving {
+		return "", errors.New("miniredis: Background save already in progress")
+	}
+
+	state.saving = true
+	if state.path == "" {
+		return defaultSnapshotPath, nil
+	}
+
+	return state.path, nil
+}
+
+func (store *Store) endSave(err error) {
+	state := &store.snapshots
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.saving = false
+	if err == nil {
+		state.lastSave = time.Now()
+	}
+}
+
+type storeDump struct {
+	now    int64
+	shards [storeShards][]dumpEntry
+}
+
+func (store *Store) beginDump() *storeDump {
+	dump := &storeDump{now: time.Now().UnixNano()}
+	for index := range store.shards {
+		shard := &store.shards[index]
+		shard.mutex.Lock()
+		shard.dumps = append(shard.dumps, dump)
+		shard.mutex.Unlock()
+	}
+
+	return dump
+}
+
+func (store *Store) rangeDump(dump *storeDump, fn func(e dumpEntry) error) error {
+	for index := range store.shards {
+		store.lockShard(index).mutex.Unlock()
+
+		entries := dump.shards[index]
+		dump.shards[index] = nil
+
+		for _, e := range entries {
+			if e.deadline != 0 && e.deadline <= dump.now {
+				continue
+			}
+
+			if err := fn(e); err != nil {
+				store.abandonDump(dump, index+1)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (store *Store) abandonDump(dump *storeDump, from int) {
+	for index := from; index < storeShards; index++ {
+		shard := &store.shards[index]
+		shard.mutex.Lock()
+		for position, pending := range shard.dumps {
+			if pending == dump {
+				shard.dumps = append(shard.dumps[:position], shard.dumps[position+1:]...)
+				break
+			}
+		}
+		shard.mutex.Unlock()
+	}
+}
+
+func cloneValue(value Value) Value {
+	switch typed := value.(type) {
+	case *SortedSet:
+		return typed.Clone()
+	case *Hash:
+		return typed.Clone()
+	case *List:
+		return typed.Clone()
+	case *Set:
+		return typed.Clone()
+	}
+
+	return value
+}
+
+func (store *Store) writeSnapshot(path string, dump *storeDump) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "temp-*.mrdb")
+	if err != nil {
+		store.abandonDump(dump, 0)
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	if err := store.encodeSnapshot(temp, dump); err != nil {
+		return err
+	}
+
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+func (store *Store) encodeSnapshot(w io.Writer, dump *storeDump) error {
+	writer := newSnapshotWriter(w)
+	writer.writeRaw([]byte(snapshotMagic))
+	writer.writeRaw([]byte{snapshotVersion})
+
+	if err := store.rangeDump(dump, writer.writeEntry); err != nil {
+		return err
+	}
+
+	writer.writeRaw([]byte{snapshotEOF})
+	return writer.finish()
+}
+
+type snapshotWriter struct {
+	writer   *bufio.Writer
+	checksum hash.Hash32
+	err      error
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	checksum := crc32.NewIEEE()
+	return &snapshotWriter{bufio.NewWriter(io.MultiWriter(w, checksum)), checksum, nil}
+}
+
+func (writer *snapshotWriter) writeRaw(data []byte) {
+	if writer.err == nil {
+		_, writer.err = writer.writer.Write(data)
+	}
+}
+
+func (writer *snapshotWriter) writeUvarint(num uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	writer.writeRaw(buf[:binary.PutUvarint(buf, num)])
+}
+
+func (writer *snapshotWriter) writeVarint(num int64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	writer.writeRaw(buf[:binary.PutVarint(buf, num)])
+}
+
+func (writer *snapshotWriter) writeString(str string) {
+	writer.writeUvarint(uint64(len(str)))
+	writer.writeRaw([]byte(str))
+}
+
+func (writer *snapshotWriter) writeFloat(num float64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, math.Float64bits(num))
+	writer.writeRaw(buf)
+}
+
+func (writer *snapshotWriter) writeEntry(e dumpEntry) error {
+	switch typed := e.value.(type) {
+	case string:
+		writer.writeHeader(snapshotString, e)
+		writer.writeString(typed)
+	case int:
+		writer.writeHeader(snapshotInt, e)
+		writer.writeVarint(int64(typed))
+	case *SortedSet:
+		writer.writeHeader(snapshotSortedSet, e)
+		items := typed.Slice(0, typed.Len()-1)
+		writer.writeUvarint(uint64(len(items)))
+		for _, item := range items {
+			writer.writeString(item.Member)
+			writer.writeFloat(item.Score)
+		}
+	case *Hash:
+		writer.writeHeader(snapshotHash, e)
+		items := typed.Items()
+		writer.writeUvarint(uint64(len(items)))
+		for _, item := range items {
+			writer.writeString(item.Field)
+			writer.writeString(item.Value)
+		}
+	case *List:
+		writer.writeHeader(snapshotList, e)
+		writer.writeStrings(typed.Slice(0, -1))
+	case *Set:
+		writer.writeHeader(snapshotSet, e)
+		writer.writeStrings(typed.items)
+	default:
+		return fmt.Errorf("miniredis: key %q holds a value of unsupported type %T", e.key, e.value)
+	}
+
+	return writer.err
+}
+
+func (writer *snapshotWriter) writeHeader(kind byte, e dumpEntry) {
+	writer.writeRaw([]byte{kind})
+	writer.writeVarint(e.deadline)
+	writer.writeString(e.key)
+}
+
+func (writer *snapshotWriter) writeStrings(values []string) {
+	writer.writeUvarint(uint64(len(values)))
+	for _, value := range values {
+		writer.writeString(value)
+	}
+}
+
+func (writer *snapshotWriter) finish() error {
+	if writer.err != nil {
+		return writer.err
+	}
+
+	if err := writer.writer.Flush(); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, writer.checksum.Sum32())
+	_, err := writer.writer.Write(buf)
+	if err == nil {
+		err = writer.writer.Flush()
+	}
+
+	return err
+}
+
+type snapshotReader struct {
+	reader   *bufio.Reader
+	checksum hash.Hash32
+}
+
+func readSnapshot(r io.Reader) ([]dumpEntry, error) {
+	reader := &snapshotReader{bufio.NewReader(r), crc32.NewIEEE()}
+
+	header, err := reader.readRaw(len(snapshotMagic) + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("invalid snapshot header")
+	}
+
+	if version := header[len(snapshotMagic)]; version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	var entries []dumpEntry
+	for {
+		kind, err := reader.readRaw(1)
+		if err != nil {
+			return nil, err
+		}
+
+		if kind[0] == snapshotEOF {
+			break
+		}
+
+		e, err := reader.readEntry(kind[0])
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	expected := reader.checksum.Sum32()
+
+	sum := make([]byte, 4)
+	if _, err := io.ReadFull(reader.reader, sum); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if binary.LittleEndian.Uint32(sum) != expected {
+		return nil, errors.New("snapshot checksum mismatch")
+	}
+
+	return entries, nil
+}
+
+func (reader *snapshotReader) readRaw(size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(reader.reader, buf); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	reader.checksum.Write(buf)
+	return buf, nil
+}
+
+func (reader *snapshotReader) ReadByte() (byte, error) {
+	buf, err := reader.readRaw(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return buf[0], nil
+}
+
+func (reader *snapshotReader) readUvarint() (uint64, error) {
+	num, err := binary.ReadUvarint(reader)
+	return num, unexpectedEOF(err)
+}
+
+func (reader *snapshotReader) readVarint() (int64, error) {
+	num, err := binary.ReadVarint(reader)
+	return num, unexpectedEOF(err)
+}
+
+func (reader *snapshotReader) readLength() (int, error) {
+	length, err := reader.readUvarint()
+	if err == nil && length > math.MaxInt32 {
+		err = errors.New("invalid snapshot length")
+	}
+
+	return int(length), err
+}
+
+func (reader *snapshotReader) readString() (string, error) {
+	length, err := reader.readLength()
+	if err != nil {
+		return "", err
+	}
+
+	buf, err := reader.readRaw(length)
+	return string(buf), err
+}
+
+func (reader *snapshotReader) readFloat() (float64, error) {
+	buf, err := reader.readRaw(8)
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+}
+
+func (reader *snapshotReader) readEntry(kind byte) (dumpEntry, error) {
+	var e dumpEntry
+	var err error
+
+	if e.deadline, err = reader.readVarint(); err != nil {
+		return e, err
+	}
+
+	if e.key, err = reader.readString(); err != nil {
+		return e, err
+	}
+
+	switch kind {
+	case snapshotString:
+		e.value, err = reader.readString()
+	case snapshotInt:
+		var num int64
+		num, err = reader.readVarint()
+		e.value = int(num)
+	case snapshotSortedSet:
+		e.value, err = reader.readSortedSet()
+	case snapshotHash:
+		e.value, err = reader.readHash()
+	case snapshotList:
+		var values []string
+		if values, err = reader.readStrings(); err == nil {
+			list := MakeList()
+			list.Push(ListRight, values...)
+			e.value = list
+		}
+	case snapshotSet:
+		var members []string
+		if members, err = reader.readStrings(); err == nil {
+			set := MakeSet()
+			for _, member := range members {
+				set.Add(member)
+			}
+			e.value = set
+		}
+	default:
+		err = fmt.Errorf("unknown snapshot value type %d", kind)
+	}
+
+	return e, err
+}
+
+func (reader *snapshotReader) readSortedSet() (*SortedSet, error) {
+	count, err := reader.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	sortedSet := MakeSortedSet()
+	for index := 0; index < count; index++ {
+		member, err := reader.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		score, err := reader.readFloat()
+		if err != nil {
+			return nil, err
+		}
+
+		sortedSet.Set(score, member)
+	}
+
+	return sortedSet, nil
+}
+
+func (reader *snapshotReader) readHash() (*Hash, error) {
+	count, err := reader.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := MakeHash()
+	for index := 0; index < count; index++ {
+		field, err := reader.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := reader.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		hash.Set(field, value)
+	}
+
+	return hash, nil
+}
+
+func (reader *snapshotReader) readStrings() ([]string, error) {
+	count, err := reader.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+	for index := 0; index < count; index++ {
+		value, err := reader.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
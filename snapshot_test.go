@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func snapshotTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "miniredis")
+	if err != nil {
+		t.Fatalf("expected nil, got %q", err)
+	}
+
+	return dir
+}
+
+func waitForBgSave(t *testing.T, store *Store) {
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		store.snapshots.mutex.Lock()
+		saving := store.snapshots.saving
+		store.snapshots.mutex.Unlock()
+
+		if !saving {
+			return
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected background save to finish")
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := snapshotTestDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dump.mrdb")
+
+	t.Run("save and load every value type", func(t *testing.T) {
+		store := new(Store)
+		if err := store.OpenSnapshot(path); err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+
+		store.Set("str", "a\x00b")
+		store.Incr("num")
+		store.ZAdd("zset", SortedSetItem{1.5, "a"}, SortedSetItem{-2, "b"})
+		store.HSet("hash", HashItem{"field", "value"})
+		store.RPush("list", "x", "y", "z")
+		store.SAdd("set", "m", "n")
+		store.SetWithDeadline("volatile", "value", time.Now().Add(time.Hour))
+		store.SetWithDeadline("expiring", "value", time.Now().Add(20*time.Millisecond))
+
+		if err := store.Save(); err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+
+		time.Sleep(30 * time.Millisecond)
+
+		loaded := new(Store)
+		if err := loaded.OpenSnapshot(path); err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+
+		value, _, _ := loaded.Get("str")
+		assertInterface(t, "a\x00b", value)
+
+		num, _ := loaded.Incr("num")
+		assertInterface(t, 2, num)
+
+		items, _ := loaded.ZRange("zset", 0, 10)
+		assertInterface(t, []SortedSetItem{{-2, "b"}, {1.5, "a"}}, items)
+
+		fields, _ := loaded.HGetAll("hash")
+		assertInterface(t, []HashItem{{"field", "value"}}, fields)
+
+		values, _ := loaded.LRange("list", 0, -1)
+		assertInterface(t, []string{"x", "y", "z"}, values)
+
+		members, _ := loaded.SMembers("set")
+		assertInterface(t, []string{"m", "n"}, members)
+
+		deadline, exists, volatile := loaded.Deadline("volatile")
+		assertInterface(t, true, exists && volatile && time.Until(deadline) > 59*time.Minute)
+
+		assertInterface(t, 7, loaded.DbSize())
+	})
+
+	t.Run("background save keeps point in time copy", func(t *testing.T) {
+		store := new(Store)
+		store.OpenSnapshot(filepath.Join(dir, "missing.mrdb"))
+		store.snapshots.path = path
+
+		store.RPush("list", "a")
+		if err := store.BgSave(); err != nil {
+			t.Fatalf("expected nil, got %q", err)
+		}
+
+		store.RPush("list", "b")
+		store.Set("other", "value")
+		waitForBgSave(t, store)
+
+		loaded := new(Store)
+		loaded.OpenSnapshot(path)
+
+		values, _ := loaded.LRange("list", 0, -1)
+		assertInterface(t, []string{"a"}, values)
+		assertInterface(t, 1, loaded.DbSize())
+	})
+
+	t.Run("leave no temporary files behind", func(t *testing.T) {
+		files, _ := ioutil.ReadDir(dir)
+		for _, file := range files {
+			if file.Name() != "dump.mrdb" {
+				t.Errorf("expected only snapshot file, got %q", file.Name())
+			}
+		}
+	})
+
+	t.Run("reject corrupted snapshots", func(t *testing.T) {
+		data, _ := ioutil.ReadFile(path)
+
+		corrupted := append([]byte{}, data...)
+		corrupted[len(corrupted)-6] ^= 0xff
+
+		inputs := [][]byte{
+			corrupted,
+			data[:len(data)-1],
+			data[:len(data)/2],
+			[]byte("REDIS0011"),
+		}
+
+		for _, input := range inputs {
+			if _, err := readSnapshot(bytes.NewReader(input)); err == nil {
+				t.Errorf("expected error for %q, got nil", input)
+			}
+		}
+	})
+}
+
+func TestStoreDump(t *testing.T) {
+	t.Run("capture shards lazily on write", func(t *testing.T) {
+		store := new(Store)
+		store.Set("a", "1")
+		store.Set("b", "1")
+
+		dump := store.beginDump()
+		assertInterface(t, 0, len(dump.shards[shardIndex("a")]))
+
+		store.Set("a", "2")
+		store.Set("c", "1")
+		store.Del("b")
+		assertInterface(t, 1, len(dump.shards[shardIndex("a")]))
+
+		values := make(map[string]interface{})
+		store.rangeDump(dump, func(e dumpEntry) error {
+			values[e.key] = e.value
+			return nil
+		})
+
+		assertInterface(t, map[string]interface{}{"a": "1", "b": "1"}, values)
+		for index := range store.shards {
+			assertInterface(t, 0, len(store.shards[index].dumps))
+		}
+	})
+
+	t.Run("release pending shards on error", func(t *testing.T) {
+		store := new(Store)
+		store.Set("a", "1")
+
+		dump := store.beginDump()
+		err := store.rangeDump(dump, func(e dumpEntry) error {
+			return os.ErrClosed
+		})
+
+		assertInterface(t, os.ErrClosed, err)
+		for index := range store.shards {
+			assertInterface(t, 0, len(store.shards[index].dumps))
+		}
+	})
+}
+
+func TestExecSnapshot(t *testing.T) {
+	dir := snapshotTestDir(t)
+	defer os.RemoveAll(dir)
+
+	store := new(Store)
+	store.OpenSnapshot(filepath.Join(dir, "dump.mrdb"))
+	intr := Interpreter{Store: store}.WithClient(NewClient(nil))
+
+	before := time.Now().Unix()
+	tests := []execTestAux{
+		{"SET a 1", 0, true},
+		{"SAVE", 0, true},
+		{"MULTI", 0, true},
+		{"SAVE", 0, SimpleString("QUEUED")},
+		{"EXEC", 0, []interface{}{true}},
+		{"BGSAVE", 0, SimpleString("Background saving started")},
+	}
+
+	for _, te := range tests {
+		assertExec(t, intr, te)
+	}
+
+	waitForBgSave(t, store)
+
+	lastSave, _ := intr.Exec("LASTSAVE")
+	if lastSave.(int64) < before {
+		t.Errorf("expected LASTSAVE to be at least %d, got %v", before, lastSave)
+	}
+}
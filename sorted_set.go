@@ -1,18 +1,39 @@
 package main
 
 import (
-	"sort"
+	"math/rand"
+)
+
+const (
+	skiplistMaxLevel    = 32
+	skiplistProbability = 0.25
 )
 
 type SortedSet struct {
-	items []SortedSetItem
-	index map[string]int
+	header *skiplistNode
+	tail   *skiplistNode
+	level  int
+	length int
+	nodes  map[string]*skiplistNode
+	bytes  int
+}
+
+type skiplistNode struct {
+	item     SortedSetItem
+	backward *skiplistNode
+	levels   []skiplistLevel
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
 }
 
 func MakeSortedSet() *SortedSet {
 	return &SortedSet{
-		make([]SortedSetItem, 0),
-		make(map[string]int),
+		header: &skiplistNode{levels: make([]skiplistLevel, skiplistMaxLevel)},
+		level:  1,
+		nodes:  make(map[string]*skiplistNode),
 	}
 }
 
@@ -21,58 +42,436 @@ type SortedSetItem struct {
 	Member string
 }
 
+func (item SortedSetItem) Less(other SortedSetItem) bool {
+	if item.Score != other.Score {
+		return item.Score < other.Score
+	}
+
+	return item.Member < other.Member
+}
+
+type ScoreBound struct {
+	Score     float64
+	Exclusive bool
+}
+
+type ScoreRange struct {
+	Min, Max ScoreBound
+}
+
+func (scoreRange ScoreRange) belowMin(score float64) bool {
+	if scoreRange.Min.Exclusive {
+		return score <= scoreRange.Min.Score
+	}
+
+	return score < scoreRange.Min.Score
+}
+
+func (scoreRange ScoreRange) aboveMax(score float64) bool {
+	if scoreRange.Max.Exclusive {
+		return score >= scoreRange.Max.Score
+	}
+
+	return score > scoreRange.Max.Score
+}
+
+type LexBound struct {
+	Member    string
+	Exclusive bool
+	Infinity  int
+}
+
+type LexRange struct {
+	Min, Max LexBound
+}
+
+func (lexRange LexRange) belowMin(member string) bool {
+	switch min := lexRange.Min; {
+	case min.Infinity != 0:
+		return min.Infinity > 0
+	case min.Exclusive:
+		return member <= min.Member
+	default:
+		return member < min.Member
+	}
+}
+
+func (lexRange LexRange) aboveMax(member string) bool {
+	switch max := lexRange.Max; {
+	case max.Infinity != 0:
+		return max.Infinity < 0
+	case max.Exclusive:
+		return member >= max.Member
+	default:
+		return member > max.Member
+	}
+}
+
+func (set *SortedSet) Clone() *SortedSet {
+	clone := MakeSortedSet()
+	for node := set.header.levels[0].forward; node != nil; node = node.levels[0].forward {
+		clone.insert(node.item)
+	}
+
+	clone.bytes = set.bytes
+	return clone
+}
+
 func (set *SortedSet) Set(score float64, member string) bool {
-	item := SortedSetItem{score, member}
-	defer set.ensureOrder()
+	if node, ok := set.nodes[member]; ok {
+		if node.item.Score != score {
+			set.delete(node)
+			set.insert(SortedSetItem{score, member})
+		}
 
-	if index, ok := set.index[member]; ok {
-		set.items[index] = item
 		return false
 	}
 
-	set.items = append(set.items, item)
+	set.insert(SortedSetItem{score, member})
+	set.bytes += len(member)
 	return true
 }
 
-func (set *SortedSet) ensureOrder() {
-	sort.SliceStable(set.items, func(i, j int) bool {
-		return set.items[i].Score < set.items[j].Score
-	})
+func (set *SortedSet) Len() int {
+	return set.length
+}
 
-	for index, item := range set.items {
-		set.index[item.Member] = index
-	}
+func (set *SortedSet) Memory() int64 {
+	return int64(set.bytes + set.length*sortedSetItemOverhead)
 }
 
-func (set *SortedSet) Len() int {
-	return len(set.items)
+func (set *SortedSet) Score(member string) (float64, bool) {
+	if node, ok := set.nodes[member]; ok {
+		return node.item.Score, true
+	}
+
+	return 0, false
 }
 
 func (set *SortedSet) Position(member string) (int, bool) {
-	index, ok := set.index[member]
-	return index, ok
+	node, ok := set.nodes[member]
+	if !ok {
+		return 0, false
+	}
+
+	index, _ := set.seek(func(item SortedSetItem) bool {
+		return item.Less(node.item)
+	})
+
+	return index, true
+}
+
+func (set *SortedSet) Remove(member string) bool {
+	node, ok := set.nodes[member]
+	if !ok {
+		return false
+	}
+
+	set.delete(node)
+	set.bytes -= len(member)
+	return true
 }
 
 func (set *SortedSet) Slice(start, stop int) []SortedSetItem {
-	size := len(set.items)
-	if start >= size || start > stop {
+	start, stop, ok := set.sliceBounds(start, stop)
+	if !ok {
 		return []SortedSetItem{}
 	}
 
+	return set.collect(start, stop-start+1, false)
+}
+
+func (set *SortedSet) ReverseSlice(start, stop int) []SortedSetItem {
+	start, stop, ok := set.sliceBounds(start, stop)
+	if !ok {
+		return []SortedSetItem{}
+	}
+
+	return set.collect(set.length-1-start, stop-start+1, true)
+}
+
+func (set *SortedSet) sliceBounds(start, stop int) (int, int, bool) {
+	size := set.length
+	if start < 0 {
+		start += size
+	}
+
+	if stop < 0 {
+		stop += size
+	}
+
 	if start < 0 {
-		if start += size; start < 0 {
-			return []SortedSetItem{}
+		start = 0
+	}
+
+	if stop >= size {
+		stop = size - 1
+	}
+
+	return start, stop, start <= stop
+}
+
+func (set *SortedSet) Pop(count int, max bool) []SortedSetItem {
+	items := make([]SortedSetItem, 0)
+	for len(items) < count && set.length > 0 {
+		node := set.header.levels[0].forward
+		if max {
+			node = set.tail
 		}
+
+		set.delete(node)
+		set.bytes -= len(node.item.Member)
+		items = append(items, node.item)
 	}
 
-	switch {
-	case stop >= size:
-		stop = size
-	case stop < 0:
-		stop += size + 1
-	default:
-		stop++
+	return items
+}
+
+func (set *SortedSet) Random(count int) []SortedSetItem {
+	if count < 0 {
+		size := set.length
+		if count > -size {
+			size = -count
+		}
+
+		items := make([]SortedSetItem, 0, size)
+		for set.length > 0 && len(items) < -count {
+			items = append(items, set.nodeAt(rand.Intn(set.length)).item)
+		}
+
+		return items
+	}
+
+	if count >= set.length {
+		return set.Slice(0, -1)
+	}
+
+	items := make([]SortedSetItem, 0, count)
+	for _, index := range sampleIndexes(set.length, count) {
+		items = append(items, set.nodeAt(index).item)
+	}
+
+	return items
+}
+
+func (set *SortedSet) RangeByScore(scoreRange ScoreRange, offset, count int, reverse bool) []SortedSetItem {
+	first, last := set.scoreBounds(scoreRange)
+	return set.rangeBetween(first, last, offset, count, reverse)
+}
+
+func (set *SortedSet) ScoreCount(scoreRange ScoreRange) int {
+	first, last := set.scoreBounds(scoreRange)
+	return last - first
+}
+
+func (set *SortedSet) RemoveRangeByScore(scoreRange ScoreRange) int {
+	first, last := set.scoreBounds(scoreRange)
+
+	node := set.nodeAt(first)
+	for index := first; index < last; index++ {
+		next := node.levels[0].forward
+		set.delete(node)
+		set.bytes -= len(node.item.Member)
+		node = next
+	}
+
+	return last - first
+}
+
+func (set *SortedSet) RangeByLex(lexRange LexRange, offset, count int, reverse bool) []SortedSetItem {
+	first, last := set.lexBounds(lexRange)
+	return set.rangeBetween(first, last, offset, count, reverse)
+}
+
+func (set *SortedSet) LexCount(lexRange LexRange) int {
+	first, last := set.lexBounds(lexRange)
+	return last - first
+}
+
+func (set *SortedSet) scoreBounds(scoreRange ScoreRange) (int, int) {
+	return set.bounds(func(item SortedSetItem) bool {
+		return scoreRange.belowMin(item.Score)
+	}, func(item SortedSetItem) bool {
+		return scoreRange.aboveMax(item.Score)
+	})
+}
+
+func (set *SortedSet) lexBounds(lexRange LexRange) (int, int) {
+	return set.bounds(func(item SortedSetItem) bool {
+		return lexRange.belowMin(item.Member)
+	}, func(item SortedSetItem) bool {
+		return lexRange.aboveMax(item.Member)
+	})
+}
+
+func (set *SortedSet) bounds(belowMin, aboveMax func(item SortedSetItem) bool) (int, int) {
+	first, _ := set.seek(belowMin)
+	last, _ := set.seek(func(item SortedSetItem) bool {
+		return !aboveMax(item)
+	})
+
+	if last < first {
+		return first, first
+	}
+
+	return first, last
+}
+
+func (set *SortedSet) rangeBetween(first, last, offset, count int, reverse bool) []SortedSetItem {
+	if offset < 0 || offset >= last-first {
+		return []SortedSetItem{}
+	}
+
+	if count < 0 || count > last-first-offset {
+		count = last - first - offset
+	}
+
+	if reverse {
+		return set.collect(last-1-offset, count, true)
+	}
+
+	return set.collect(first+offset, count, false)
+}
+
+func (set *SortedSet) collect(index, count int, reverse bool) []SortedSetItem {
+	items := make([]SortedSetItem, 0, count)
+	for node := set.nodeAt(index); node != nil && len(items) < count; {
+		items = append(items, node.item)
+
+		if reverse {
+			node = node.backward
+		} else {
+			node = node.levels[0].forward
+		}
+	}
+
+	return items
+}
+
+func (set *SortedSet) seek(before func(item SortedSetItem) bool) (int, *skiplistNode) {
+	index, current := 0, set.header
+	for level := set.level - 1; level >= 0; level-- {
+		for next := current.levels[level].forward; next != nil && before(next.item); next = current.levels[level].forward {
+			index += current.levels[level].span
+			current = next
+		}
+	}
+
+	return index, current.levels[0].forward
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistProbability {
+		level++
+	}
+
+	return level
+}
+
+func (set *SortedSet) insert(item SortedSetItem) {
+	node := &skiplistNode{item: item, levels: make([]skiplistLevel, randomLevel())}
+
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+
+	current := set.header
+	for level := set.level - 1; level >= 0; level-- {
+		if level < set.level-1 {
+			rank[level] = rank[level+1]
+		}
+
+		for next := current.levels[level].forward; next != nil && next.item.Less(item); next = current.levels[level].forward {
+			rank[level] += current.levels[level].span
+			current = next
+		}
+
+		update[level] = current
+	}
+
+	if len(node.levels) > set.level {
+		for level := set.level; level < len(node.levels); level++ {
+			rank[level] = 0
+			update[level] = set.header
+			update[level].levels[level].span = set.length
+		}
+
+		set.level = len(node.levels)
+	}
+
+	for level := range node.levels {
+		node.levels[level].forward = update[level].levels[level].forward
+		update[level].levels[level].forward = node
+
+		node.levels[level].span = update[level].levels[level].span - (rank[0] - rank[level])
+		update[level].levels[level].span = rank[0] - rank[level] + 1
+	}
+
+	for level := len(node.levels); level < set.level; level++ {
+		update[level].levels[level].span++
+	}
+
+	if update[0] != set.header {
+		node.backward = update[0]
+	}
+
+	if next := node.levels[0].forward; next != nil {
+		next.backward = node
+	} else {
+		set.tail = node
+	}
+
+	set.nodes[item.Member] = node
+	set.length++
+}
+
+func (set *SortedSet) delete(node *skiplistNode) {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	current := set.header
+	for level := set.level - 1; level >= 0; level-- {
+		for next := current.levels[level].forward; next != nil && next.item.Less(node.item); next = current.levels[level].forward {
+			current = next
+		}
+
+		update[level] = current
+	}
+
+	for level := 0; level < set.level; level++ {
+		if update[level].levels[level].forward == node {
+			update[level].levels[level].span += node.levels[level].span - 1
+			update[level].levels[level].forward = node.levels[level].forward
+		} else {
+			update[level].levels[level].span--
+		}
+	}
+
+	if next := node.levels[0].forward; next != nil {
+		next.backward = node.backward
+	} else {
+		set.tail = node.backward
+	}
+
+	for set.level > 1 && set.header.levels[set.level-1].forward == nil {
+		set.level--
+	}
+
+	delete(set.nodes, node.item.Member)
+	set.length--
+}
+
+func (set *SortedSet) nodeAt(index int) *skiplistNode {
+	traversed, current := -1, set.header
+	for level := set.level - 1; level >= 0; level-- {
+		for current.levels[level].forward != nil && traversed+current.levels[level].span <= index {
+			traversed += current.levels[level].span
+			current = current.levels[level].forward
+		}
+
+		if traversed == index {
+			return current
+		}
 	}
 
-	return append([]SortedSetItem{}, set.items[start:stop]...)
+	return nil
 }
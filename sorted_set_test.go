@@ -1,7 +1,11 @@
 package main
 
 import (
+	"math"
+	"math/rand"
 	"reflect"
+	"sort"
+	"strconv"
 	"testing"
 )
 
@@ -9,11 +13,10 @@ func TestMakeSortedSet(t *testing.T) {
 	t.Run("make empty sorted set", func(t *testing.T) {
 		sortedSet := MakeSortedSet()
 
-		expected := &SortedSet{
-			[]SortedSetItem{},
-			map[string]int{},
-		}
-		assertInterface(t, expected, sortedSet)
+		assertInterface(t, 0, sortedSet.Len())
+		assertInterface(t, 1, sortedSet.level)
+		assertInterface(t, map[string]*skiplistNode{}, sortedSet.nodes)
+		assertInterface(t, []SortedSetItem{}, sortedSet.Slice(0, 0))
 	})
 }
 
@@ -115,12 +118,358 @@ func TestSortSetSlice(t *testing.T) {
 			{4, 4, []SortedSetItem{}},
 			{3, 2, []SortedSetItem{}},
 			{5, 2, []SortedSetItem{}},
+			{0, -1, []SortedSetItem{{1, "one"}, {2, "two"}, {3, "three"}, {5, "five"}}},
+			{-10, 1, []SortedSetItem{{1, "one"}, {2, "two"}}},
+			{-1, -1, []SortedSetItem{{5, "five"}}},
+			{2, -3, []SortedSetItem{}},
+			{-1, 0, []SortedSetItem{}},
 		}
 
 		for _, te := range tests {
 			assertInterface(t, te.expected, sortedSet.Slice(te.start, te.stop))
 		}
 	})
+
+	t.Run("test multiple reverse ranges", func(t *testing.T) {
+		tests := []sortedSetSliceTestAux{
+			{0, -1, []SortedSetItem{{5, "five"}, {3, "three"}, {2, "two"}, {1, "one"}}},
+			{1, 2, []SortedSetItem{{3, "three"}, {2, "two"}}},
+			{-1, 10, []SortedSetItem{{1, "one"}}},
+			{4, 5, []SortedSetItem{}},
+		}
+
+		for _, te := range tests {
+			assertInterface(t, te.expected, sortedSet.ReverseSlice(te.start, te.stop))
+		}
+	})
+}
+
+func TestSortSetRemove(t *testing.T) {
+	sortedSet := MakeSortedSet()
+	sortedSet.Set(1, "one")
+	sortedSet.Set(2, "two")
+	sortedSet.Set(3, "three")
+	memory := sortedSet.Memory()
+
+	t.Run("remove members", func(t *testing.T) {
+		assertInterface(t, true, sortedSet.Remove("two"))
+		assertInterface(t, false, sortedSet.Remove("two"))
+		assertInterface(t, []SortedSetItem{{1, "one"}, {3, "three"}}, sortedSet.Slice(0, -1))
+		assertInterface(t, memory-int64(len("two")+sortedSetItemOverhead), sortedSet.Memory())
+
+		_, ok := sortedSet.Score("two")
+		assertInterface(t, false, ok)
+	})
+
+	t.Run("pop lowest and highest members", func(t *testing.T) {
+		sortedSet.Set(4, "four")
+		sortedSet.Set(5, "five")
+
+		assertInterface(t, []SortedSetItem{{1, "one"}, {3, "three"}}, sortedSet.Pop(2, false))
+		assertInterface(t, []SortedSetItem{{5, "five"}}, sortedSet.Pop(1, true))
+		assertInterface(t, []SortedSetItem{{4, "four"}}, sortedSet.Pop(5, true))
+		assertInterface(t, []SortedSetItem{}, sortedSet.Pop(1, false))
+		assertInterface(t, int64(0), sortedSet.Memory())
+	})
+}
+
+func TestSortSetRandom(t *testing.T) {
+	sortedSet := MakeSortedSet()
+	for index := 0; index < 10; index++ {
+		sortedSet.Set(float64(index), strconv.Itoa(index))
+	}
+
+	t.Run("pick distinct members", func(t *testing.T) {
+		items := sortedSet.Random(5)
+		assertInterface(t, 5, len(items))
+
+		seen := map[string]bool{}
+		for _, item := range items {
+			score, _ := sortedSet.Score(item.Member)
+			assertInterface(t, score, item.Score)
+			seen[item.Member] = true
+		}
+
+		assertInterface(t, 5, len(seen))
+		assertInterface(t, sortedSet.Slice(0, -1), sortedSet.Random(20))
+	})
+
+	t.Run("pick members with repetitions", func(t *testing.T) {
+		assertInterface(t, 20, len(sortedSet.Random(-20)))
+		assertInterface(t, []SortedSetItem{}, MakeSortedSet().Random(-3))
+	})
+
+	t.Run("bound repetitions by the set size", func(t *testing.T) {
+		assertInterface(t, []SortedSetItem{}, sortedSet.Random(math.MinInt64))
+
+		items := MakeSortedSet().Random(-1000000000)
+		assertInterface(t, []SortedSetItem{}, items)
+		assertInterface(t, 0, cap(items))
+	})
+}
+
+func TestSortSetOrder(t *testing.T) {
+	sortedSet := MakeSortedSet()
+	sortedSet.Set(1, "c")
+	sortedSet.Set(1, "a")
+	sortedSet.Set(0, "z")
+	sortedSet.Set(1, "b")
+	sortedSet.Set(5, "c")
+	sortedSet.Set(1, "c")
+
+	t.Run("order equal scores by member", func(t *testing.T) {
+		expected := []SortedSetItem{{0, "z"}, {1, "a"}, {1, "b"}, {1, "c"}}
+		assertInterface(t, expected, sortedSet.Slice(0, 3))
+	})
+
+	t.Run("rank equal scores by member", func(t *testing.T) {
+		for index, member := range []string{"z", "a", "b", "c"} {
+			position, _ := sortedSet.Position(member)
+			assertInterface(t, index, position)
+		}
+	})
+}
+
+type sortedSetScoreTestAux struct {
+	min, max      ScoreBound
+	offset, count int
+	reverse       bool
+	expected      []SortedSetItem
+}
+
+func TestSortSetRangeByScore(t *testing.T) {
+	sortedSet := MakeSortedSet()
+	sortedSet.Set(math.Inf(-1), "min")
+	sortedSet.Set(1, "a")
+	sortedSet.Set(2, "b")
+	sortedSet.Set(2, "c")
+	sortedSet.Set(3.5, "d")
+	sortedSet.Set(math.Inf(1), "max")
+
+	minusInf, plusInf := ScoreBound{Score: math.Inf(-1)}, ScoreBound{Score: math.Inf(1)}
+
+	t.Run("test multiple ranges", func(t *testing.T) {
+		tests := []sortedSetScoreTestAux{
+			{minusInf, plusInf, 0, -1, false, sortedSet.Slice(0, 5)},
+			{ScoreBound{1, false}, ScoreBound{2, false}, 0, -1, false, []SortedSetItem{{1, "a"}, {2, "b"}, {2, "c"}}},
+			{ScoreBound{1, true}, ScoreBound{3.5, true}, 0, -1, false, []SortedSetItem{{2, "b"}, {2, "c"}}},
+			{ScoreBound{math.Inf(-1), true}, ScoreBound{math.Inf(1), true}, 1, 2, false, []SortedSetItem{{2, "b"}, {2, "c"}}},
+			{ScoreBound{2, false}, plusInf, 0, -1, true, []SortedSetItem{{math.Inf(1), "max"}, {3.5, "d"}, {2, "c"}, {2, "b"}}},
+			{minusInf, ScoreBound{3, false}, 1, 2, true, []SortedSetItem{{2, "b"}, {1, "a"}}},
+			{ScoreBound{2.5, false}, ScoreBound{3, false}, 0, -1, false, []SortedSetItem{}},
+			{ScoreBound{2, true}, ScoreBound{2, false}, 0, -1, false, []SortedSetItem{}},
+			{ScoreBound{3, false}, ScoreBound{1, false}, 0, -1, false, []SortedSetItem{}},
+			{minusInf, plusInf, 6, -1, false, []SortedSetItem{}},
+		}
+
+		for _, te := range tests {
+			scoreRange := ScoreRange{te.min, te.max}
+			assertInterface(t, te.expected, sortedSet.RangeByScore(scoreRange, te.offset, te.count, te.reverse))
+			if te.offset == 0 && te.count < 0 {
+				assertInterface(t, len(te.expected), sortedSet.ScoreCount(scoreRange))
+			}
+		}
+	})
+
+	t.Run("remove range", func(t *testing.T) {
+		memory := sortedSet.Memory()
+
+		assertInterface(t, 3, sortedSet.RemoveRangeByScore(ScoreRange{ScoreBound{1, true}, ScoreBound{3.5, false}}))
+		assertInterface(t, []SortedSetItem{{math.Inf(-1), "min"}, {1, "a"}, {math.Inf(1), "max"}}, sortedSet.Slice(0, 5))
+		assertInterface(t, memory-int64(len("bcd")+3*sortedSetItemOverhead), sortedSet.Memory())
+
+		position, _ := sortedSet.Position("max")
+		assertInterface(t, 2, position)
+	})
+}
+
+type sortedSetLexTestAux struct {
+	min, max      LexBound
+	offset, count int
+	reverse       bool
+	expected      []string
+}
+
+func TestSortSetRangeByLex(t *testing.T) {
+	sortedSet := MakeSortedSet()
+	for _, member := range []string{"e", "a", "d", "b", "g", "c", "f"} {
+		sortedSet.Set(0, member)
+	}
+
+	minusInf, plusInf := LexBound{Infinity: -1}, LexBound{Infinity: 1}
+
+	t.Run("test multiple ranges", func(t *testing.T) {
+		tests := []sortedSetLexTestAux{
+			{minusInf, plusInf, 0, -1, false, []string{"a", "b", "c", "d", "e", "f", "g"}},
+			{minusInf, LexBound{Member: "c"}, 0, -1, false, []string{"a", "b", "c"}},
+			{minusInf, LexBound{Member: "c", Exclusive: true}, 0, -1, false, []string{"a", "b"}},
+			{LexBound{Member: "aa"}, LexBound{Member: "g", Exclusive: true}, 0, -1, false, []string{"b", "c", "d", "e", "f"}},
+			{LexBound{Member: "b", Exclusive: true}, plusInf, 1, 2, false, []string{"d", "e"}},
+			{LexBound{Member: "b"}, LexBound{Member: "e"}, 0, -1, true, []string{"e", "d", "c", "b"}},
+			{minusInf, plusInf, 2, 3, true, []string{"e", "d", "c"}},
+			{minusInf, plusInf, 7, -1, false, []string{}},
+			{minusInf, plusInf, -1, 2, false, []string{}},
+			{LexBound{Member: "e"}, LexBound{Member: "b"}, 0, -1, false, []string{}},
+			{LexBound{Member: "c", Exclusive: true}, LexBound{Member: "c"}, 0, -1, false, []string{}},
+			{plusInf, minusInf, 0, -1, false, []string{}},
+			{LexBound{Member: "h"}, plusInf, 0, -1, false, []string{}},
+		}
+
+		for _, te := range tests {
+			lexRange := LexRange{te.min, te.max}
+			items := sortedSet.RangeByLex(lexRange, te.offset, te.count, te.reverse)
+
+			members := make([]string, len(items))
+			for index, item := range items {
+				members[index] = item.Member
+			}
+
+			assertInterface(t, te.expected, members)
+			if te.offset == 0 && te.count < 0 {
+				assertInterface(t, len(te.expected), sortedSet.LexCount(lexRange))
+			}
+		}
+	})
+}
+
+func TestSortSetSkiplist(t *testing.T) {
+	sortedSet := MakeSortedSet()
+	model := map[string]float64{}
+	random := rand.New(rand.NewSource(1))
+
+	for index := 0; index < 5000; index++ {
+		member := strconv.Itoa(random.Intn(500))
+		score := float64(random.Intn(50))
+
+		_, ok := model[member]
+		model[member] = score
+
+		assertInterface(t, !ok, sortedSet.Set(score, member))
+	}
+
+	expected := make([]SortedSetItem, 0, len(model))
+	for member, score := range model {
+		expected = append(expected, SortedSetItem{score, member})
+	}
+
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].Less(expected[j])
+	})
+
+	t.Run("keep members ordered", func(t *testing.T) {
+		assertInterface(t, len(expected), sortedSet.Len())
+		assertInterface(t, expected, sortedSet.Slice(0, sortedSet.Len()-1))
+		assertInterface(t, expected[100:200], sortedSet.Slice(100, 199))
+	})
+
+	t.Run("rank every member", func(t *testing.T) {
+		for index, item := range expected {
+			if position, ok := sortedSet.Position(item.Member); !ok || position != index {
+				t.Fatalf("%s: expected %d, got %d", item.Member, index, position)
+			}
+		}
+	})
+
+	t.Run("link nodes backwards", func(t *testing.T) {
+		index := len(expected) - 1
+		for node := sortedSet.tail; node != nil; node = node.backward {
+			assertInterface(t, expected[index], node.item)
+			index--
+		}
+
+		assertInterface(t, -1, index)
+	})
+
+	t.Run("clone members", func(t *testing.T) {
+		clone := sortedSet.Clone()
+		clone.Set(-1, "new")
+
+		assertInterface(t, expected, sortedSet.Slice(0, sortedSet.Len()-1))
+		assertInterface(t, append([]SortedSetItem{{-1, "new"}}, expected...), clone.Slice(0, clone.Len()-1))
+	})
+}
+
+const sortedSetMembersCount = 1000000
+
+var benchmarkSortedSet *SortedSet
+
+func sortedSetBenchmarkAux(b *testing.B) *SortedSet {
+	if benchmarkSortedSet == nil {
+		b.StopTimer()
+		benchmarkSortedSet = MakeSortedSet()
+		for x := 0; x < sortedSetMembersCount; x++ {
+			benchmarkSortedSet.Set(rand.Float64(), "member:"+strconv.Itoa(x))
+		}
+		b.StartTimer()
+	}
+
+	return benchmarkSortedSet
+}
+
+func BenchmarkSortedSetInsert1M(b *testing.B) {
+	members := make([]string, sortedSetMembersCount)
+	for x := range members {
+		members[x] = "member:" + strconv.Itoa(x)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		sortedSet := MakeSortedSet()
+		for _, member := range members {
+			sortedSet.Set(rand.Float64(), member)
+		}
+	}
+}
+
+func BenchmarkSortedSetUpdate1M(b *testing.B) {
+	sortedSet := sortedSetBenchmarkAux(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		sortedSet.Set(rand.Float64(), "member:"+strconv.Itoa(n%sortedSetMembersCount))
+	}
+}
+
+func BenchmarkSortedSetPosition1M(b *testing.B) {
+	sortedSet := sortedSetBenchmarkAux(b)
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		sortedSet.Position("member:" + strconv.Itoa(n%sortedSetMembersCount))
+	}
+}
+
+func BenchmarkSortedSetSlice1M(b *testing.B) {
+	sortedSet := sortedSetBenchmarkAux(b)
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		start := rand.Intn(sortedSetMembersCount - 10)
+		sortedSet.Slice(start, start+9)
+	}
+}
+
+func BenchmarkSortedSetRangeByScore1M(b *testing.B) {
+	sortedSet := sortedSetBenchmarkAux(b)
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		min := rand.Float64()
+		sortedSet.RangeByScore(ScoreRange{ScoreBound{Score: min}, ScoreBound{Score: min + 0.00001}}, 0, -1, false)
+	}
+}
+
+func BenchmarkSortedSetRandom1M(b *testing.B) {
+	sortedSet := sortedSetBenchmarkAux(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		sortedSet.Random(1)
+	}
 }
 
 func assertInterface(t *testing.T, expected, got interface{}) {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const defaultHeartbeatInterval = 15 * time.Second
+
+type sseMessage struct {
+	Pattern string `json:"pattern,omitempty"`
+	Channel string `json:"channel"`
+	Payload string `json:"payload"`
+}
+
+func (handler HttpHandler) serveSubscribe(w http.ResponseWriter, req *http.Request) {
+	channels, patterns := req.FormValue("channel"), req.FormValue("pattern")
+	encoding := req.FormValue("encoding")
+
+	var err error
+	if channels == "" && patterns == "" {
+		err = errors.New("No valid \"channel\" or \"pattern\" query parameter identified")
+	} else if encoding != "" && encoding != "base64" {
+		err = fmt.Errorf("Unsupported \"encoding\" query parameter %q", encoding)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if err == nil && !ok {
+		err = errors.New("Streaming is not supported by this connection")
+	}
+
+	if err != nil {
+		if err := respondJson(w, http.StatusBadRequest, map[string]string{"error": err.Error()}); err != nil {
+			log.Printf("Got the following error while serving http request: %v", err)
+		}
+		return
+	}
+
+	subscriber := NewSubscriber(defaultSubscriberBuffer)
+	defer handler.UnsubscribeAll(subscriber)
+
+	handler.Subscribe(subscriber, req.Form["channel"]...)
+	handler.PSubscribe(subscriber, req.Form["pattern"]...)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	interval := handler.HeartbeatInterval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case message := <-subscriber.Messages():
+			err = writeSseMessage(w, message, encoding)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case <-subscriber.Evicted():
+			log.Printf("Closing event stream to %v: subscriber output buffer limit reached", req.RemoteAddr)
+			return
+		case <-req.Context().Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		if len(subscriber.Messages()) == 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSseMessage(w http.ResponseWriter, message Message, encoding string) error {
+	payload := message.Payload
+	if encoding == "base64" {
+		payload = base64.StdEncoding.EncodeToString([]byte(payload))
+	}
+
+	data, err := json.Marshal(sseMessage{message.Pattern, message.Channel, payload})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	return err
+}
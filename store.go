@@ -2,79 +2,305 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Store struct {
-	values sync.Map
-	locks  sync.Map
-	timers sync.Map
+	shards      [storeShards]storeShard
+	keys        int64
+	expires     expireState
+	blocked     blockedRegistry
+	pubsub      pubSub
+	watched     watchRegistry
+	txnLock     sync.RWMutex
+	snapshots   snapshotState
+	aof         appendOnlyFile
+	propagation propagationState
+	replication replicationState
+	memory      memoryState
+}
+
+type entry struct {
+	value     Value
+	deadline  int64
+	size      int64
+	access    int64
+	frequency uint64
+	expiry    *expireItem
+}
+
+func newEntry(value Value, deadline int64, previous *entry) *entry {
+	now := time.Now().UnixNano()
+	e := &entry{value: value, deadline: deadline, access: now, frequency: lfuPack(lfuInitValue, now)}
+	if previous != nil {
+		e.frequency = atomic.LoadUint64(&previous.frequency)
+	}
+
+	return e
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.deadline != 0 && e.deadline <= now
 }
 
 type UnlockCallback func()
 
 func (store *Store) LockKey(key string) UnlockCallback {
-	actual, _ := store.locks.LoadOrStore(key, new(sync.Mutex))
+	return store.LockKeys(key)
+}
+
+func (store *Store) LockKeys(keys ...string) UnlockCallback {
+	indexes := shardIndexes(keys)
+
+	locked := make([]*storeShard, len(indexes))
+	for position, index := range indexes {
+		locked[position] = store.lockShard(index)
+	}
 
-	mutex := actual.(*sync.Mutex)
-	mutex.Lock()
+	now := time.Now().UnixNano()
+	for _, key := range keys {
+		if e, ok := store.lookup(key); ok && e.expired(now) {
+			store.remove(key, e)
+		}
+	}
 
 	return func() {
-		mutex.Unlock()
+		for index := len(locked) - 1; index >= 0; index-- {
+			locked[index].mutex.Unlock()
+		}
+	}
+}
+
+func (store *Store) RLockKey(key string) UnlockCallback {
+	return store.RLockKeys(key)
+}
+
+func (store *Store) RLockKeys(keys ...string) UnlockCallback {
+	indexes := shardIndexes(keys)
+	for _, index := range indexes {
+		store.shards[index].mutex.RLock()
+	}
+
+	unlock := func() {
+		for position := len(indexes) - 1; position >= 0; position-- {
+			store.shards[indexes[position]].mutex.RUnlock()
+		}
+	}
+
+	now := time.Now().UnixNano()
+	for _, key := range keys {
+		if e, ok := store.lookup(key); ok && e.expired(now) {
+			unlock()
+			return store.LockKeys(keys...)
+		}
+	}
+
+	return unlock
+}
+
+func shardIndexes(keys []string) []int {
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, shardIndex(key))
+	}
+	sort.Ints(indexes)
+
+	unique := indexes[:0]
+	for position, index := range indexes {
+		if position == 0 || index != indexes[position-1] {
+			unique = append(unique, index)
+		}
 	}
+
+	return unique
 }
 
 type Value interface{}
 
+type WrongTypeError struct {
+	Key      string
+	Expected string
+}
+
+func (err WrongTypeError) Error() string {
+	return fmt.Sprintf("miniredis: key %q value is not a %s", err.Key, err.Expected)
+}
+
 func (store *Store) Set(key string, value Value) (bool, error) {
 	return store.SetEx(key, value, -1)
 }
 
 func (store *Store) SetEx(key string, value Value, seconds int) (bool, error) {
+	if seconds > -1 {
+		return store.SetWithDeadline(key, value, time.Now().Add(time.Second*time.Duration(seconds)))
+	}
+
+	return store.SetWithDeadline(key, value, time.Time{})
+}
+
+func (store *Store) SetWithDeadline(key string, value Value, deadline time.Time) (bool, error) {
+	if bytes, ok := value.([]byte); ok {
+		value = string(bytes)
+	}
+
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	store.clearTtlTimer(key)
+	store.put(key, value, toDeadline(deadline))
 
-	store.values.Store(key, value)
+	return true, nil
+}
 
-	if seconds > -1 {
-		store.setTtlTimer(key, seconds)
+func (store *Store) load(key string) (*entry, bool) {
+	e, ok := store.lookup(key)
+	if !ok {
+		return nil, false
 	}
 
-	return true, nil
+	now := time.Now().UnixNano()
+	if e.expired(now) {
+		return nil, false
+	}
+
+	store.accessed(e, now)
+	return e, true
 }
 
-func (store *Store) setTtlTimer(key string, seconds int) {
-	duration := time.Second * time.Duration(seconds)
-	timer := time.AfterFunc(duration, func() {
-		store.del(key)
-	})
+func (store *Store) loadValue(key string) (Value, bool) {
+	if e, ok := store.load(key); ok {
+		return e.value, true
+	}
 
-	store.timers.Store(key, timer)
+	return nil, false
 }
 
-func (store *Store) clearTtlTimer(key string) {
-	if actual, ok := store.timers.Load(key); ok {
-		timer := actual.(*time.Timer)
-		timer.Stop()
+func (store *Store) put(key string, value Value, deadline int64) {
+	shard := store.shard(key)
+	previous, ok := shard.entries[key]
+	if ok {
+		store.unaccount(previous)
+	} else {
+		if shard.entries == nil {
+			shard.entries = make(map[string]*entry)
+		}
 
-		store.timers.Delete(key)
+		atomic.AddInt64(&store.keys, 1)
 	}
+
+	e := newEntry(value, deadline, previous)
+	shard.entries[key] = e
+	store.scheduleExpire(shard, key, e, previous)
+	store.touch(key)
 }
 
-func (store *Store) Get(key string) (string, bool, error) {
+func (store *Store) update(key string, e *entry, value Value) {
+	next := newEntry(value, e.deadline, e)
+	next.expiry = e.expiry
+
+	store.unaccount(e)
+	store.shard(key).entries[key] = next
+	store.touch(key)
+}
+
+func (store *Store) remove(key string, e *entry) {
+	shard := store.shard(key)
+	delete(shard.entries, key)
+	atomic.AddInt64(&store.keys, -1)
+
+	store.unscheduleExpire(shard, e)
+	store.unaccount(e)
+	store.touch(key)
+}
+
+func (store *Store) touch(key string) {
+	store.account(key)
+	store.touchWatched(key)
+}
+
+func (store *Store) drop(key string) {
+	if e, ok := store.lookup(key); ok {
+		store.remove(key, e)
+	}
+}
+
+type ExpireFlags int
+
+const (
+	ExpireNX ExpireFlags = 1 << iota
+	ExpireXX
+	ExpireGT
+	ExpireLT
+)
+
+func (store *Store) Expire(key string, deadline time.Time, flags ExpireFlags) bool {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	e, ok := store.load(key)
+	if !ok {
+		return false
+	}
+
+	next, volatile := toDeadline(deadline), e.deadline != 0
+	switch {
+	case flags&ExpireNX != 0 && volatile,
+		flags&ExpireXX != 0 && !volatile,
+		flags&ExpireGT != 0 && (!volatile || next <= e.deadline),
+		flags&ExpireLT != 0 && volatile && next >= e.deadline:
+		return false
+	}
+
+	if next <= time.Now().UnixNano() {
+		store.remove(key, e)
+	} else {
+		store.put(key, e.value, next)
+	}
+
+	return true
+}
+
+func (store *Store) Deadline(key string) (time.Time, bool, bool) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	e, ok := store.load(key)
+	if !ok {
+		return time.Time{}, false, false
+	}
+
+	return fromDeadline(e.deadline), true, e.deadline != 0
+}
+
+func (store *Store) Persist(key string) bool {
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	if actual, ok := store.values.Load(key); ok {
+	e, ok := store.load(key)
+	if !ok || e.deadline == 0 {
+		return false
+	}
+
+	store.put(key, e.value, 0)
+	return true
+}
+
+func (store *Store) Get(key string) (string, bool, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	if actual, ok := store.loadValue(key); ok {
 		switch typed := actual.(type) {
 		case string:
 			return typed, true, nil
 		case int:
 			return strconv.Itoa(typed), true, nil
+		case *SortedSet, *Hash, *List, *Set:
+			return "", false, WrongTypeError{key, "string"}
 		default:
 			return "", false, fmt.Errorf("miniredis: cant return %v of type %T as string", typed, typed)
 		}
@@ -98,10 +324,8 @@ func (store *Store) del(key string) bool {
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	if _, ok := store.values.Load(key); ok {
-		store.clearTtlTimer(key)
-		store.values.Delete(key)
-
+	if e, ok := store.load(key); ok {
+		store.remove(key, e)
 		return true
 	}
 
@@ -109,23 +333,21 @@ func (store *Store) del(key string) bool {
 }
 
 func (store *Store) DbSize() int {
-	count := 0
-	store.values.Range(func(_, _ interface{}) bool {
-		count++
-		return true
-	})
-
-	return count
+	return int(atomic.LoadInt64(&store.keys))
 }
 
 func (store *Store) Incr(key string) (int, error) {
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	actual, _ := store.values.LoadOrStore(key, 0)
+	e, ok := store.load(key)
+	if !ok {
+		store.put(key, 1, 0)
+		return 1, nil
+	}
 
 	var num int
-	switch typed := actual.(type) {
+	switch typed := e.value.(type) {
 	case int:
 		num = typed
 	case string:
@@ -135,85 +357,1089 @@ func (store *Store) Incr(key string) (int, error) {
 		}
 
 		num = value
+	case *SortedSet, *Hash, *List, *Set:
+		return 0, WrongTypeError{key, "string"}
 	default:
 		return 0, fmt.Errorf("miniredis: cant convert value %q to integer", typed)
 	}
 
 	num++
-	store.values.Store(key, num)
+	store.update(key, e, num)
 
 	return num, nil
 }
 
+func (store *Store) loadSortedSet(key string, create bool) (*SortedSet, error) {
+	actual, ok := store.loadValue(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+
+		sortedSet := MakeSortedSet()
+		store.put(key, sortedSet, 0)
+		return sortedSet, nil
+	}
+
+	if sortedSet, ok := actual.(*SortedSet); ok {
+		return sortedSet, nil
+	}
+
+	return nil, WrongTypeError{key, "sorted set"}
+}
+
+type ZAddFlags int
+
+const (
+	ZAddNX ZAddFlags = 1 << iota
+	ZAddXX
+	ZAddGT
+	ZAddLT
+	ZAddCH
+)
+
+func (flags ZAddFlags) allows(current float64, exists bool, next float64) bool {
+	switch {
+	case flags&ZAddNX != 0 && exists,
+		flags&ZAddXX != 0 && !exists,
+		flags&ZAddGT != 0 && exists && next <= current,
+		flags&ZAddLT != 0 && exists && next >= current:
+		return false
+	}
+
+	return true
+}
+
 func (store *Store) ZAdd(key string, sets ...SortedSetItem) (int, error) {
+	return store.ZAddWithFlags(key, 0, sets...)
+}
+
+func (store *Store) ZAddWithFlags(key string, flags ZAddFlags, sets ...SortedSetItem) (int, error) {
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	actual, _ := store.values.LoadOrStore(key, MakeSortedSet())
-
-	var sortedSet *SortedSet
-	switch typed := actual.(type) {
-	case *SortedSet:
-		sortedSet = typed
-	default:
-		return 0, fmt.Errorf("miniredis: key %q value is not a sorted set: %q", key, typed)
+	sortedSet, err := store.loadSortedSet(key, flags&ZAddXX == 0)
+	if sortedSet == nil {
+		return 0, err
 	}
 
-	count := 0
+	added, updated := 0, 0
 	for _, set := range sets {
-		if sortedSet.Set(set.Score, set.Member) {
-			count++
+		current, exists := sortedSet.Score(set.Member)
+		if !flags.allows(current, exists, set.Score) {
+			continue
+		}
+
+		switch {
+		case !exists:
+			added++
+		case current != set.Score:
+			updated++
 		}
+
+		sortedSet.Set(set.Score, set.Member)
 	}
 
-	return count, nil
+	if sortedSet.Len() == 0 {
+		store.drop(key)
+	} else if added+updated > 0 {
+		store.touch(key)
+	}
+
+	if flags&ZAddCH != 0 {
+		return added + updated, nil
+	}
+
+	return added, nil
 }
 
-func (store *Store) ZCard(key string) (int, error) {
+func (store *Store) ZIncrBy(key string, flags ZAddFlags, set SortedSetItem) (float64, bool, error) {
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	if actual, ok := store.values.Load(key); ok {
-		switch typed := actual.(type) {
-		case *SortedSet:
-			return typed.Len(), nil
-		default:
-			return 0, fmt.Errorf("miniredis: key %q value is not a sorted set: %q", key, typed)
-		}
+	sortedSet, err := store.loadSortedSet(key, flags&ZAddXX == 0)
+	if sortedSet == nil {
+		return 0, false, err
+	}
+
+	current, exists := sortedSet.Score(set.Member)
+	score := current + set.Score
+	switch {
+	case math.IsNaN(score):
+		err = fmt.Errorf("miniredis: resulting score is not a number (NaN)")
+	case flags.allows(current, exists, score):
+		sortedSet.Set(score, set.Member)
+		store.touch(key)
+		return score, true, nil
+	}
+
+	if sortedSet.Len() == 0 {
+		store.drop(key)
+	}
+
+	return 0, false, err
+}
+
+func (store *Store) ZCard(key string) (int, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, err
 	}
 
-	return 0, nil
+	return sortedSet.Len(), nil
 }
 
 func (store *Store) ZRank(key, member string) (int, bool, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, false, err
+	}
+
+	index, ok := sortedSet.Position(member)
+	return index, ok, nil
+}
+
+func (store *Store) ZRange(key string, start, stop int) ([]SortedSetItem, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return []SortedSetItem{}, err
+	}
+
+	return sortedSet.Slice(start, stop), nil
+}
+
+func (store *Store) ZRevRank(key, member string) (int, bool, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, false, err
+	}
+
+	index, ok := sortedSet.Position(member)
+	if !ok {
+		return 0, false, nil
+	}
+
+	return sortedSet.Len() - 1 - index, true, nil
+}
+
+func (store *Store) ZRevRange(key string, start, stop int) ([]SortedSetItem, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return []SortedSetItem{}, err
+	}
+
+	return sortedSet.ReverseSlice(start, stop), nil
+}
+
+func (store *Store) ZScore(key, member string) (float64, bool, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, false, err
+	}
+
+	score, ok := sortedSet.Score(member)
+	return score, ok, nil
+}
+
+func (store *Store) ZMScore(key string, members ...string) ([]interface{}, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]interface{}, len(members))
+	if sortedSet != nil {
+		for index, member := range members {
+			if score, ok := sortedSet.Score(member); ok {
+				scores[index] = score
+			}
+		}
+	}
+
+	return scores, nil
+}
+
+func (store *Store) ZRem(key string, members ...string) (int, error) {
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	if actual, ok := store.values.Load(key); ok {
-		switch typed := actual.(type) {
-		case *SortedSet:
-			index, ok := typed.Position(member)
-			return index, ok, nil
-		default:
-			return 0, false, fmt.Errorf("miniredis: key %q value is not a sorted set: %q", key, typed)
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, member := range members {
+		if sortedSet.Remove(member) {
+			count++
 		}
 	}
 
-	return 0, false, nil
+	if sortedSet.Len() == 0 {
+		store.drop(key)
+	} else if count > 0 {
+		store.touch(key)
+	}
+
+	return count, nil
 }
 
-func (store *Store) ZRange(key string, start, stop int) ([]SortedSetItem, error) {
+func (store *Store) ZPopMin(key string, count int) ([]SortedSetItem, error) {
+	return store.zPop(key, count, false)
+}
+
+func (store *Store) ZPopMax(key string, count int) ([]SortedSetItem, error) {
+	return store.zPop(key, count, true)
+}
+
+func (store *Store) zPop(key string, count int, max bool) ([]SortedSetItem, error) {
 	unlock := store.LockKey(key)
 	defer unlock()
 
-	if actual, ok := store.values.Load(key); ok {
-		switch typed := actual.(type) {
-		case *SortedSet:
-			return typed.Slice(start, stop), nil
-		default:
-			return nil, fmt.Errorf("miniredis: key %q value is not a sorted set: %q", key, typed)
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return []SortedSetItem{}, err
+	}
+
+	items := sortedSet.Pop(count, max)
+	if sortedSet.Len() == 0 {
+		store.drop(key)
+	} else if len(items) > 0 {
+		store.touch(key)
+	}
+
+	return items, nil
+}
+
+func (store *Store) ZRandMember(key string, count int) ([]SortedSetItem, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return []SortedSetItem{}, err
+	}
+
+	return sortedSet.Random(count), nil
+}
+
+func (store *Store) ZRangeByScore(key string, scoreRange ScoreRange, offset, count int, reverse bool) ([]SortedSetItem, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return []SortedSetItem{}, err
+	}
+
+	return sortedSet.RangeByScore(scoreRange, offset, count, reverse), nil
+}
+
+func (store *Store) ZCount(key string, scoreRange ScoreRange) (int, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, err
+	}
+
+	return sortedSet.ScoreCount(scoreRange), nil
+}
+
+func (store *Store) ZRemRangeByScore(key string, scoreRange ScoreRange) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, err
+	}
+
+	removed := sortedSet.RemoveRangeByScore(scoreRange)
+	if sortedSet.Len() == 0 {
+		store.drop(key)
+	} else if removed > 0 {
+		store.touch(key)
+	}
+
+	return removed, nil
+}
+
+func (store *Store) ZRangeByLex(key string, lexRange LexRange, offset, count int, reverse bool) ([]SortedSetItem, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return []SortedSetItem{}, err
+	}
+
+	return sortedSet.RangeByLex(lexRange, offset, count, reverse), nil
+}
+
+func (store *Store) ZLexCount(key string, lexRange LexRange) (int, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	sortedSet, err := store.loadSortedSet(key, false)
+	if sortedSet == nil {
+		return 0, err
+	}
+
+	return sortedSet.LexCount(lexRange), nil
+}
+
+func (store *Store) loadHash(key string, create bool) (*Hash, error) {
+	actual, ok := store.loadValue(key)
+	if !ok {
+		if !create {
+			return nil, nil
 		}
+
+		hash := MakeHash()
+		store.put(key, hash, 0)
+		return hash, nil
+	}
+
+	if hash, ok := actual.(*Hash); ok {
+		return hash, nil
 	}
 
-	return []SortedSetItem{}, nil
+	return nil, WrongTypeError{key, "hash"}
+}
+
+func (store *Store) HSet(key string, items ...HashItem) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, item := range items {
+		if hash.Set(item.Field, item.Value) {
+			count++
+		}
+	}
+
+	store.touch(key)
+	return count, nil
+}
+
+func (store *Store) HGet(key, field string) (string, bool, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, false)
+	if hash == nil {
+		return "", false, err
+	}
+
+	value, ok := hash.Get(field)
+	return value, ok, nil
+}
+
+func (store *Store) HMGet(key string, fields ...string) ([]interface{}, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(fields))
+	if hash != nil {
+		for index, field := range fields {
+			if value, ok := hash.Get(field); ok {
+				values[index] = value
+			}
+		}
+	}
+
+	return values, nil
+}
+
+func (store *Store) HDel(key string, fields ...string) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, false)
+	if hash == nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, field := range fields {
+		if hash.Del(field) {
+			count++
+		}
+	}
+
+	if hash.Len() == 0 {
+		store.drop(key)
+	} else if count > 0 {
+		store.touch(key)
+	}
+
+	return count, nil
+}
+
+func (store *Store) HGetAll(key string) ([]HashItem, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, false)
+	if hash == nil {
+		return []HashItem{}, err
+	}
+
+	return hash.Items(), nil
+}
+
+func (store *Store) HIncrBy(key, field string, delta int) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	num := 0
+	if value, ok := hash.Get(field); ok {
+		if num, err = strconv.Atoi(value); err != nil {
+			return 0, fmt.Errorf("miniredis: hash value is not an integer")
+		}
+	}
+
+	if (delta > 0 && num > math.MaxInt64-delta) || (delta < 0 && num < math.MinInt64-delta) {
+		return 0, fmt.Errorf("miniredis: increment or decrement would overflow")
+	}
+
+	num += delta
+	hash.Set(field, strconv.Itoa(num))
+	store.touch(key)
+
+	return num, nil
+}
+
+func (store *Store) HLen(key string) (int, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, false)
+	if hash == nil {
+		return 0, err
+	}
+
+	return hash.Len(), nil
+}
+
+func (store *Store) HExists(key, field string) (bool, error) {
+	_, ok, err := store.HGet(key, field)
+	return ok, err
+}
+
+func (store *Store) HKeys(key string) ([]string, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, false)
+	if hash == nil {
+		return []string{}, err
+	}
+
+	return hash.Keys(), nil
+}
+
+func (store *Store) HVals(key string) ([]string, error) {
+	items, err := store.HGetAll(key)
+
+	values := make([]string, len(items))
+	for index, item := range items {
+		values[index] = item.Value
+	}
+
+	return values, err
+}
+
+func (store *Store) HScan(key string, cursor uint64, count int, pattern string) ([]HashItem, uint64, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	hash, err := store.loadHash(key, false)
+	if hash == nil {
+		return []HashItem{}, 0, err
+	}
+
+	items, next := hash.Scan(cursor, count, pattern)
+	return items, next, nil
+}
+
+func (store *Store) loadList(key string, create bool) (*List, error) {
+	actual, ok := store.loadValue(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+
+		list := MakeList()
+		store.put(key, list, 0)
+		return list, nil
+	}
+
+	if list, ok := actual.(*List); ok {
+		return list, nil
+	}
+
+	return nil, WrongTypeError{key, "list"}
+}
+
+func (store *Store) touchList(key string, list *List, modified bool) {
+	if list.Len() == 0 {
+		store.drop(key)
+	} else if modified {
+		store.touch(key)
+	}
+}
+
+func (store *Store) LPush(key string, values ...string) (int, error) {
+	return store.push(key, ListLeft, values...)
+}
+
+func (store *Store) RPush(key string, values ...string) (int, error) {
+	return store.push(key, ListRight, values...)
+}
+
+func (store *Store) push(key string, end ListEnd, values ...string) (int, error) {
+	unlock := store.LockKey(key)
+
+	list, err := store.loadList(key, true)
+	if err != nil {
+		unlock()
+		return 0, err
+	}
+
+	list.Push(end, values...)
+	store.touch(key)
+	length := list.Len()
+	unlock()
+
+	store.serveBlocked(key)
+	return length, nil
+}
+
+func (store *Store) LPop(key string, count int) ([]string, error) {
+	return store.pop(key, ListLeft, count)
+}
+
+func (store *Store) RPop(key string, count int) ([]string, error) {
+	return store.pop(key, ListRight, count)
+}
+
+func (store *Store) pop(key string, end ListEnd, count int) ([]string, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+	for len(values) < count {
+		value, ok := list.Pop(end)
+		if !ok {
+			break
+		}
+
+		values = append(values, value)
+	}
+
+	store.touchList(key, list, len(values) > 0)
+	return values, nil
+}
+
+func (store *Store) LLen(key string) (int, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil {
+		return 0, err
+	}
+
+	return list.Len(), nil
+}
+
+func (store *Store) LRange(key string, start, stop int) ([]string, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil {
+		return []string{}, err
+	}
+
+	return list.Slice(start, stop), nil
+}
+
+func (store *Store) LIndex(key string, index int) (string, bool, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil {
+		return "", false, err
+	}
+
+	value, ok := list.Index(index)
+	return value, ok, nil
+}
+
+func (store *Store) LSet(key string, index int, value string) error {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	switch {
+	case err != nil:
+		return err
+	case list == nil:
+		return fmt.Errorf("miniredis: no such key")
+	case !list.Set(index, value):
+		return fmt.Errorf("miniredis: index out of range")
+	}
+
+	store.touch(key)
+	return nil
+}
+
+func (store *Store) LRem(key string, count int, value string) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil {
+		return 0, err
+	}
+
+	removed := list.Remove(count, value)
+	store.touchList(key, list, removed > 0)
+
+	return removed, nil
+}
+
+func (store *Store) LTrim(key string, start, stop int) error {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil {
+		return err
+	}
+
+	list.Trim(start, stop)
+	store.touchList(key, list, true)
+
+	return nil
+}
+
+func (store *Store) LInsert(key string, before bool, pivot, value string) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	list, err := store.loadList(key, false)
+	if list == nil {
+		return 0, err
+	}
+
+	if !list.Insert(before, pivot, value) {
+		return -1, nil
+	}
+
+	store.touch(key)
+	return list.Len(), nil
+}
+
+func (store *Store) LMove(source, destination string, from, to ListEnd) (string, bool, error) {
+	unlock := store.LockKeys(source, destination)
+	value, ok, err := store.lMove(source, destination, from, to)
+	unlock()
+
+	if ok {
+		store.serveBlocked(destination)
+	}
+
+	return value, ok, err
+}
+
+func (store *Store) lMove(source, destination string, from, to ListEnd) (string, bool, error) {
+	src, err := store.loadList(source, false)
+	if src == nil {
+		return "", false, err
+	}
+
+	if _, err := store.loadList(destination, false); err != nil {
+		return "", false, err
+	}
+
+	value, _ := src.Pop(from)
+	store.touchList(source, src, true)
+
+	dst, _ := store.loadList(destination, true)
+	dst.Push(to, value)
+	store.touch(destination)
+
+	return value, true, nil
+}
+
+func (store *Store) loadSet(key string, create bool) (*Set, error) {
+	actual, ok := store.loadValue(key)
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+
+		set := MakeSet()
+		store.put(key, set, 0)
+		return set, nil
+	}
+
+	if set, ok := actual.(*Set); ok {
+		return set, nil
+	}
+
+	return nil, WrongTypeError{key, "set"}
+}
+
+func (store *Store) loadSets(keys ...string) ([]*Set, error) {
+	sets := make([]*Set, len(keys))
+	for index, key := range keys {
+		set, err := store.loadSet(key, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if set == nil {
+			set = MakeSet()
+		}
+
+		sets[index] = set
+	}
+
+	return sets, nil
+}
+
+func (store *Store) SAdd(key string, members ...string) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, true)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, member := range members {
+		if set.Add(member) {
+			count++
+		}
+	}
+
+	if count > 0 {
+		store.touch(key)
+	}
+
+	return count, nil
+}
+
+func (store *Store) SRem(key string, members ...string) (int, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, false)
+	if set == nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, member := range members {
+		if set.Remove(member) {
+			count++
+		}
+	}
+
+	if set.Len() == 0 {
+		store.drop(key)
+	} else if count > 0 {
+		store.touch(key)
+	}
+
+	return count, nil
+}
+
+func (store *Store) SIsMember(key, member string) (bool, error) {
+	found, err := store.SMIsMember(key, member)
+	if err != nil {
+		return false, err
+	}
+
+	return found[0], nil
+}
+
+func (store *Store) SMIsMember(key string, members ...string) ([]bool, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(members))
+	if set != nil {
+		for index, member := range members {
+			found[index] = set.Has(member)
+		}
+	}
+
+	return found, nil
+}
+
+func (store *Store) SMembers(key string) ([]string, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, false)
+	if set == nil {
+		return []string{}, err
+	}
+
+	return set.Members(), nil
+}
+
+func (store *Store) SCard(key string) (int, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, false)
+	if set == nil {
+		return 0, err
+	}
+
+	return set.Len(), nil
+}
+
+func (store *Store) SPop(key string, count int) ([]string, error) {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, false)
+	if set == nil {
+		return nil, err
+	}
+
+	members := set.Pop(count)
+	if set.Len() == 0 {
+		store.drop(key)
+	} else if len(members) > 0 {
+		store.touch(key)
+	}
+
+	return members, nil
+}
+
+func (store *Store) SRandMember(key string, count int) ([]string, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, false)
+	if set == nil {
+		return nil, err
+	}
+
+	return set.Random(count), nil
+}
+
+func (store *Store) SScan(key string, cursor uint64, count int, pattern string) ([]string, uint64, error) {
+	unlock := store.RLockKey(key)
+	defer unlock()
+
+	set, err := store.loadSet(key, false)
+	if set == nil {
+		return []string{}, 0, err
+	}
+
+	members, next := set.Scan(cursor, count, pattern)
+	return members, next, nil
+}
+
+type SetOperation int
+
+const (
+	SetInter SetOperation = iota
+	SetUnion
+	SetDiff
+)
+
+func (store *Store) SInter(keys ...string) ([]string, error) {
+	return store.setAlgebra(SetInter, keys...)
+}
+
+func (store *Store) SUnion(keys ...string) ([]string, error) {
+	return store.setAlgebra(SetUnion, keys...)
+}
+
+func (store *Store) SDiff(keys ...string) ([]string, error) {
+	return store.setAlgebra(SetDiff, keys...)
+}
+
+func (store *Store) setAlgebra(operation SetOperation, keys ...string) ([]string, error) {
+	unlock := store.RLockKeys(keys...)
+	defer unlock()
+
+	result, err := store.combineSets(operation, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Members(), nil
+}
+
+func (store *Store) SInterStore(destination string, keys ...string) (int, error) {
+	return store.setAlgebraStore(SetInter, destination, keys...)
+}
+
+func (store *Store) SUnionStore(destination string, keys ...string) (int, error) {
+	return store.setAlgebraStore(SetUnion, destination, keys...)
+}
+
+func (store *Store) SDiffStore(destination string, keys ...string) (int, error) {
+	return store.setAlgebraStore(SetDiff, destination, keys...)
+}
+
+func (store *Store) setAlgebraStore(operation SetOperation, destination string, keys ...string) (int, error) {
+	unlock := store.LockKeys(append([]string{destination}, keys...)...)
+	defer unlock()
+
+	result, err := store.combineSets(operation, keys...)
+	if err != nil {
+		return 0, err
+	}
+
+	if result.Len() == 0 {
+		store.drop(destination)
+	} else {
+		store.put(destination, result, 0)
+	}
+
+	return result.Len(), nil
+}
+
+func (store *Store) combineSets(operation SetOperation, keys ...string) (*Set, error) {
+	sets, err := store.loadSets(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := MakeSet()
+	switch operation {
+	case SetInter:
+		sort.Slice(sets, func(i, j int) bool {
+			return sets[i].Len() < sets[j].Len()
+		})
+
+		for _, member := range sets[0].items {
+			found := true
+			for _, set := range sets[1:] {
+				if !set.Has(member) {
+					found = false
+					break
+				}
+			}
+
+			if found {
+				result.Add(member)
+			}
+		}
+	case SetUnion:
+		for _, set := range sets {
+			for _, member := range set.items {
+				result.Add(member)
+			}
+		}
+	case SetDiff:
+		for _, member := range sets[0].items {
+			found := false
+			for _, set := range sets[1:] {
+				if set.Has(member) {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				result.Add(member)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (store *Store) SMove(source, destination, member string) (bool, error) {
+	unlock := store.LockKeys(source, destination)
+	defer unlock()
+
+	src, err := store.loadSet(source, false)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := store.loadSet(destination, false); err != nil {
+		return false, err
+	}
+
+	if src == nil || !src.Remove(member) {
+		return false, nil
+	}
+
+	if src.Len() == 0 {
+		store.drop(source)
+	} else {
+		store.touch(source)
+	}
+
+	dst, _ := store.loadSet(destination, true)
+	if dst.Add(member) {
+		store.touch(destination)
+	}
+
+	return true, nil
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"math"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -184,6 +186,106 @@ func TestZAdd(t *testing.T) {
 	})
 }
 
+type zAddTestAux struct {
+	flags    ZAddFlags
+	item     SortedSetItem
+	expected int
+	score    float64
+}
+
+func TestZAddWithFlags(t *testing.T) {
+	store := new(Store)
+	store.ZAdd("zset", SortedSetItem{5, "a"})
+
+	t.Run("add and update members depending on flags", func(t *testing.T) {
+		tests := []zAddTestAux{
+			{ZAddNX, SortedSetItem{1, "a"}, 0, 5},
+			{ZAddNX, SortedSetItem{1, "b"}, 1, 1},
+			{ZAddXX, SortedSetItem{2, "c"}, 0, 0},
+			{ZAddXX, SortedSetItem{2, "b"}, 0, 2},
+			{ZAddXX | ZAddCH, SortedSetItem{3, "b"}, 1, 3},
+			{ZAddGT | ZAddCH, SortedSetItem{4, "a"}, 0, 5},
+			{ZAddGT | ZAddCH, SortedSetItem{6, "a"}, 1, 6},
+			{ZAddLT | ZAddCH, SortedSetItem{7, "a"}, 0, 6},
+			{ZAddLT, SortedSetItem{math.Inf(-1), "d"}, 1, math.Inf(-1)},
+			{ZAddCH, SortedSetItem{3, "b"}, 0, 3},
+		}
+
+		for _, te := range tests {
+			count, err := store.ZAddWithFlags("zset", te.flags, te.item)
+			assertInterface(t, nil, err)
+			assertInterface(t, te.expected, count)
+
+			score, _ := sortedSetTestAux(store, "zset").Score(te.item.Member)
+			assertInterface(t, te.score, score)
+		}
+	})
+
+	t.Run("do not create key when updating only", func(t *testing.T) {
+		count, err := store.ZAddWithFlags("missing", ZAddXX, SortedSetItem{1, "a"})
+		assertInterface(t, nil, err)
+		assertInterface(t, 0, count)
+		assertInterface(t, 1, store.DbSize())
+	})
+}
+
+func TestZIncrBy(t *testing.T) {
+	store := new(Store)
+
+	t.Run("increment new and existing members", func(t *testing.T) {
+		score, ok, _ := store.ZIncrBy("zset", 0, SortedSetItem{1.5, "a"})
+		assertInterface(t, true, ok)
+		assertInterface(t, 1.5, score)
+
+		score, ok, _ = store.ZIncrBy("zset", ZAddXX, SortedSetItem{-3, "a"})
+		assertInterface(t, true, ok)
+		assertInterface(t, -1.5, score)
+	})
+
+	t.Run("skip increments rejected by flags", func(t *testing.T) {
+		_, ok, err := store.ZIncrBy("zset", ZAddGT, SortedSetItem{-1, "a"})
+		assertInterface(t, false, ok)
+		assertInterface(t, nil, err)
+
+		_, ok, _ = store.ZIncrBy("missing", ZAddXX, SortedSetItem{1, "a"})
+		assertInterface(t, false, ok)
+		assertInterface(t, 1, store.DbSize())
+	})
+
+	t.Run("reject increments resulting in NaN", func(t *testing.T) {
+		store.ZAdd("zset", SortedSetItem{math.Inf(1), "inf"})
+		if _, _, err := store.ZIncrBy("zset", 0, SortedSetItem{math.Inf(-1), "inf"}); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestZRem(t *testing.T) {
+	store := new(Store)
+	store.ZAdd("zset", SortedSetItem{1, "a"}, SortedSetItem{2, "b"})
+
+	t.Run("remove existing members", func(t *testing.T) {
+		count, err := store.ZRem("zset", "a", "missing")
+		assertInterface(t, nil, err)
+		assertInterface(t, 1, count)
+	})
+
+	t.Run("delete key once empty", func(t *testing.T) {
+		items, _ := store.ZPopMax("zset", 5)
+		assertInterface(t, []SortedSetItem{{2, "b"}}, items)
+		assertInterface(t, 0, store.DbSize())
+		assertInterface(t, int64(0), store.Memory().Used)
+	})
+}
+
+func sortedSetTestAux(store *Store, key string) *SortedSet {
+	unlock := store.LockKey(key)
+	defer unlock()
+
+	sortedSet, _ := store.loadSortedSet(key, false)
+	return sortedSet
+}
+
 func TestZCard(t *testing.T) {
 	store := new(Store)
 	store.Set("foo", "bar")
@@ -226,6 +328,25 @@ func TestZRank(t *testing.T) {
 	})
 }
 
+func TestZRevRank(t *testing.T) {
+	store := new(Store)
+	store.ZAdd("scores", SortedSetItem{1, "a"}, SortedSetItem{2, "b"}, SortedSetItem{3, "c"})
+
+	t.Run("get reverse rank of existing member", func(t *testing.T) {
+		index, ok, err := store.ZRevRank("scores", "a")
+		assertInterface(t, 2, index)
+		assertInterface(t, true, ok)
+		assertInterface(t, nil, err)
+	})
+
+	t.Run("get reverse rank of missing member", func(t *testing.T) {
+		index, ok, err := store.ZRevRank("scores", "missing")
+		assertInterface(t, 0, index)
+		assertInterface(t, false, ok)
+		assertInterface(t, nil, err)
+	})
+}
+
 func TestZRange(t *testing.T) {
 	store := new(Store)
 	store.Set("foo", "bar")
@@ -246,3 +367,512 @@ func TestZRange(t *testing.T) {
 		}
 	})
 }
+
+func TestBinarySafeKeysAndValues(t *testing.T) {
+	store := new(Store)
+	large := strings.Repeat("\x00\xff\r\n", 1024*1024)
+
+	t.Run("set and get keys and values with NUL bytes", func(t *testing.T) {
+		store.Set("foo\x00bar", "\x00\x01\x02")
+		assertGet(t, store, "foo\x00bar", "\x00\x01\x02", true, false)
+		assertGet(t, store, "foo", "", false, false)
+	})
+
+	t.Run("set and get UTF-8 keys and values", func(t *testing.T) {
+		store.Set("ключ", "значение ✓")
+		assertGet(t, store, "ключ", "значение ✓", true, false)
+	})
+
+	t.Run("set and get byte slice value", func(t *testing.T) {
+		store.Set("bytes", []byte{0, 'a', 0xfe})
+		assertGet(t, store, "bytes", "\x00a\xfe", true, false)
+	})
+
+	t.Run("set and get multi megabyte value", func(t *testing.T) {
+		store.Set("large", large)
+		assertGet(t, store, "large", large, true, false)
+	})
+}
+
+type expireTestAux struct {
+	name     string
+	deadline time.Time
+	flags    ExpireFlags
+	expected bool
+}
+
+func TestExpire(t *testing.T) {
+	store := new(Store)
+	now := time.Now()
+
+	t.Run("expire non existing key", func(t *testing.T) {
+		if store.Expire("foo", now.Add(time.Minute), 0) {
+			t.Errorf("expected false, got true")
+		}
+	})
+
+	t.Run("expire key with conditions", func(t *testing.T) {
+		store.Set("foo", "bar")
+
+		tests := []expireTestAux{
+			{"XX on persistent key", now.Add(time.Minute), ExpireXX, false},
+			{"GT on persistent key", now.Add(time.Minute), ExpireGT, false},
+			{"NX on persistent key", now.Add(time.Minute), ExpireNX, true},
+			{"NX on volatile key", now.Add(time.Hour), ExpireNX, false},
+			{"GT with smaller deadline", now.Add(time.Second), ExpireGT, false},
+			{"GT with greater deadline", now.Add(time.Hour), ExpireGT, true},
+			{"LT with greater deadline", now.Add(2 * time.Hour), ExpireLT, false},
+			{"XX and LT with smaller deadline", now.Add(time.Minute), ExpireXX | ExpireLT, true},
+			{"without conditions", now.Add(2 * time.Minute), 0, true},
+		}
+
+		for _, te := range tests {
+			if ok := store.Expire("foo", te.deadline, te.flags); ok != te.expected {
+				t.Errorf("%s: expected %v, got %v", te.name, te.expected, ok)
+			}
+		}
+
+		if deadline, exists, volatile := store.Deadline("foo"); !exists || !volatile || !deadline.Equal(now.Add(2*time.Minute)) {
+			t.Errorf("expected deadline %v, got %v (exists %v, volatile %v)", now.Add(2*time.Minute), deadline, exists, volatile)
+		}
+	})
+
+	t.Run("LT on persistent key", func(t *testing.T) {
+		store.Set("fizz", "buzz")
+		if !store.Expire("fizz", now.Add(time.Hour), ExpireLT) {
+			t.Errorf("expected true, got false")
+		}
+	})
+
+	t.Run("expire key with deadline in the past", func(t *testing.T) {
+		store.Set("past", "value")
+		if !store.Expire("past", now.Add(-time.Second), 0) {
+			t.Errorf("expected true, got false")
+		}
+
+		assertGet(t, store, "past", "", false, false)
+	})
+
+	t.Run("expire key after deadline", func(t *testing.T) {
+		store.Set("short", "value")
+		store.Expire("short", time.Now().Add(20*time.Millisecond), 0)
+		time.Sleep(100 * time.Millisecond)
+
+		assertGet(t, store, "short", "", false, false)
+	})
+}
+
+func TestDeadline(t *testing.T) {
+	store := new(Store)
+	store.Set("foo", "bar")
+
+	t.Run("get deadline of non existing key", func(t *testing.T) {
+		if _, exists, _ := store.Deadline("fizz"); exists {
+			t.Errorf("expected false, got true")
+		}
+	})
+
+	t.Run("get deadline of persistent key", func(t *testing.T) {
+		if _, exists, volatile := store.Deadline("foo"); !exists || volatile {
+			t.Errorf("expected key to exist without deadline")
+		}
+	})
+
+	t.Run("set key clears deadline", func(t *testing.T) {
+		store.SetEx("foo", "bar", 10)
+		store.Set("foo", "baz")
+
+		if _, _, volatile := store.Deadline("foo"); volatile {
+			t.Errorf("expected false, got true")
+		}
+	})
+}
+
+func TestPersist(t *testing.T) {
+	store := new(Store)
+	store.SetEx("foo", "bar", 10)
+	store.Set("fizz", "buzz")
+
+	t.Run("persist volatile key", func(t *testing.T) {
+		if !store.Persist("foo") {
+			t.Errorf("expected true, got false")
+		}
+
+		if _, _, volatile := store.Deadline("foo"); volatile {
+			t.Errorf("expected false, got true")
+		}
+	})
+
+	t.Run("persist persistent and non existing keys", func(t *testing.T) {
+		if store.Persist("fizz") || store.Persist("xyz") {
+			t.Errorf("expected false, got true")
+		}
+	})
+}
+
+func TestHSet(t *testing.T) {
+	store := new(Store)
+	store.Set("foo", "bar")
+
+	t.Run("set fields of non existing key", func(t *testing.T) {
+		if count, err := store.HSet("user:1", HashItem{"name", "ann"}, HashItem{"age", "30"}); err == nil {
+			assertInterface(t, 2, count)
+		} else {
+			t.Errorf("expected nil, got %q", err)
+		}
+	})
+
+	t.Run("set new and existing fields", func(t *testing.T) {
+		if count, err := store.HSet("user:1", HashItem{"name", "bob"}, HashItem{"city", "rio"}); err == nil {
+			assertInterface(t, 1, count)
+		} else {
+			t.Errorf("expected nil, got %q", err)
+		}
+	})
+
+	t.Run("set fields of key with invalid value", func(t *testing.T) {
+		_, err := store.HSet("foo", HashItem{"name", "ann"})
+		if _, ok := err.(WrongTypeError); !ok {
+			t.Errorf("expected wrong type error, got %v", err)
+		}
+	})
+
+	t.Run("get hash as string", func(t *testing.T) {
+		if _, _, err := store.Get("user:1"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestHGet(t *testing.T) {
+	store := new(Store)
+	store.HSet("user:1", HashItem{"name", "ann"})
+
+	t.Run("get existing field", func(t *testing.T) {
+		value, ok, err := store.HGet("user:1", "name")
+		assertInterface(t, "ann", value)
+		assertInterface(t, true, ok)
+		assertInterface(t, nil, err)
+	})
+
+	t.Run("get missing field and key", func(t *testing.T) {
+		if _, ok, _ := store.HGet("user:1", "age"); ok {
+			t.Errorf("expected false, got true")
+		}
+
+		if _, ok, _ := store.HGet("user:2", "name"); ok {
+			t.Errorf("expected false, got true")
+		}
+	})
+
+	t.Run("get multiple fields", func(t *testing.T) {
+		values, _ := store.HMGet("user:1", "name", "age")
+		assertInterface(t, []interface{}{"ann", nil}, values)
+	})
+}
+
+func TestHDel(t *testing.T) {
+	store := new(Store)
+	store.HSet("user:1", HashItem{"name", "ann"}, HashItem{"age", "30"})
+
+	t.Run("delete fields", func(t *testing.T) {
+		count, _ := store.HDel("user:1", "name", "city")
+		assertInterface(t, 1, count)
+	})
+
+	t.Run("delete last field removes key", func(t *testing.T) {
+		store.HDel("user:1", "age")
+		assertInterface(t, 0, store.DbSize())
+	})
+}
+
+func TestHIncrBy(t *testing.T) {
+	store := new(Store)
+	store.HSet("user:1", HashItem{"name", "ann"}, HashItem{"max", "9223372036854775807"})
+
+	t.Run("increment missing field", func(t *testing.T) {
+		num, _ := store.HIncrBy("user:1", "visits", 5)
+		assertInterface(t, 5, num)
+	})
+
+	t.Run("decrement existing field", func(t *testing.T) {
+		num, _ := store.HIncrBy("user:1", "visits", -7)
+		assertInterface(t, -2, num)
+	})
+
+	t.Run("increment invalid fields", func(t *testing.T) {
+		if _, err := store.HIncrBy("user:1", "name", 1); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if _, err := store.HIncrBy("user:1", "max", 1); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestHGetAll(t *testing.T) {
+	store := new(Store)
+	store.HSet("user:1", HashItem{"name", "ann"}, HashItem{"age", "30"})
+
+	t.Run("get all fields and values", func(t *testing.T) {
+		items, _ := store.HGetAll("user:1")
+		assertInterface(t, []HashItem{{"age", "30"}, {"name", "ann"}}, items)
+
+		keys, _ := store.HKeys("user:1")
+		assertInterface(t, []string{"age", "name"}, keys)
+
+		values, _ := store.HVals("user:1")
+		assertInterface(t, []string{"30", "ann"}, values)
+
+		count, _ := store.HLen("user:1")
+		assertInterface(t, 2, count)
+	})
+
+	t.Run("get all fields of non existing key", func(t *testing.T) {
+		items, _ := store.HGetAll("user:2")
+		assertInterface(t, []HashItem{}, items)
+	})
+}
+
+func TestLPush(t *testing.T) {
+	store := new(Store)
+	store.Set("foo", "bar")
+
+	t.Run("push to non existing key", func(t *testing.T) {
+		count, _ := store.LPush("queue", "a", "b")
+		assertInterface(t, 2, count)
+
+		count, _ = store.RPush("queue", "c")
+		assertInterface(t, 3, count)
+
+		values, _ := store.LRange("queue", 0, -1)
+		assertInterface(t, []string{"b", "a", "c"}, values)
+	})
+
+	t.Run("push to key with invalid value", func(t *testing.T) {
+		if _, err := store.RPush("foo", "a"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestLPop(t *testing.T) {
+	store := new(Store)
+	store.RPush("queue", "a", "b", "c")
+
+	t.Run("pop values", func(t *testing.T) {
+		values, _ := store.LPop("queue", 1)
+		assertInterface(t, []string{"a"}, values)
+
+		values, _ = store.RPop("queue", 5)
+		assertInterface(t, []string{"c", "b"}, values)
+	})
+
+	t.Run("pop last value removes key", func(t *testing.T) {
+		assertInterface(t, 0, store.DbSize())
+
+		values, _ := store.LPop("queue", 1)
+		if values != nil {
+			t.Errorf("expected nil, got %v", values)
+		}
+	})
+}
+
+func TestLSet(t *testing.T) {
+	store := new(Store)
+	store.RPush("queue", "a")
+
+	t.Run("set valid and invalid indexes", func(t *testing.T) {
+		assertInterface(t, nil, store.LSet("queue", 0, "b"))
+
+		if err := store.LSet("queue", 1, "c"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		if err := store.LSet("missing", 0, "c"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestLMove(t *testing.T) {
+	store := new(Store)
+	store.RPush("src", "a", "b")
+	store.Set("str", "value")
+
+	t.Run("move between lists", func(t *testing.T) {
+		value, ok, _ := store.LMove("src", "dst", ListLeft, ListRight)
+		assertInterface(t, "a", value)
+		assertInterface(t, true, ok)
+
+		value, _, _ = store.LMove("src", "dst", ListRight, ListLeft)
+		assertInterface(t, "b", value)
+
+		values, _ := store.LRange("dst", 0, -1)
+		assertInterface(t, []string{"b", "a"}, values)
+		assertInterface(t, 2, store.DbSize())
+	})
+
+	t.Run("move from missing list", func(t *testing.T) {
+		if _, ok, _ := store.LMove("src", "dst", ListLeft, ListRight); ok {
+			t.Errorf("expected false, got true")
+		}
+	})
+
+	t.Run("move to key with invalid value", func(t *testing.T) {
+		if _, _, err := store.LMove("dst", "str", ListLeft, ListRight); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		count, _ := store.LLen("dst")
+		assertInterface(t, 2, count)
+	})
+
+	t.Run("rotate list in opposite directions concurrently", func(t *testing.T) {
+		store.RPush("x", "1", "2")
+		store.RPush("y", "3", "4")
+
+		wg := new(sync.WaitGroup)
+		for n := 0; n < 100; n++ {
+			wg.Add(2)
+			go func() {
+				store.LMove("x", "y", ListLeft, ListRight)
+				wg.Done()
+			}()
+			go func() {
+				store.LMove("y", "x", ListLeft, ListRight)
+				wg.Done()
+			}()
+		}
+
+		wg.Wait()
+
+		x, _ := store.LLen("x")
+		y, _ := store.LLen("y")
+		assertInterface(t, 4, x+y)
+	})
+}
+
+func TestSAdd(t *testing.T) {
+	store := new(Store)
+	store.Set("foo", "bar")
+
+	t.Run("add members", func(t *testing.T) {
+		count, _ := store.SAdd("tags", "a", "b", "a")
+		assertInterface(t, 2, count)
+
+		members, _ := store.SMembers("tags")
+		assertInterface(t, []string{"a", "b"}, members)
+	})
+
+	t.Run("add to key with invalid value", func(t *testing.T) {
+		if _, err := store.SAdd("foo", "a"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("remove all members removes key", func(t *testing.T) {
+		count, _ := store.SRem("tags", "a", "b", "c")
+		assertInterface(t, 2, count)
+		assertInterface(t, 1, store.DbSize())
+	})
+}
+
+func TestSetAlgebra(t *testing.T) {
+	store := new(Store)
+	store.SAdd("a", "1", "2", "3", "4")
+	store.SAdd("b", "2", "3", "5")
+	store.SAdd("c", "3", "6")
+	store.Set("str", "value")
+
+	t.Run("intersect, unite and diff sets", func(t *testing.T) {
+		inter, _ := store.SInter("a", "b", "c")
+		assertInterface(t, []string{"3"}, inter)
+
+		union, _ := store.SUnion("a", "b", "missing")
+		assertInterface(t, []string{"1", "2", "3", "4", "5"}, union)
+
+		diff, _ := store.SDiff("a", "b", "c")
+		assertInterface(t, []string{"1", "4"}, diff)
+
+		inter, _ = store.SInter("a", "missing")
+		assertInterface(t, []string{}, inter)
+	})
+
+	t.Run("store set operation results", func(t *testing.T) {
+		count, _ := store.SUnionStore("dst", "b", "c")
+		assertInterface(t, 4, count)
+
+		count, _ = store.SInterStore("b", "a", "b")
+		assertInterface(t, 2, count)
+
+		members, _ := store.SMembers("b")
+		assertInterface(t, []string{"2", "3"}, members)
+
+		count, _ = store.SDiffStore("dst", "c", "c")
+		assertInterface(t, 0, count)
+
+		if _, _, err := store.Get("dst"); err != nil {
+			t.Errorf("expected empty result to delete destination, got %q", err)
+		}
+	})
+
+	t.Run("operate with key with invalid value", func(t *testing.T) {
+		if _, err := store.SInter("a", "str"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestSMove(t *testing.T) {
+	store := new(Store)
+	store.SAdd("src", "a", "b")
+	store.Set("str", "value")
+
+	t.Run("move members", func(t *testing.T) {
+		ok, _ := store.SMove("src", "dst", "a")
+		assertInterface(t, true, ok)
+
+		ok, _ = store.SMove("src", "dst", "a")
+		assertInterface(t, false, ok)
+
+		members, _ := store.SMembers("dst")
+		assertInterface(t, []string{"a"}, members)
+	})
+
+	t.Run("move to key with invalid value", func(t *testing.T) {
+		if _, err := store.SMove("src", "str", "b"); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+
+		ok, _ := store.SIsMember("src", "b")
+		assertInterface(t, true, ok)
+	})
+
+	t.Run("run crossing multi key operations concurrently", func(t *testing.T) {
+		store.SAdd("x", "1", "2")
+		store.SAdd("y", "2", "3")
+
+		wg := new(sync.WaitGroup)
+		for n := 0; n < 100; n++ {
+			wg.Add(3)
+			go func() {
+				store.SInterStore("x", "y", "x")
+				store.SAdd("x", "1", "2")
+				wg.Done()
+			}()
+			go func() {
+				store.SUnionStore("y", "x", "y")
+				wg.Done()
+			}()
+			go func() {
+				store.SMove("y", "x", "3")
+				store.SMove("x", "y", "3")
+				wg.Done()
+			}()
+		}
+
+		wg.Wait()
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func Tokenize(line string) ([]string, error) {
+	tokens := make([]string, 0)
+
+	for pos := 0; ; {
+		for pos < len(line) && isSpace(line[pos]) {
+			pos++
+		}
+
+		if pos >= len(line) {
+			return tokens, nil
+		}
+
+		token, next, err := readToken(line, pos)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+		pos = next
+	}
+}
+
+func readToken(line string, pos int) (string, int, error) {
+	var builder strings.Builder
+	inDouble, inSingle := false, false
+
+	for ; pos < len(line); pos++ {
+		char := line[pos]
+
+		switch {
+		case inDouble:
+			switch {
+			case char == '\\' && pos+3 < len(line) && line[pos+1] == 'x' && isHexDigit(line[pos+2]) && isHexDigit(line[pos+3]):
+				builder.WriteByte(hexDigitToInt(line[pos+2])<<4 | hexDigitToInt(line[pos+3]))
+				pos += 3
+			case char == '\\' && pos+1 < len(line):
+				pos++
+				builder.WriteByte(unescapeChar(line[pos]))
+			case char == '"':
+				if pos+1 < len(line) && !isSpace(line[pos+1]) {
+					return "", 0, fmt.Errorf("miniredis: closing quote must be followed by a space")
+				}
+				return builder.String(), pos + 1, nil
+			default:
+				builder.WriteByte(char)
+			}
+		case inSingle:
+			switch {
+			case char == '\\' && pos+1 < len(line) && line[pos+1] == '\'':
+				pos++
+				builder.WriteByte('\'')
+			case char == '\'':
+				if pos+1 < len(line) && !isSpace(line[pos+1]) {
+					return "", 0, fmt.Errorf("miniredis: closing quote must be followed by a space")
+				}
+				return builder.String(), pos + 1, nil
+			default:
+				builder.WriteByte(char)
+			}
+		default:
+			switch {
+			case isSpace(char):
+				return builder.String(), pos, nil
+			case char == '"':
+				inDouble = true
+			case char == '\'':
+				inSingle = true
+			default:
+				builder.WriteByte(char)
+			}
+		}
+	}
+
+	if inDouble || inSingle {
+		return "", 0, fmt.Errorf("miniredis: unbalanced quotes in %q", line)
+	}
+
+	return builder.String(), pos, nil
+}
+
+func unescapeChar(char byte) byte {
+	switch char {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+
+	return char
+}
+
+func isSpace(char byte) bool {
+	switch char {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	}
+
+	return false
+}
+
+func isHexDigit(char byte) bool {
+	return (char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
+}
+
+func hexDigitToInt(char byte) byte {
+	switch {
+	case char >= 'a':
+		return char - 'a' + 10
+	case char >= 'A':
+		return char - 'A' + 10
+	}
+
+	return char - '0'
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+type tokenizeTestAux struct {
+	line     string
+	expected []string
+}
+
+func TestTokenize(t *testing.T) {
+	t.Run("tokenize valid lines", func(t *testing.T) {
+		tests := []tokenizeTestAux{
+			{"", []string{}},
+			{"   ", []string{}},
+			{"GET foo", []string{"GET", "foo"}},
+			{"  SET   user:42\tbar  ", []string{"SET", "user:42", "bar"}},
+			{`SET foo "hello world"`, []string{"SET", "foo", "hello world"}},
+			{`SET foo 'hello world'`, []string{"SET", "foo", "hello world"}},
+			{`SET foo ""`, []string{"SET", "foo", ""}},
+			{`ECHO "a\"b\\c\n\t"`, []string{"ECHO", "a\"b\\c\n\t"}},
+			{`ECHO "\x41\x00\xff"`, []string{"ECHO", "A\x00\xff"}},
+			{`ECHO "\xZZ"`, []string{"ECHO", "xZZ"}},
+			{`ECHO 'it\'s \n'`, []string{"ECHO", `it's \n`}},
+			{`ECHO foo"bar baz"`, []string{"ECHO", "foobar baz"}},
+			{"ECHO héllo", []string{"ECHO", "héllo"}},
+		}
+
+		for _, te := range tests {
+			if tokens, err := Tokenize(te.line); err == nil {
+				assertInterface(t, te.expected, tokens)
+			} else {
+				t.Errorf("expected nil for %q, got %q", te.line, err)
+			}
+		}
+	})
+
+	t.Run("tokenize invalid lines", func(t *testing.T) {
+		lines := []string{
+			`SET foo "bar`,
+			`SET foo 'bar`,
+			`SET foo "bar"baz`,
+			`SET foo 'bar'baz`,
+		}
+
+		for _, line := range lines {
+			if _, err := Tokenize(line); err == nil {
+				t.Errorf("expected error for %q, got nil", line)
+			}
+		}
+	})
+}
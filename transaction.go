@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type watchRegistry struct {
+	mutex    sync.Mutex
+	count    int32
+	watchers map[string]map[*Transaction]struct{}
+}
+
+type ExecAbortError struct{}
+
+func (err ExecAbortError) Error() string {
+	return "miniredis: Transaction discarded because of previous errors."
+}
+
+type Transaction struct {
+	active    bool
+	failed    bool
+	executing bool
+	queued    [][]string
+
+	watched map[string]struct{}
+	dirty   int32
+}
+
+func (txn *Transaction) Begin() {
+	txn.active = true
+}
+
+func (txn *Transaction) Active() bool {
+	return txn != nil && txn.active
+}
+
+func (txn *Transaction) Executing() bool {
+	return txn != nil && txn.executing
+}
+
+func (txn *Transaction) Queue(args []string) {
+	txn.queued = append(txn.queued, args)
+}
+
+func (txn *Transaction) Fail() {
+	txn.failed = true
+}
+
+func (txn *Transaction) Dirty() bool {
+	return atomic.LoadInt32(&txn.dirty) != 0
+}
+
+func (txn *Transaction) reset() [][]string {
+	queued := txn.queued
+	txn.active, txn.failed, txn.queued = false, false, nil
+
+	return queued
+}
+
+func (store *Store) Watch(txn *Transaction, keys ...string) {
+	for _, key := range keys {
+		if _, ok := txn.watched[key]; ok {
+			continue
+		}
+
+		unlock := store.LockKey(key)
+		store.watch(txn, key)
+		unlock()
+	}
+}
+
+func (store *Store) watch(txn *Transaction, key string) {
+	registry := &store.watched
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.watchers == nil {
+		registry.watchers = make(map[string]map[*Transaction]struct{})
+	}
+
+	if registry.watchers[key] == nil {
+		registry.watchers[key] = make(map[*Transaction]struct{})
+		atomic.AddInt32(&registry.count, 1)
+	}
+
+	if txn.watched == nil {
+		txn.watched = make(map[string]struct{})
+	}
+
+	registry.watchers[key][txn] = struct{}{}
+	txn.watched[key] = struct{}{}
+}
+
+func (store *Store) Unwatch(txn *Transaction) {
+	registry := &store.watched
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for key := range txn.watched {
+		delete(registry.watchers[key], txn)
+		if len(registry.watchers[key]) == 0 {
+			delete(registry.watchers, key)
+			atomic.AddInt32(&registry.count, -1)
+		}
+	}
+
+	txn.watched = nil
+	atomic.StoreInt32(&txn.dirty, 0)
+}
+
+func (store *Store) WatchedKeys(txn *Transaction) []string {
+	registry := &store.watched
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	keys := make([]string, 0, len(txn.watched))
+	for key := range txn.watched {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (store *Store) touchWatched(key string) {
+	registry := &store.watched
+	if atomic.LoadInt32(&registry.count) == 0 {
+		return
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for txn := range registry.watchers[key] {
+		atomic.StoreInt32(&txn.dirty, 1)
+	}
+}
+
+func (store *Store) expireWatched(txn *Transaction) {
+	for _, key := range store.WatchedKeys(txn) {
+		store.expireKey(key)
+	}
+}
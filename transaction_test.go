@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	store := new(Store)
+
+	t.Run("mark transaction dirty when watched key is modified", func(t *testing.T) {
+		modifications := []func(){
+			func() { store.Set("key", "value") },
+			func() { store.Del("key") },
+			func() { store.HSet("key", HashItem{"field", "value"}) },
+			func() { store.HDel("key", "field") },
+			func() { store.RPush("key", "a", "b") },
+			func() { store.LPop("key", 1) },
+			func() { store.LSet("key", 0, "c") },
+			func() { store.SAdd("other", "member") },
+			func() { store.SMove("other", "set", "member") },
+			func() { store.Expire("set", time.Now().Add(time.Hour), 0) },
+		}
+		keys := []string{"key", "key", "key", "key", "key", "key", "key", "other", "set", "set"}
+
+		for index, modify := range modifications {
+			txn := new(Transaction)
+			store.Watch(txn, keys[index])
+			modify()
+
+			if !txn.Dirty() {
+				t.Errorf("expected modification %d to mark %q as dirty", index, keys[index])
+			}
+
+			store.Unwatch(txn)
+		}
+	})
+
+	t.Run("keep transaction clean on reads and no-op writes", func(t *testing.T) {
+		store.Set("str", "value")
+		store.SAdd("members", "a")
+
+		txn := new(Transaction)
+		store.Watch(txn, "str", "members", "missing")
+
+		store.Get("str")
+		store.SMembers("members")
+		store.SAdd("members", "a")
+		store.SRem("members", "b")
+		store.Del("missing")
+		store.Set("unrelated", "value")
+
+		assertInterface(t, false, txn.Dirty())
+		assertInterface(t, []string{"members", "missing", "str"}, store.WatchedKeys(txn))
+
+		store.Unwatch(txn)
+		store.Set("str", "other")
+
+		assertInterface(t, false, txn.Dirty())
+		assertInterface(t, []string{}, store.WatchedKeys(txn))
+		assertInterface(t, 0, len(store.watched.watchers))
+	})
+
+	t.Run("mark transaction dirty when watched key expires", func(t *testing.T) {
+		store.SetWithDeadline("volatile", "value", time.Now().Add(10*time.Millisecond))
+
+		txn := new(Transaction)
+		store.Watch(txn, "volatile")
+
+		time.Sleep(20 * time.Millisecond)
+		store.expireWatched(txn)
+
+		assertInterface(t, true, txn.Dirty())
+		store.Unwatch(txn)
+	})
+}